@@ -0,0 +1,198 @@
+package okra
+
+import (
+	"context"
+	"iter"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Result is the outcome of evaluating a Program against one record of a batch
+// (see Program.EvalBatch and Program.EvalSeq).
+type Result struct {
+	Value any
+	Err   error
+}
+
+// BatchOption configures EvalBatch and EvalSeq.
+type BatchOption func(*batchConfig)
+
+type batchConfig struct {
+	workers int
+}
+
+// WithParallelism sets how many goroutines evaluate records concurrently. 1
+// evaluates on the calling goroutine; n <= 0 selects runtime.GOMAXPROCS(0) (the
+// default).
+func WithParallelism(n int) BatchOption {
+	return func(c *batchConfig) { c.workers = n }
+}
+
+// batchGrain is how many consecutive records a worker claims at once, which
+// keeps contention on the shared cursor negligible for cheap rules.
+const batchGrain = 16
+
+// seqChunk is how many records per worker EvalSeq buffers between yields.
+const seqChunk = 256
+
+func newBatchConfig(opts []BatchOption) batchConfig {
+	var c batchConfig
+	for _, o := range opts {
+		o(&c)
+	}
+	if c.workers <= 0 {
+		c.workers = runtime.GOMAXPROCS(0)
+	}
+	return c
+}
+
+// EvalBatch evaluates the Program against every record, with the parallelism
+// set by WithParallelism, and returns one Result per record in input order. A
+// failing record only fails its own Result; panics are recovered per record,
+// as in Eval.
+//
+// ctx is shared by the whole batch with EvalContext semantics: once it is done,
+// evaluation stops, records not yet evaluated report ctx.Err(), and EvalBatch
+// returns ctx.Err(). Otherwise the error is nil. Each worker reuses one
+// evaluation context and step counter across its records, so the batch itself
+// allocates nothing per record.
+func (p *Program) EvalBatch(ctx context.Context, records []any, opts ...BatchOption) ([]Result, error) {
+	out := make([]Result, len(records))
+	return out, p.evalInto(ctx, records, out, newBatchConfig(opts).workers)
+}
+
+// EvalSeq is the streaming form of EvalBatch: it evaluates records as they are
+// pulled from the sequence, with the same parallelism, error and cancellation
+// semantics, and yields Results in input order. With parallelism above 1 it
+// buffers a bounded chunk of records per worker, reusing the buffers from
+// chunk to chunk. Once ctx is done, the remaining Results of the current chunk
+// report ctx.Err() and the sequence ends.
+func (p *Program) EvalSeq(ctx context.Context, records iter.Seq[any], opts ...BatchOption) iter.Seq[Result] {
+	workers := newBatchConfig(opts).workers
+	return func(yield func(Result) bool) {
+		if workers == 1 {
+			w := p.newBatchWorker(ctx)
+			for data := range records {
+				if w.done() {
+					yield(Result{Err: ctx.Err()})
+					return
+				}
+				if !yield(w.eval(data)) {
+					return
+				}
+			}
+			return
+		}
+		buf := make([]any, 0, workers*seqChunk)
+		out := make([]Result, workers*seqChunk)
+		flush := func() bool {
+			err := p.evalInto(ctx, buf, out[:len(buf)], workers)
+			for i := range buf {
+				if !yield(out[i]) {
+					return false
+				}
+			}
+			clear(buf)
+			buf = buf[:0]
+			return err == nil
+		}
+		for data := range records {
+			if buf = append(buf, data); len(buf) == cap(buf) && !flush() {
+				return
+			}
+		}
+		if len(buf) > 0 {
+			flush()
+		}
+	}
+}
+
+// evalInto evaluates records into out (of the same length) on up to workers
+// goroutines, returning ctx.Err() if the batch was cut short.
+func (p *Program) evalInto(ctx context.Context, records []any, out []Result, workers int) error {
+	if err := ctx.Err(); err != nil {
+		fillErr(out, err)
+		return err
+	}
+	workers = min(workers, (len(records)+batchGrain-1)/batchGrain)
+	if workers <= 1 {
+		w := p.newBatchWorker(ctx)
+		for i, data := range records {
+			if w.done() {
+				fillErr(out[i:], ctx.Err())
+				return ctx.Err()
+			}
+			out[i] = w.eval(data)
+		}
+		return nil
+	}
+
+	var next atomic.Int64
+	var cut atomic.Bool
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := p.newBatchWorker(ctx)
+			for {
+				lo := int(next.Add(batchGrain)) - batchGrain
+				if lo >= len(records) {
+					return
+				}
+				hi := min(lo+batchGrain, len(records))
+				for i := lo; i < hi; i++ {
+					if w.done() {
+						fillErr(out[i:hi], ctx.Err())
+						cut.Store(true)
+						break
+					}
+					out[i] = w.eval(records[i])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if cut.Load() {
+		return ctx.Err()
+	}
+	return nil
+}
+
+func fillErr(out []Result, err error) {
+	for i := range out {
+		out[i] = Result{Err: err}
+	}
+}
+
+// batchWorker evaluates records one after another with a single Context whose
+// step counter carries over between records, so cancellation is polled every
+// 1024 steps of the whole run rather than of each record.
+type batchWorker struct {
+	p     *Program
+	c     Context
+	steps uint64
+}
+
+func (p *Program) newBatchWorker(ctx context.Context) *batchWorker {
+	w := &batchWorker{p: p, c: p.context(nil)}
+	w.c.ctx, w.c.steps = ctx, &w.steps
+	return w
+}
+
+// done reports, without blocking, whether the batch's context is done.
+func (w *batchWorker) done() bool {
+	select {
+	case <-w.c.ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *batchWorker) eval(data any) Result {
+	w.c.Data = data
+	v, err := w.p.run(w.c)
+	return Result{Value: v, Err: err}
+}
@@ -0,0 +1,155 @@
+package okra
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func batchRecords(n int) []any {
+	recs := make([]any, n)
+	for i := range recs {
+		recs[i] = map[string]any{"a": int64(i)}
+	}
+	// One record fails, one panics inside a function.
+	recs[3] = map[string]any{"a": "x"}
+	recs[5] = map[string]any{"a": int64(-1)}
+	return recs
+}
+
+func batchProg(t testing.TB) *Program {
+	e := NewEngine()
+	err := e.RegisterFunc("check", func(args []any) (any, error) {
+		if args[0] == int64(-1) {
+			panic("negative")
+		}
+		return args[0], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := e.Compile("check(a) * 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prog
+}
+
+func TestEvalBatch(t *testing.T) {
+	prog := batchProg(t)
+	recs := batchRecords(1000)
+	for _, par := range []int{1, 4, 0} {
+		res, err := prog.EvalBatch(context.Background(), recs, WithParallelism(par))
+		if err != nil || len(res) != len(recs) {
+			t.Fatalf("par=%d: %d results, %v", par, len(res), err)
+		}
+		for i, r := range res {
+			v, err := prog.Eval(recs[i])
+			if r.Value != v || (r.Err == nil) != (err == nil) || err != nil && r.Err.Error() != err.Error() {
+				t.Fatalf("par=%d record %d: got %v, %v; want %v, %v", par, i, r.Value, r.Err, v, err)
+			}
+		}
+		if res[3].Err == nil || res[5].Err == nil || res[5].Err.Error() != "panic: negative" {
+			t.Fatalf("par=%d: per-record errors %v, %v", par, res[3].Err, res[5].Err)
+		}
+	}
+}
+
+func TestEvalBatchCancel(t *testing.T) {
+	prog := batchProg(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, par := range []int{1, 4} {
+		res, err := prog.EvalBatch(ctx, batchRecords(100), WithParallelism(par))
+		if !errors.Is(err, context.Canceled) || len(res) != 100 || !errors.Is(res[99].Err, context.Canceled) {
+			t.Fatalf("par=%d: %v", par, err)
+		}
+	}
+
+	// Cancelling from a function mid-batch stops the remaining records.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	e := NewEngine()
+	_ = e.RegisterFunc("stop", func(args []any) (any, error) {
+		if args[0] == int64(10) {
+			cancel()
+		}
+		return true, nil
+	})
+	stop, _ := e.Compile("stop(a)")
+	res, err := stop.EvalBatch(ctx, batchRecords(100)[6:], WithParallelism(1))
+	if !errors.Is(err, context.Canceled) || res[4].Err != nil || !errors.Is(res[5].Err, context.Canceled) {
+		t.Fatalf("mid-batch cancel: %v, %+v", err, res[3:6])
+	}
+
+	// Cancelling once every record is evaluated cuts nothing short.
+	for _, par := range []int{1, 4} {
+		ctx, cancel := context.WithCancel(context.Background())
+		var calls atomic.Int64
+		recs := batchRecords(10 * batchGrain)[6:]
+		e := NewEngine()
+		_ = e.RegisterFunc("last", func(args []any) (any, error) {
+			if calls.Add(1) == int64(len(recs)) {
+				cancel()
+			}
+			return true, nil
+		})
+		last, _ := e.Compile("last(a)")
+		res, err := last.EvalBatch(ctx, recs, WithParallelism(par))
+		if err != nil || slices.ContainsFunc(res, func(r Result) bool { return r.Err != nil }) {
+			t.Fatalf("par=%d: cancelled after the last record: %v", par, err)
+		}
+		cancel()
+	}
+}
+
+func TestEvalSeq(t *testing.T) {
+	prog := batchProg(t)
+	recs := batchRecords(3000)
+	want, _ := prog.EvalBatch(context.Background(), recs, WithParallelism(1))
+	for _, par := range []int{1, 3} {
+		got := slices.Collect(prog.EvalSeq(context.Background(), slices.Values(recs), WithParallelism(par)))
+		if len(got) != len(want) {
+			t.Fatalf("par=%d: %d results", par, len(got))
+		}
+		for i := range got {
+			if got[i].Value != want[i].Value || (got[i].Err == nil) != (want[i].Err == nil) {
+				t.Fatalf("par=%d record %d: %+v, want %+v", par, i, got[i], want[i])
+			}
+		}
+		// Breaking out early is honored.
+		n := 0
+		for range prog.EvalSeq(context.Background(), slices.Values(recs), WithParallelism(par)) {
+			if n++; n == 10 {
+				break
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, par := range []int{1, 3} {
+		got := slices.Collect(prog.EvalSeq(ctx, slices.Values(recs), WithParallelism(par)))
+		if len(got) == 0 || len(got) == len(recs) || !errors.Is(got[len(got)-1].Err, context.Canceled) {
+			t.Fatalf("par=%d: cancelled sequence yielded %d results", par, len(got))
+		}
+	}
+}
+
+func TestEvalBatchAllocs(t *testing.T) {
+	prog, err := NewEngine().Compile("a > 10 && a < 900")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := batchRecords(1000)
+	recs[3], recs[5] = recs[4], recs[4]
+	allocs := testing.AllocsPerRun(10, func() {
+		_, _ = prog.EvalBatch(context.Background(), recs, WithParallelism(1))
+	})
+	// The Result slice and the worker, not one per record.
+	if allocs > 5 {
+		t.Fatalf("%v allocations for %d records", allocs, len(recs))
+	}
+}
@@ -2,7 +2,9 @@ package okra
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -160,6 +162,20 @@ func BenchmarkInSlice10(b *testing.B)   { benchmarkInSlice(b, 10) }
 func BenchmarkInSlice1000(b *testing.B) { benchmarkInSlice(b, 1000) }
 func BenchmarkInSlice100k(b *testing.B) { benchmarkInSlice(b, 100_000) }
 
+// BenchmarkInLiteralList500 is an allowlist rule: a literal list, hashed at
+// Compile, so the cost doesn't grow with its length.
+func BenchmarkInLiteralList500(b *testing.B) {
+	items := make([]string, 500)
+	for i := range items {
+		items[i] = fmt.Sprintf("'user%d'", i)
+	}
+	prog := mustCompile(b, NewEngine(), "status in ["+strings.Join(items, ", ")+"]")
+	data := benchData()
+	for b.Loop() {
+		_, _ = prog.Eval(data)
+	}
+}
+
 // --- eval: macro (userland any over a collection) --------------------------------
 
 func BenchmarkMacroAnyOver100(b *testing.B) {
@@ -244,6 +260,109 @@ func BenchmarkEvalParallel(b *testing.B) {
 	})
 }
 
+// BenchmarkEvalBatch reports per-record cost of a 10k-record batch, on one
+// goroutine and on GOMAXPROCS.
+func BenchmarkEvalBatch(b *testing.B) {
+	prog := mustCompile(b, NewEngine(),
+		"user.VIP && amount > 100 && status in ['active', 'trial'] ? amount * 8 / 10 : amount")
+	recs := make([]any, 10_000)
+	for i := range recs {
+		recs[i] = benchData()
+	}
+	for _, par := range []int{1, 0} {
+		name := "serial"
+		if par == 0 {
+			name = "parallel"
+		}
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				_, _ = prog.EvalBatch(context.Background(), recs, WithParallelism(par))
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(recs)), "ns/record")
+		})
+	}
+}
+
+// BenchmarkOptimizer compares a rule with repeated accesses and an equality
+// chain under every optimizer pass and under folding alone.
+func BenchmarkOptimizer(b *testing.B) {
+	const rule = "user.Age > 18 && user.Age < 65 && user.Age != 40 && " +
+		"(status == 'active' || status == 'trial' || status == 'vip')"
+	data := benchData()
+	for _, c := range []struct {
+		name   string
+		passes Optimization
+	}{{"all", OptAll}, {"fold", OptFold}} {
+		e := NewEngine()
+		e.SetOptimizations(c.passes)
+		prog := mustCompile(b, e, rule)
+		b.Run(c.name, func(b *testing.B) {
+			for b.Loop() {
+				_, _ = prog.Eval(data)
+			}
+		})
+	}
+}
+
+// BenchmarkRuleSetIndex evaluates 5,000 rules testing one of 50 countries and
+// a tier, with and without the shared-condition index.
+func BenchmarkRuleSetIndex(b *testing.B) {
+	e := NewEngine()
+	rs := NewRuleSet(AllMatches)
+	for i := range 5000 {
+		src := fmt.Sprintf("country == 'C%d' && tier in ['gold', 'vip'] && amount > %d", i%50, i)
+		_ = rs.Add(Rule{Name: fmt.Sprint(i), When: mustCompile(b, e, src)})
+	}
+	data := map[string]any{"country": "C7", "tier": "gold", "amount": int64(2500)}
+	contextOf := func(p *Program) Context { return p.context(data) }
+	for _, c := range []struct {
+		name string
+		ix   *ruleIndex
+	}{{"indexed", rs.index(rs.rules.Load())}, {"scan", nil}} {
+		b.Run(c.name, func(b *testing.B) {
+			for b.Loop() {
+				_, _ = rs.run(*rs.rules.Load(), c.ix, contextOf)
+			}
+		})
+	}
+}
+
+// --- bytecode VM vs tree-walker -----------------------------------------------------
+// Compile lowers each Program to bytecode; treeWalk strips it so the same
+// Program evaluates by walking its AST, the pre-VM baseline.
+
+func treeWalk(prog *Program) *Program {
+	cp := *prog
+	cp.code = nil
+	return &cp
+}
+
+func BenchmarkVM(b *testing.B) {
+	data := benchData()
+	data["a"], data["b"], data["f"] = int64(3), int64(4), 1.5
+	for _, bc := range []struct{ name, src string }{
+		{"Arithmetic", "a * b + a - b"},
+		{"FloatArithmetic", "f * 2.0 + f / 3.0 - f"},
+		{"ComparisonLogic", "a > 1 && b < 10 && a != b"},
+		{"StructFieldChain", "user.Scores[1] > 80"},
+		{"StringOps", "status == 'active' && status + '!' != 'x'"},
+		{"TypicalRule", "user.VIP && amount > 100 && status in ['active', 'trial'] ? amount * 8 / 10 : amount"},
+		{"MethodCall", "user.Discount() > 10"},
+	} {
+		prog := mustCompile(b, NewEngine(), bc.src)
+		for _, mode := range []struct {
+			name string
+			prog *Program
+		}{{"vm", prog}, {"tree", treeWalk(prog)}} {
+			b.Run(bc.name+"/"+mode.name, func(b *testing.B) {
+				for b.Loop() {
+					_, _ = mode.prog.Eval(data)
+				}
+			})
+		}
+	}
+}
+
 // Guard: the benchmarks above must actually produce the expected values —
 // a benchmark that silently evaluates to an error measures the wrong thing.
 func TestBenchExpressionsAreValid(t *testing.T) {
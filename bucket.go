@@ -0,0 +1,116 @@
+package okra
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+// The bucketing hash is specified so that any service, in any language, can
+// reproduce it: the first 8 bytes, big-endian, of the SHA-256 of the salt's
+// length in bytes (in decimal), a colon, the salt, a colon and the key
+// (`12:new-checkout:42`). The length keeps a colon in the salt from shifting
+// the boundary between salt and key. A key of n buckets is
+// floor(hash × n / 2⁶⁴), so the buckets split the hash range into equal
+// slices, and bucket(k, s, 100) < 20 holds for exactly the keys
+// sample(k, s, 20) selects.
+
+// Bucket returns the bucket of key under salt among n, in [0, n): the same for
+// the same arguments in every process, service and Go version. Rollouts salt
+// with the feature name so features bucket independently; raising a
+// threshold on the bucket only adds keys. It panics if n <= 0.
+//
+// It is the bucket built-in of expressions, for Go code that must agree with
+// them. An integer key there is its decimal form.
+func Bucket(key, salt string, n int) int {
+	if n <= 0 {
+		panic("okra: Bucket with n <= 0")
+	}
+	return int(bucketOf(key, salt, uint64(n)))
+}
+
+// Sample reports whether key falls in the first pct percent of keys under
+// salt, in steps of 0.01 (pct is rounded to the nearest): Bucket(key, salt,
+// 10000) < pct × 100. A pct of 0 or less selects no key, 100 or more every
+// key. It is the sample built-in of expressions.
+func Sample(key, salt string, pct float64) bool {
+	return bucketOf(key, salt, 10000) < basisPoints(pct)
+}
+
+func stableHash(key, salt string) uint64 {
+	sum := sha256.Sum256([]byte(strconv.Itoa(len(salt)) + ":" + salt + ":" + key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func bucketOf(key, salt string, n uint64) uint64 {
+	hi, _ := bits.Mul64(stableHash(key, salt), n)
+	return hi
+}
+
+func basisPoints(pct float64) uint64 {
+	switch {
+	case !(pct > 0): // NaN included
+		return 0
+	case pct >= 100:
+		return 10000
+	}
+	return uint64(math.Round(pct * 100))
+}
+
+// bucketKey renders a key argument: a string as is, an integer in decimal.
+func bucketKey(name string, v any) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	if i, ok := toInt64(v); ok {
+		return strconv.FormatInt(i, 10), nil
+	}
+	return "", fmt.Errorf("%s: key must be a string or an integer, got %T", name, v)
+}
+
+// bucketFunc implements bucket(key, salt) and bucket(key, salt, buckets),
+// with 100 buckets by default.
+func bucketFunc(args []any) (any, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, fmt.Errorf("bucket: expected 2 or 3 args (key, salt[, buckets]), got %d", len(args))
+	}
+	key, err := bucketKey("bucket", args[0])
+	if err != nil {
+		return nil, err
+	}
+	salt, err := asString("bucket", args[1])
+	if err != nil {
+		return nil, err
+	}
+	n := int64(100)
+	if len(args) == 3 {
+		var ok bool
+		if n, ok = toInt64(args[2]); !ok || n <= 0 {
+			return nil, fmt.Errorf("bucket: buckets must be a positive integer, got %v", args[2])
+		}
+	}
+	return int64(bucketOf(key, salt, uint64(n))), nil
+}
+
+// sampleFunc implements sample(key, salt, pct).
+func sampleFunc(args []any) (any, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("sample: expected 3 args (key, salt, pct), got %d", len(args))
+	}
+	key, err := bucketKey("sample", args[0])
+	if err != nil {
+		return nil, err
+	}
+	salt, err := asString("sample", args[1])
+	if err != nil {
+		return nil, err
+	}
+	pct, ok := toNumber(args[2])
+	if !ok {
+		return nil, fmt.Errorf("sample: pct must be a number, got %T", args[2])
+	}
+	return Sample(key, salt, pct), nil
+}
@@ -0,0 +1,100 @@
+package okra
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBucketStable(t *testing.T) {
+	// Computed independently from the documented definition, so a change to
+	// the hash shows up here: Python's
+	//	int.from_bytes(sha256(b'12:new-checkout:42').digest()[:8], 'big') * 100 >> 64
+	cases := []struct {
+		key, salt string
+		n, want   int
+	}{
+		{"42", "new-checkout", 100, 10},
+		{"alice", "new-checkout", 100, 18},
+		{"alice", "dark-mode", 100, 40},
+		{"42", "new-checkout", 10000, 1017},
+		{"", "", 2, 1},
+		// A colon in the salt does not move the boundary with the key.
+		{"c", "a:b", 10000, 7944},
+		{"b:c", "a", 10000, 9645},
+	}
+	for _, c := range cases {
+		if got := Bucket(c.key, c.salt, c.n); got != c.want {
+			t.Errorf("Bucket(%q, %q, %d) = %d, want %d", c.key, c.salt, c.n, got, c.want)
+		}
+	}
+
+	e := NewEngine()
+	data := map[string]any{"user": map[string]any{"ID": 42, "Name": "alice"}}
+	for src, want := range map[string]any{
+		"bucket(user.ID, 'new-checkout')":                            int64(10),
+		"bucket(user.Name, 'dark-mode', 100)":                        int64(40),
+		"bucket(user.ID, 'new-checkout', 10000)":                     int64(1017),
+		"sample(user.ID, 'new-checkout', 10.17)":                     false,
+		"sample(user.ID, 'new-checkout', 10.18)":                     true,
+		"sample(user.ID, 'new-checkout', 100)":                       true,
+		"sample(user.Name, 'new-checkout', 0)":                       false,
+		"bucket('42', 'new-checkout') == bucket(42, 'new-checkout')": true,
+	} {
+		if got, err := e.Eval(src, data); err != nil || got != want {
+			t.Errorf("%s = %v, %v; want %v", src, got, err, want)
+		}
+	}
+}
+
+func TestBucketDistribution(t *testing.T) {
+	const keys = 100_000
+	var counts [10]int
+	for i := range keys {
+		key := fmt.Sprint("user-", i)
+		b := Bucket(key, "rollout", 10)
+		counts[b]++
+		// bucket(k, s, 100) < pct selects exactly the keys sample(k, s, pct)
+		// does, and raising pct only adds keys.
+		pct := float64(i % 101)
+		if in := Bucket(key, "rollout", 100) < int(pct); in != Sample(key, "rollout", pct) {
+			t.Fatalf("%s: bucket and sample disagree at %v%%", key, pct)
+		}
+		if Sample(key, "rollout", pct) && !Sample(key, "rollout", pct+0.5) {
+			t.Fatalf("%s: in at %v%% but not at %v%%", key, pct, pct+0.5)
+		}
+	}
+	for b, n := range counts {
+		if math.Abs(float64(n)-keys/10) > 500 { // about 5 standard deviations
+			t.Errorf("bucket %d holds %d of %d keys", b, n, keys)
+		}
+	}
+	if Sample("k", "s", math.NaN()) || !Sample("k", "s", 250) || Sample("k", "s", -1) {
+		t.Error("sample out of range")
+	}
+}
+
+func TestBucketErrors(t *testing.T) {
+	e := NewEngine()
+	for src, want := range map[string]string{
+		"bucket(1.5, 's')":      "bucket: key must be a string or an integer, got float64",
+		"bucket(1, 2)":          "bucket: expected string, got int64",
+		"bucket(1, 's', 0)":     "bucket: buckets must be a positive integer, got 0",
+		"bucket(1, 's', 2.0)":   "bucket: buckets must be a positive integer, got 2",
+		"bucket(1)":             "bucket: expected 2 or 3 args (key, salt[, buckets]), got 1",
+		"sample(true, 's', 1)":  "sample: key must be a string or an integer, got bool",
+		"sample('k', 's', '1')": "sample: pct must be a number, got string",
+		"sample('k', 's')":      "sample: expected 3 args (key, salt, pct), got 2",
+	} {
+		if _, err := e.Eval(src, nil); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: %v, want %q", src, err, want)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Bucket with n = 0 did not panic")
+		}
+	}()
+	Bucket("k", "s", 0)
+}
@@ -0,0 +1,105 @@
+package okra
+
+import (
+	"container/list"
+	"sync"
+)
+
+// CacheStats reports the activity of an Engine's Program cache (see
+// SetCacheSize).
+type CacheStats struct {
+	// Hits and Misses count Compile (and Engine.Eval) lookups; a failed
+	// compile counts as a miss and is not cached.
+	Hits, Misses uint64
+	// Evictions counts Programs dropped to stay within Capacity.
+	Evictions uint64
+	// Len is the number of cached Programs, Capacity the bound set by
+	// SetCacheSize. Both are 0 when caching is off.
+	Len, Capacity int
+}
+
+// SetCacheSize makes Compile — and so Engine.Eval — keep up to n compiled
+// Programs in a least-recently-used cache keyed by expression text, so
+// services that evaluate user-supplied expressions don't re-parse the same
+// text on every call. Entries are tied to the Engine's configuration: any
+// RegisterFunc, RegisterMacro, or Set* call invalidates them, so a cached
+// Program is always exactly what Compile would build now. Caching is off by
+// default; n <= 0 turns it off. Each call starts an empty cache with fresh
+// statistics. Safe to call concurrently.
+func (e *Engine) SetCacheSize(n int) {
+	if n <= 0 {
+		e.cache.Store(nil)
+		return
+	}
+	e.cache.Store(newProgramCache(n))
+}
+
+// CacheStats returns the current cache statistics.
+func (e *Engine) CacheStats() CacheStats {
+	c := e.cache.Load()
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.stats
+	st.Len, st.Capacity = c.order.Len(), c.size
+	return st
+}
+
+// changed marks a configuration change, invalidating cached Programs.
+func (e *Engine) changed() { e.gen.Add(1) }
+
+type cacheKey struct {
+	src string
+	gen uint64
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	prog *Program
+}
+
+// programCache is a mutex-guarded LRU. Entries of an older generation are
+// never looked up again and age out like any other.
+type programCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // of *cacheEntry, most recently used first
+	items map[cacheKey]*list.Element
+	stats CacheStats
+}
+
+func newProgramCache(size int) *programCache {
+	return &programCache{size: size, order: list.New(), items: map[cacheKey]*list.Element{}}
+}
+
+func (c *programCache) get(key cacheKey) (*Program, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).prog, true
+}
+
+func (c *programCache) add(key cacheKey, prog *Program) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		// Compiled concurrently by another caller; keep the first.
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&cacheEntry{key, prog})
+	for c.order.Len() > c.size {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.items, last.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+}
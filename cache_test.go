@@ -0,0 +1,95 @@
+package okra
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestProgramCache(t *testing.T) {
+	e := NewEngine()
+	e.SetCacheSize(2)
+	p1, _ := e.Compile("a + 1")
+	p2, _ := e.Compile("a + 1")
+	if p1 != p2 {
+		t.Fatal("second Compile of the same text was not served from the cache")
+	}
+	if _, err := e.Eval("a + 1", map[string]any{"a": int64(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Compile("a +"); err == nil {
+		t.Fatal("expected a parse error")
+	}
+	_, _ = e.Compile("b")
+	_, _ = e.Compile("c") // evicts "a + 1", the least recently used
+	if st := e.CacheStats(); st != (CacheStats{Hits: 2, Misses: 4, Evictions: 1, Len: 2, Capacity: 2}) {
+		t.Fatalf("stats = %+v", st)
+	}
+	if p3, _ := e.Compile("a + 1"); p3 == p1 {
+		t.Fatal("evicted Program still served")
+	}
+
+	// Every configuration change invalidates the cache.
+	changes := map[string]func(){
+		"RegisterFunc":       func() { _ = e.RegisterFunc("f", func([]any) (any, error) { return 1, nil }) },
+		"RegisterMacro":      func() { _ = e.RegisterMacro("m", func(Context, []Expr) (any, error) { return 1, nil }) },
+		"SetStrict":          func() { e.SetStrict(false) },
+		"SetMethodFilter":    func() { e.SetMethodFilter(nil) },
+		"SetMaxNestingDepth": func() { e.SetMaxNestingDepth(50) },
+		"SetMaxCost":         func() { e.SetMaxCost(1000) },
+		"SetOptimizations":   func() { e.SetOptimizations(OptAll) },
+	}
+	for name, change := range changes {
+		before, _ := e.Compile("f() + 1")
+		change()
+		after, _ := e.Compile("f() + 1")
+		if before == after {
+			t.Errorf("%s did not invalidate the cache", name)
+		}
+	}
+	// A Program cached before SetStrict(false) would fail; the fresh one is lenient.
+	if v, err := e.Eval("missing", nil); v != nil || err != nil {
+		t.Fatalf("stale strict Program: %v, %v", v, err)
+	}
+
+	e.SetCacheSize(0)
+	if p1, p2 := mustProg(t, e, "x"), mustProg(t, e, "x"); p1 == p2 || e.CacheStats() != (CacheStats{}) {
+		t.Fatal("cache still active after SetCacheSize(0)")
+	}
+}
+
+func mustProg(t *testing.T, e *Engine, src string) *Program {
+	t.Helper()
+	prog, err := e.Compile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prog
+}
+
+func TestProgramCacheConcurrent(t *testing.T) {
+	e := NewEngine()
+	e.SetCacheSize(8)
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				if i%50 == 0 {
+					e.SetStrict(true)
+				}
+				src := fmt.Sprintf("a + %d", (g+i)%12)
+				v, err := e.Eval(src, map[string]any{"a": int64(1)})
+				if err != nil || v != int64(1+(g+i)%12) {
+					t.Errorf("%s: %v, %v", src, v, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if st := e.CacheStats(); st.Len > 8 || st.Hits+st.Misses != 1600 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
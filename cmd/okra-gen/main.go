@@ -0,0 +1,217 @@
+// Command okra-gen compiles okra expressions into Go functions (see
+// okra.GenerateGo), so the highest-volume rules run without an interpreter.
+//
+// Usage:
+//
+//	okra-gen -type [*]import/path.Type [-rules file] [-o file] [-pkg name] [Name=expression ...]
+//
+// Every rule becomes `func Name(data Type) (R, error)` with the semantics of
+// Program.Eval on a default Engine. Rules come from the arguments and from the
+// -rules file, one `Name: expression` per line (blank lines and lines starting
+// with # are skipped). The file is written to -o, or to standard output.
+//
+// Generation needs the Go type itself, not just its name, so okra-gen writes a
+// small program importing the type's package into a temporary directory next
+// to the output and runs it with `go run`; that program calls GenerateGo. It
+// must therefore run inside a module that requires okra.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+type rule struct{ Name, Src string }
+
+func main() {
+	typ := flag.String("type", "", "data type, as import/path.Type or *import/path.Type")
+	rulesFile := flag.String("rules", "", "file of `Name: expression` lines")
+	out := flag.String("o", "", "output file (default standard output)")
+	pkg := flag.String("pkg", "", "package name of the output (default: that of its directory)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: okra-gen -type [*]import/path.Type [-rules file] [-o file] [-pkg name] [Name=expression ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := run(*typ, *rulesFile, *out, *pkg, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "okra-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(typ, rulesFile, out, pkg string, args []string) error {
+	ptr, importPath, typeName, err := parseType(typ)
+	if err != nil {
+		return err
+	}
+	var rules []rule
+	if rulesFile != "" {
+		data, err := os.ReadFile(rulesFile)
+		if err != nil {
+			return err
+		}
+		if rules, err = parseRules(string(data)); err != nil {
+			return fmt.Errorf("%s: %w", rulesFile, err)
+		}
+	}
+	for _, arg := range args {
+		name, src, ok := strings.Cut(arg, "=")
+		if !ok {
+			return fmt.Errorf("argument %q is not Name=expression", arg)
+		}
+		rules = append(rules, rule{strings.TrimSpace(name), strings.TrimSpace(src)})
+	}
+	if len(rules) == 0 {
+		return errors.New("no rules")
+	}
+
+	dir := "."
+	if out != "" {
+		dir = filepath.Dir(out)
+	}
+	name, outPath, err := goList(dir)
+	if err != nil {
+		return err
+	}
+	if pkg == "" {
+		pkg = name
+	}
+	if pkg == "" {
+		return fmt.Errorf("no Go package in %s; name it with -pkg", dir)
+	}
+
+	var prog bytes.Buffer
+	err = driver.Execute(&prog, map[string]any{
+		"Ptr": ptr, "Import": importPath, "Type": typeName,
+		"Package": pkg, "ImportPath": outPath, "Rules": rules,
+	})
+	if err != nil {
+		return err
+	}
+	src, err := goRun(dir, prog.Bytes())
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(out, src, 0o644)
+}
+
+// parseType splits [*]import/path.Type.
+func parseType(s string) (ptr bool, importPath, name string, err error) {
+	ptr = strings.HasPrefix(s, "*")
+	s = strings.TrimPrefix(s, "*")
+	i := strings.LastIndexByte(s, '.')
+	if i <= 0 || i == len(s)-1 || strings.ContainsRune(s[i+1:], '/') {
+		return false, "", "", fmt.Errorf("-type %q is not [*]import/path.Type", s)
+	}
+	return ptr, s[:i], s[i+1:], nil
+}
+
+// parseRules reads `Name: expression` lines.
+func parseRules(text string) ([]rule, error) {
+	var rules []rule
+	sc := bufio.NewScanner(strings.NewReader(text))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, src, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d is not `Name: expression`", n)
+		}
+		rules = append(rules, rule{strings.TrimSpace(name), strings.TrimSpace(src)})
+	}
+	return rules, sc.Err()
+}
+
+// goList returns the package name (empty when dir has no Go files yet) and
+// import path of dir.
+func goList(dir string) (name, importPath string, err error) {
+	cmd := exec.Command("go", "list", "-e", "-f", "{{.Name}} {{.ImportPath}}", ".")
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	b, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("go list: %w", err)
+	}
+	fields := strings.Fields(string(b))
+	switch len(fields) {
+	case 1:
+		return "", fields[0], nil
+	case 2:
+		return fields[0], fields[1], nil
+	}
+	return "", "", fmt.Errorf("go list: unexpected output %q", b)
+}
+
+// goRun runs the program src from a temporary directory inside dir, so it
+// builds in dir's module, and returns its standard output.
+func goRun(dir string, src []byte) ([]byte, error) {
+	tmp, err := os.MkdirTemp(dir, "okra-gen-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.WriteFile(filepath.Join(tmp, "main.go"), src, 0o644); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("go", "run", "./"+filepath.Base(tmp))
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	b, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go run: %w", err)
+	}
+	return b, nil
+}
+
+var driver = template.Must(template.New("driver").Parse(`package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/coolbit/okra"
+	target {{printf "%q" .Import}}
+)
+
+func main() {
+	e := okra.NewEngine()
+	var funcs []okra.GenFunc
+	for _, r := range [][2]string{
+{{- range .Rules}}
+		{ {{- printf "%q" .Name}}, {{printf "%q" .Src -}} },
+{{- end}}
+	} {
+		prog, err := e.Compile(r[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "okra-gen: %s: %v\n", r[0], err)
+			os.Exit(1)
+		}
+		funcs = append(funcs, okra.GenFunc{Name: r[0], Program: prog})
+	}
+	src, err := okra.GenerateGo(okra.GenConfig{
+		Package:    {{printf "%q" .Package}},
+		ImportPath: {{printf "%q" .ImportPath}},
+		DataType:   reflect.TypeFor[{{if .Ptr}}*{{end}}target.{{.Type}}](),
+	}, funcs...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(src)
+}
+`))
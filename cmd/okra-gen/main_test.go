@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseType(t *testing.T) {
+	ptr, imp, name, err := parseType("*example.com/a/b.Order")
+	if err != nil || !ptr || imp != "example.com/a/b" || name != "Order" {
+		t.Fatalf("got %v %q %q %v", ptr, imp, name, err)
+	}
+	for _, bad := range []string{"Order", "example.com/a.", ".Order", "example.com/a.b/c"} {
+		if _, _, _, err := parseType(bad); err == nil {
+			t.Errorf("parseType(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := parseRules("# comment\n\nBig: Amount > 100\n  Cond : a ? b : c\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []rule{{"Big", "Amount > 100"}, {"Cond", "a ? b : c"}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Fatalf("rules = %q, want %q", rules, want)
+	}
+	if _, err := parseRules("Big\n"); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds and runs a program")
+	}
+	// The output directory must be inside the module for the driver to build.
+	dir, err := os.MkdirTemp(".", "testdata-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "rules_gen.go")
+	err = run("*github.com/coolbit/okra/internal/gentest.Order", "", out, "rules",
+		[]string{"Big=Amount > 100", "Label = Name + '!'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"package rules",
+		"func Big(data *gentest.Order) (bool, error) {",
+		"func Label(data *gentest.Order) (string, error) {",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("output lacks %q:\n%s", want, src)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Command okra works with okra rules from the command line.
+//
+// Usage:
+//
+//	okra test [-lenient] [-v] [path ...]
+//
+// okra test runs the rule fixtures (see package ruletest) in the named files,
+// and in the *.test.json files under the named directories, "." by default.
+// Rules named by fixtures are loaded from the fixture's directory, as
+// okra.OpenStore loads it, and compiled with a default Engine, in lenient mode
+// with -lenient. It prints every failure with its differences, and every
+// passing case too with -v, then a summary; it exits with status 1 when a
+// case fails and 2 on a usage error, so it can gate a merge.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/coolbit/okra"
+	"github.com/coolbit/okra/ruletest"
+)
+
+const usage = "usage: okra test [-lenient] [-v] [path ...]"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command line args and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	fs := flag.NewFlagSet("okra test", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	lenient := fs.Bool("lenient", false, "evaluate in lenient mode (see Engine.SetStrict)")
+	verbose := fs.Bool("v", false, "also print the cases that pass")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	e := okra.NewEngine()
+	e.SetStrict(!*lenient)
+	rep, err := (&ruletest.Runner{Engine: e}).RunFiles(paths...)
+	if err != nil {
+		fmt.Fprintln(stderr, "okra:", err)
+		return 2
+	}
+	if rep.Passed+rep.Failed == 0 {
+		fmt.Fprintln(stderr, "okra: no fixtures")
+		return 2
+	}
+	if err := rep.Write(stdout, *verbose); err != nil {
+		fmt.Fprintln(stderr, "okra:", err)
+		return 2
+	}
+	if !rep.OK() {
+		return 1
+	}
+	return 0
+}
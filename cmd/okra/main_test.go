@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunTest(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"big.okra":      "amount > 100",
+		"big.test.json": `{"cases": [{"input": {"amount": 500}, "want": true}, {"name": "missing", "input": {}, "error": "ErrUnknownField"}]}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stdout, stderr strings.Builder
+	if code := run([]string{"test", "-v", dir}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit %d:\n%s%s", code, stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "ok: 2 passed, 0 failed") || !strings.Contains(stdout.String(), "ok   ") {
+		t.Fatalf("output:\n%s", stdout.String())
+	}
+
+	// With -lenient the missing field is nil, not an error.
+	stdout.Reset()
+	if code := run([]string{"test", "-lenient", dir}, &stdout, &stderr); code != 1 {
+		t.Fatalf("exit %d:\n%s", code, stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "big: missing\n") || !strings.Contains(stdout.String(), "FAIL: 1 passed, 1 failed") {
+		t.Fatalf("output:\n%s", stdout.String())
+	}
+
+	for _, args := range [][]string{nil, {"lint"}, {"test", "-nope"}, {"test", filepath.Join(dir, "none")}, {"test", t.TempDir()}} {
+		stderr.Reset()
+		if code := run(args, &stdout, &stderr); code != 2 || stderr.Len() == 0 {
+			t.Errorf("%q: exit %d, stderr %q", args, code, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package okra
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// ErrCostExceeded is returned by Compile when a Program's estimated cost is
+// above the Engine's budget (see SetMaxCost).
+var ErrCostExceeded = errors.New("estimated cost exceeds budget")
+
+// Cost model. The units are abstract "node evaluations"; only their ratios
+// matter, and a budget is tuned against Program.Cost of real rules.
+const (
+	// costNode is the cost of evaluating one node itself: a literal, a
+	// variable, a member access, an operator.
+	costNode int64 = 1
+	// costCall is the default cost of one function or macro call, excluding
+	// its arguments, when it was registered without WithCost.
+	costCall int64 = 1
+	// costReflect is the cost of a method call on data, which goes through
+	// reflection.
+	costReflect int64 = 4
+	// costScan is the assumed length of a collection scanned by `in` when its
+	// size is unknown statically (anything but a list literal).
+	costScan int64 = 16
+)
+
+// FuncOption annotates a function or macro at registration (see RegisterFunc
+// and RegisterMacro).
+type FuncOption func(*funcInfo)
+
+// funcInfo is the static knowledge about a registered function or macro.
+type funcInfo struct {
+	cost  int64 // cost of one call, excluding its arguments
+	iters int64 // macros only: estimated evaluations of each argument
+	pure  bool  // functions only: may be called at compile time (see Pure)
+}
+
+// defaultFuncInfo applies to calls registered without options.
+var defaultFuncInfo = funcInfo{cost: costCall, iters: 1}
+
+// callKey identifies a registered name; a macro and a function may share one
+// (the macro wins at evaluation).
+type callKey struct {
+	name  string
+	macro bool
+}
+
+// WithCost sets the estimated cost of one call, excluding its arguments. Use
+// it for anything markedly more expensive than an operator — a regex match, a
+// lookup in an external table — so Program.Cost and SetMaxCost see it.
+func WithCost(n int64) FuncOption {
+	return func(fi *funcInfo) { fi.cost = max(n, 0) }
+}
+
+// WithIterations sets how many times a macro is expected to evaluate each of
+// its lazy arguments — typically the expected collection size for
+// any/all/filter-style macros. Nested macros multiply. It has no effect on
+// plain functions, whose arguments are evaluated exactly once.
+func WithIterations(n int64) FuncOption {
+	return func(fi *funcInfo) { fi.iters = max(n, 0) }
+}
+
+// Pure declares a function deterministic and free of side effects: its result
+// depends only on its arguments. Compile then folds calls whose arguments are
+// all constants — `lower('ABC')`, `date('2026-01-01')` — into their result,
+// so they are not re-evaluated on every Eval (a call that fails is left to
+// fail at Eval). A function registered without Pure is never called at
+// compile time; re-registering it without the option makes it impure again.
+// Pure has no effect on macros. Every built-in is pure except now.
+func Pure() FuncOption {
+	return func(fi *funcInfo) { fi.pure = true }
+}
+
+// builtinCalls annotates the built-in functions.
+func builtinCalls() map[callKey]funcInfo {
+	calls := map[callKey]funcInfo{}
+	for name := range defaultFuncs() {
+		if name != "now" {
+			calls[callKey{name, false}] = newFuncInfo([]FuncOption{Pure()})
+		}
+	}
+	return calls
+}
+
+// Cost is the static cost estimate of a Program (see Program.Cost).
+type Cost struct {
+	// Total is the estimated worst-case cost of one evaluation.
+	Total int64
+	// Nodes has one entry per AST node, in pre-order (the root first).
+	Nodes []NodeCost
+}
+
+// NodeCost is the estimate for one node of a Program.
+type NodeCost struct {
+	// Expr is the node's canonical form (its String()).
+	Expr string
+	// Self is the node's own cost; Total adds its sub-expressions (multiplied
+	// by a macro's iterations for its arguments).
+	Self, Total int64
+	// Start and End locate the node in the Program's source; both are 0 when
+	// unknown (a folded constant, a hand-built AST).
+	Start, End int
+}
+
+// Cost returns a static, worst-case estimate of what one evaluation costs,
+// without evaluating anything: both sides of && and || are counted, a ternary
+// counts its more expensive branch, calls count their registered cost
+// (WithCost), and macro arguments are multiplied by the macro's iterations
+// (WithIterations). The estimate covers the Program as compiled, after constant
+// folding.
+func (p *Program) Cost() Cost {
+	var c Cost
+	c.Total = p.cost(p.ast, &c.Nodes)
+	return c
+}
+
+// cost appends e's NodeCost (and its descendants') to out and returns e's
+// total.
+func (p *Program) cost(e Expr, out *[]NodeCost) int64 {
+	switch n := e.(type) {
+	case *sharedExpr:
+		// Any occurrence may be the one that evaluates.
+		return p.cost(n.X, out)
+	case *chainExpr:
+		return p.cost(n.Written, out)
+	case *tableInput:
+		return p.cost(n.X, out)
+	}
+	at := len(*out)
+	nc := NodeCost{Expr: e.String(), Self: costNode}
+	if sp, ok := p.spans[e]; ok {
+		nc.Start, nc.End = sp.start, sp.end
+	}
+	*out = append(*out, nc)
+
+	var sub int64
+	switch n := e.(type) {
+	case *UnaryExpr:
+		sub = p.cost(n.Right, out)
+	case *InfixExpr:
+		sub = satAdd(p.cost(n.Left, out), p.cost(n.Right, out))
+		if n.Op == "in" || n.Op == "not in" {
+			nc.Self = satAdd(nc.Self, scanLen(n.Right))
+		}
+	case *TernaryExpr:
+		cond := p.cost(n.Cond, out)
+		sub = satAdd(cond, max(p.cost(n.Then, out), p.cost(n.Else, out)))
+	case *MemberAccessExpr:
+		sub = p.cost(n.Left, out)
+	case *IndexExpr:
+		sub = satAdd(p.cost(n.Left, out), p.cost(n.Index, out))
+	case *MethodCallExpr:
+		nc.Self = costReflect
+		sub = p.cost(n.Left, out)
+		for _, a := range n.Args {
+			sub = satAdd(sub, p.cost(a, out))
+		}
+	case *CallExpr:
+		iters := int64(1)
+		nc.Self = costReflect // data-method fallback, unless registered
+		if fi, ok := p.callInfo(n.key()); ok {
+			nc.Self, iters = fi.cost, fi.iters
+		}
+		for _, a := range n.Args {
+			sub = satAdd(sub, p.cost(a, out))
+		}
+		sub = satMul(sub, iters)
+	case *ListExpr:
+		for _, el := range n.Elems {
+			sub = satAdd(sub, p.cost(el, out))
+		}
+	}
+	nc.Total = satAdd(nc.Self, sub)
+	(*out)[at] = nc
+	return nc.Total
+}
+
+// callInfo resolves a bare call the way CallExpr does — macros first, then
+// functions — and returns its cost annotations.
+func (p *Program) callInfo(name string) (funcInfo, bool) {
+	key := callKey{name, true}
+	if _, ok := p.macros[name]; !ok {
+		if _, ok := p.fns[name]; !ok {
+			return funcInfo{}, false
+		}
+		key.macro = false
+	}
+	if fi, ok := p.calls[key]; ok {
+		return fi, true
+	}
+	return defaultFuncInfo, true
+}
+
+// scanLen estimates how many elements `in` scans in haystack: the length of a
+// (possibly folded or hashed) list literal, otherwise costScan. A hashed list
+// is looked up, not scanned, but its evaluation is charged a step per element
+// all the same.
+func scanLen(haystack Expr) int64 {
+	switch h := haystack.(type) {
+	case *ListExpr:
+		return int64(len(h.Elems))
+	case *LiteralExpr:
+		if set, ok := h.Value.(*valueSet); ok {
+			return int64(len(set.list))
+		}
+		if rv := reflect.ValueOf(h.Value); isSeqKind(rv.Kind()) {
+			return int64(rv.Len())
+		}
+	}
+	return costScan
+}
+
+// newFuncInfo applies registration options over the defaults.
+func newFuncInfo(opts []FuncOption) funcInfo {
+	fi := defaultFuncInfo
+	for _, o := range opts {
+		o(&fi)
+	}
+	return fi
+}
+
+// checkCost enforces the Engine's budget on a freshly compiled Program.
+func (p *Program) checkCost(budget int64) error {
+	if budget <= 0 {
+		return nil
+	}
+	if total := p.Cost().Total; total > budget {
+		return sourceError(KindLimit, p.src, 0, len(p.src),
+			fmt.Errorf("%w: estimated %d, budget %d", ErrCostExceeded, total, budget))
+	}
+	return nil
+}
+
+func satAdd(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+func satMul(a, b int64) int64 {
+	if a != 0 && b > math.MaxInt64/a {
+		return math.MaxInt64
+	}
+	return a * b
+}
@@ -0,0 +1,89 @@
+package okra
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProgramCost(t *testing.T) {
+	e := NewEngine()
+	anyMacro := func(ctx Context, args []Expr) (any, error) { return true, nil }
+	if err := e.RegisterMacro("any", anyMacro, WithCost(2), WithIterations(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.RegisterFunc("matches", func(args []any) (any, error) { return true, nil }, WithCost(50)); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		src  string
+		want int64
+	}{
+		{"1 + 2 * 3", 1},                    // folded to one literal
+		{"user.Age > 18", 4},                // > , member, var, literal
+		{"a && b || c", 5},                  // both sides of && and || count
+		{"ok ? x : user.Name", 1 + 1 + 2},   // cond + the costlier branch
+		{"lower(s)", 2},                     // default function cost
+		{"matches(s, 'x+')", 50 + 2},        // WithCost
+		{"user.Save()", 4 + 1},              // method call through reflection
+		{"x in ['a', 'b', 'c']", 1 + 3 + 2}, // hashed literal list: as its scan
+		{"x in [a, b, c]", 1 + 3 + 1 + 4},   // scan of a list expression
+		{"x in xs", 1 + 16 + 2},             // scan of unknown size
+		{"any(xs, x > 1)", 2 + 100*(1+3)},   // macro args times iterations
+		{"any(a, any(b, ok))", 2 + 100*(1+2+100*(1+1))},
+	}
+	for _, c := range cases {
+		prog, err := e.Compile(c.src)
+		if err != nil {
+			t.Fatalf("%s: %v", c.src, err)
+		}
+		if got := prog.Cost().Total; got != c.want {
+			t.Errorf("%s: cost %d, want %d", c.src, got, c.want)
+		}
+	}
+
+	prog, _ := e.Compile("a && matches(s, 'x')")
+	cost := prog.Cost()
+	if len(cost.Nodes) != 5 || cost.Nodes[0].Total != cost.Total {
+		t.Fatalf("nodes = %+v", cost.Nodes)
+	}
+	if n := cost.Nodes[2]; n.Expr != "matches(s, 'x')" || n.Self != 50 || n.Total != 52 || n.Start != 5 || n.End != 20 {
+		t.Fatalf("call node = %+v", n)
+	}
+}
+
+func TestMaxCost(t *testing.T) {
+	e := NewEngine()
+	if err := e.RegisterFunc("slow", func(args []any) (any, error) { return true, nil }, WithCost(1000)); err != nil {
+		t.Fatal(err)
+	}
+	e.SetMaxCost(100)
+	if _, err := e.Compile("user.Age > 18 && ok"); err != nil {
+		t.Fatalf("cheap rule rejected: %v", err)
+	}
+	_, err := e.Compile("ok && slow()")
+	var oe *Error
+	if !errors.Is(err, ErrCostExceeded) || !errors.As(err, &oe) || oe.Kind != KindLimit || oe.Cause != ErrCostExceeded {
+		t.Fatalf("expected a KindLimit ErrCostExceeded, got %v", err)
+	}
+	if err.Error() != "estimated cost exceeds budget: estimated 1002, budget 100" {
+		t.Fatalf("message = %q", err.Error())
+	}
+
+	// Re-registering without options resets the annotation; Programs already
+	// compiled keep their snapshot.
+	e.SetMaxCost(0)
+	prog, err := e.Compile("slow()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.RegisterFunc("slow", func(args []any) (any, error) { return true, nil }); err != nil {
+		t.Fatal(err)
+	}
+	e.SetMaxCost(100)
+	if _, err := e.Compile("slow()"); err != nil {
+		t.Fatalf("re-registered func still costed: %v", err)
+	}
+	if got := prog.Cost().Total; got != 1000 {
+		t.Fatalf("snapshot cost = %d", got)
+	}
+}
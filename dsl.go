@@ -41,6 +41,9 @@ var (
 	// ErrMethodDenied is returned when a method/getter call is blocked by the
 	// Engine's method filter.
 	ErrMethodDenied = errors.New("method not permitted")
+	// ErrCycle is returned when defining a Registry rule would make rules
+	// depend on themselves.
+	ErrCycle = errors.New("dependency cycle")
 )
 
 // -----------------------------------------------------------------------------
@@ -75,6 +78,16 @@ type Context struct {
 	// inherit them, so userland collection loops stay cancellable too.
 	ctx   context.Context
 	steps *uint64
+	// memo holds the values of the Program's shared sub-expressions for the
+	// current evaluation (see OptCSE); nil disables sharing. getters counts
+	// the getters called meanwhile: a value read through one is not shared.
+	memo    []memoSlot
+	getters *uint64
+	// rules resolves the names of a Registry's rules, ahead of the data, for
+	// the evaluation of one of them; nil elsewhere.
+	rules *ruleScope
+	// table holds the column inputs of a Table evaluation; nil elsewhere.
+	table *tableScope
 }
 
 // step counts one unit of evaluation work and periodically checks whether the
@@ -90,6 +103,23 @@ func (c Context) step() error {
 	return nil
 }
 
+// stepN charges n steps at once, polling ctx if a multiple of 1024 was
+// crossed — equivalent to n consecutive step calls with nothing in between.
+func (c Context) stepN(n uint32) error {
+	if c.steps == nil {
+		return nil
+	}
+	before := *c.steps
+	*c.steps += uint64(n)
+	if before>>10 != *c.steps>>10 {
+		return c.ctx.Err()
+	}
+	return nil
+}
+
+// cancelled reports whether an EvalContext evaluation has been cancelled.
+func (c Context) cancelled() bool { return c.steps != nil && c.ctx.Err() != nil }
+
 // methodAllowed reports whether calling the named method/getter is permitted.
 func (c Context) methodAllowed(name string) bool {
 	return c.MethodFilter == nil || c.MethodFilter(name)
@@ -105,6 +135,17 @@ func (c Context) miss(format string, args ...any) (any, error) {
 	return nil, nil
 }
 
+// missNear is miss for a failed name lookup: in strict mode the error also
+// suggests the candidates closest to name ("did you mean"). candidates is only
+// called on that failure path, so a lenient miss stays free.
+func (c Context) missNear(name string, candidates func() []string, format string, args ...any) (any, error) {
+	if !c.Strict {
+		return nil, nil
+	}
+	_, err := c.miss(format, args...)
+	return nil, withSuggestions(err, name, candidates())
+}
+
 func evalBitwise(lv, rv any, op string) (any, error) {
 	li, okL := toInt64(lv)
 	ri, okR := toInt64(rv)
@@ -252,6 +293,11 @@ func renderLiteral(v any) string {
 			parts[i] = renderLiteral(el)
 		}
 		return "[" + strings.Join(parts, ", ") + "]"
+	case *valueSet:
+		return renderLiteral(x.list)
+	case time.Time:
+		// A folded date(...) call prints as one, so String() stays parseable.
+		return "date(" + renderLiteral(x.Format(time.RFC3339Nano)) + ")"
 	default:
 		return fmt.Sprint(v)
 	}
@@ -287,7 +333,16 @@ func (e *VariableExpr) Eval(ctx Context) (any, error) {
 	if err := ctx.step(); err != nil {
 		return nil, err
 	}
-	return getMember(ctx, ctx.Data, e.Name)
+	if ctx.rules != nil {
+		if v, ok, err := ctx.rules.get(e.Name); ok {
+			return v, err
+		}
+	}
+	v, err := getMember(ctx, ctx.Data, e.Name)
+	if err != nil {
+		return nil, opErr(e, err)
+	}
+	return v, nil
 }
 func (e *VariableExpr) String() string { return e.Name }
 
@@ -305,9 +360,14 @@ func (e *MemberAccessExpr) Eval(ctx Context) (any, error) {
 		return nil, err
 	}
 	if val == nil {
-		return ctx.miss("cannot access %q on nil", e.Key)
+		_, err := ctx.miss("cannot access %q on nil", e.Key)
+		return nil, opErr(e, err)
 	}
-	return getMember(ctx, val, e.Key)
+	v, err := getMember(ctx, val, e.Key)
+	if err != nil {
+		return nil, opErr(e, err)
+	}
+	return v, nil
 }
 func (e *MemberAccessExpr) String() string {
 	return fmt.Sprintf("%s.%s", e.Left.String(), e.Key)
@@ -327,13 +387,23 @@ func (e *IndexExpr) Eval(ctx Context) (any, error) {
 		return nil, err
 	}
 	if obj == nil {
-		return ctx.miss("cannot index nil")
+		_, err := ctx.miss("cannot index nil")
+		return nil, opErr(e, err)
 	}
 	idx, err := e.Index.Eval(ctx)
 	if err != nil {
 		return nil, err
 	}
+	v, err := indexValue(ctx, obj, idx)
+	if err != nil {
+		return nil, opErr(e, err)
+	}
+	return v, nil
+}
 
+// indexValue implements obj[idx] for slices, arrays and maps (through any
+// number of pointers), with the usual strict-mode miss handling.
+func indexValue(ctx Context, obj, idx any) (any, error) {
 	rv := reflect.ValueOf(obj)
 	for rv.Kind() == reflect.Pointer {
 		if rv.IsNil() {
@@ -386,6 +456,9 @@ func (e *IndexExpr) Eval(ctx Context) (any, error) {
 		}
 		res := rv.MapIndex(kv)
 		if !res.IsValid() {
+			if s, ok := idx.(string); ok {
+				return ctx.missNear(s, func() []string { return mapKeyCandidates(rv) }, "map has no key %q", s)
+			}
 			return ctx.miss("map has no key %v", idx)
 		}
 		return res.Interface(), nil
@@ -412,25 +485,18 @@ func (e *MethodCallExpr) Eval(ctx Context) (any, error) {
 		return nil, err
 	}
 	if obj == nil {
-		return ctx.miss("cannot call %q on nil", e.Method)
+		_, err := ctx.miss("cannot call %q on nil", e.Method)
+		return nil, opErr(e, err)
 	}
 
 	if e.Method == "len" && len(e.Args) == 0 {
-		rv := reflect.ValueOf(obj)
-		for rv.Kind() == reflect.Pointer {
-			if rv.IsNil() {
-				return int64(0), nil
-			}
-			rv = rv.Elem()
-		}
-		k := rv.Kind()
-		if k == reflect.Slice || k == reflect.Array || k == reflect.Map || k == reflect.String {
-			return int64(rv.Len()), nil
+		if n, ok := lenShortcut(obj); ok {
+			return n, nil
 		}
 	}
 
 	if !ctx.methodAllowed(e.Method) {
-		return nil, fmt.Errorf("%q: %w", e.Method, ErrMethodDenied)
+		return nil, opErr(e, fmt.Errorf("%q: %w", e.Method, ErrMethodDenied))
 	}
 
 	args := make([]any, len(e.Args))
@@ -441,7 +507,38 @@ func (e *MethodCallExpr) Eval(ctx Context) (any, error) {
 		}
 		args[i] = v
 	}
-	return callReflectMethod(obj, e.Method, args)
+	v, err := callReflectMethod(obj, e.Method, args)
+	if err != nil {
+		return nil, opErr(e, methodCallErr(ctx, obj, e.Method, err))
+	}
+	return v, nil
+}
+
+// lenShortcut implements x.len() for sized values (through any number of
+// pointers; a nil pointer has length 0). It reports false for anything else,
+// which then goes through the ordinary method lookup.
+func lenShortcut(obj any) (any, bool) {
+	rv := reflect.ValueOf(obj)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return int64(0), true
+		}
+		rv = rv.Elem()
+	}
+	k := rv.Kind()
+	if k == reflect.Slice || k == reflect.Array || k == reflect.Map || k == reflect.String {
+		return int64(rv.Len()), true
+	}
+	return nil, false
+}
+
+// methodCallErr decorates a failed method call on obj with "did you mean"
+// suggestions when the method does not exist at all.
+func methodCallErr(ctx Context, obj any, name string, err error) error {
+	if errors.Is(err, ErrNotFound) && !hasMethod(obj, name) {
+		return withSuggestions(err, name, methodCandidates(ctx, obj))
+	}
+	return err
 }
 func (e *MethodCallExpr) String() string {
 	var args []string
@@ -478,7 +575,11 @@ func (e *CallExpr) Eval(ctx Context) (any, error) {
 	// before any argument is touched. This is what lets a userland any/all/filter
 	// re-evaluate a predicate expression per collection element.
 	if m, ok := ctx.Macros[name]; ok {
-		return m(ctx, e.Args)
+		v, err := m(ctx, e.Args)
+		if err != nil {
+			return nil, opErr(e, err)
+		}
+		return v, nil
 	}
 
 	// 1. Try to find a global function first
@@ -492,7 +593,11 @@ func (e *CallExpr) Eval(ctx Context) (any, error) {
 			}
 			args[i] = v
 		}
-		return fn(args)
+		v, err := fn(args)
+		if err != nil {
+			return nil, opErr(e, err)
+		}
+		return v, nil
 	}
 
 	// 2. FALLBACK: Try to find the method on the root Data object. Only fall
@@ -500,7 +605,7 @@ func (e *CallExpr) Eval(ctx Context) (any, error) {
 	// exists but fails, surface that real error instead of masking it.
 	if ctx.Data != nil && hasMethod(ctx.Data, e.Name) {
 		if !ctx.methodAllowed(e.Name) {
-			return nil, fmt.Errorf("%q: %w", e.Name, ErrMethodDenied)
+			return nil, opErr(e, fmt.Errorf("%q: %w", e.Name, ErrMethodDenied))
 		}
 		args := make([]any, len(e.Args))
 		for i, argExpr := range e.Args {
@@ -510,10 +615,14 @@ func (e *CallExpr) Eval(ctx Context) (any, error) {
 			}
 			args[i] = v
 		}
-		return callReflectMethod(ctx.Data, e.Name, args)
+		v, err := callReflectMethod(ctx.Data, e.Name, args)
+		if err != nil {
+			return nil, opErr(e, err)
+		}
+		return v, nil
 	}
 
-	return nil, fmt.Errorf("%q: %w", e.Name, ErrNotFound)
+	return nil, opErr(e, withSuggestions(fmt.Errorf("%q: %w", e.Name, ErrNotFound), e.Name, callCandidates(ctx)))
 }
 
 func (e *CallExpr) String() string {
@@ -537,28 +646,37 @@ func (e *UnaryExpr) Eval(ctx Context) (any, error) {
 	if err != nil {
 		return nil, err
 	}
+	v, err := e.apply(rv)
+	if err != nil {
+		return nil, opErr(e, err)
+	}
+	return v, nil
+}
+
+// apply computes the operator on an already-evaluated operand.
+func (e *UnaryExpr) apply(rv any) (any, error) {
 	switch e.Op {
 	case "!":
 		b, err := asBool(rv)
 		if err != nil {
-			return nil, opErr(e, err)
+			return nil, err
 		}
 		return !b, nil
 	case "-":
 		if i, ok := toInt64(rv); ok {
 			if i == math.MinInt64 {
-				return nil, opErr(e, ErrIntOverflow)
+				return nil, ErrIntOverflow
 			}
 			return -i, nil
 		}
 		if f, ok := toNumber(rv); ok {
 			return -f, nil
 		}
-		return nil, opErr(e, fmt.Errorf("invalid unary - for %T", rv))
+		return nil, fmt.Errorf("invalid unary - for %T", rv)
 	case "~":
 		i, ok := toInt64(rv)
 		if !ok {
-			return nil, opErr(e, fmt.Errorf("invalid unary ~ for %T", rv))
+			return nil, fmt.Errorf("invalid unary ~ for %T", rv)
 		}
 		return ^i, nil
 	default:
@@ -580,13 +698,23 @@ type InfixExpr struct {
 // failure inside a long rule points at the sub-expression that produced it
 // (e.g. `(user.Age > user.Name): invalid comparison ...`). Errors propagated
 // from child nodes are NOT re-wrapped — they were annotated at their
-// birthplace — so a deep failure carries exactly one location. Wrapping uses
-// %w, so errors.Is on the sentinel errors keeps working.
+// birthplace — so a deep failure carries exactly one location. The result is
+// an *Error remembering the node, which Program.Eval turns into a line/column
+// position; Unwrap keeps errors.Is on the sentinel errors working.
 func opErr(e Expr, err error) error {
 	if err == nil {
 		return nil
 	}
-	return fmt.Errorf("%s: %w", e.String(), err)
+	var oe *Error
+	if errors.As(err, &oe) {
+		return err // already annotated (e.g. by a macro's argument evaluation)
+	}
+	oe = &Error{Kind: KindEval, Expr: e.String(), Cause: sentinelOf(err), Err: err, node: e}
+	var h *hintError
+	if errors.As(err, &h) {
+		oe.Suggestions = h.suggestions
+	}
+	return oe
 }
 
 func (e *InfixExpr) Eval(ctx Context) (any, error) {
@@ -768,11 +896,18 @@ func isStringVal(v any) bool {
 // elements or map keys, and substring for strings. It never panics. Using nil
 // as the container is an error (nil-on-use), never a silent false. Every
 // element scanned counts a cancellation step, so `in` over a huge collection
-// stays responsive to EvalContext.
+// stays responsive to EvalContext; a literal list indexed as a set charges a
+// step per element too, as a scan that misses would.
 func evalIn(ctx Context, needle, haystack any) (any, error) {
 	if haystack == nil {
 		return nil, errors.New("invalid 'in': container is nil")
 	}
+	if set, ok := haystack.(*valueSet); ok {
+		if err := ctx.stepN(uint32(len(set.list))); err != nil {
+			return nil, err
+		}
+		return set.has(needle), nil
+	}
 	if hs, ok := haystack.(string); ok {
 		sub, ok := needle.(string)
 		if !ok {
@@ -892,6 +1027,21 @@ func (e *InfixExpr) String() string {
 	return fmt.Sprintf("(%s %s %s)", e.Left.String(), e.Op, e.Right.String())
 }
 
+// BadExpr stands in for a malformed region of the partial AST returned by
+// ParseAll. Evaluating it fails with the syntax error it records.
+type BadExpr struct {
+	Src string // the source text of the malformed region
+	Err *Error // the diagnostic reported for it
+}
+
+func (e *BadExpr) Eval(ctx Context) (any, error) { return nil, e.Err }
+func (e *BadExpr) String() string {
+	if e.Src == "" {
+		return "<bad>"
+	}
+	return e.Src
+}
+
 type TernaryExpr struct {
 	Cond Expr
 	Then Expr
@@ -935,7 +1085,7 @@ func getMember(ctx Context, obj any, key string) (any, error) {
 		if v, found := m[key]; found {
 			return v, nil
 		}
-		return ctx.miss("map has no key %q", key)
+		return ctx.missNear(key, func() []string { return mapKeyCandidates(reflect.ValueOf(m)) }, "map has no key %q", key)
 	}
 	rv := reflect.ValueOf(obj)
 	for rv.Kind() == reflect.Pointer {
@@ -956,7 +1106,7 @@ func getMember(ctx Context, obj any, key string) (any, error) {
 		}
 		res := rv.MapIndex(kv)
 		if !res.IsValid() {
-			return ctx.miss("map has no key %q", key)
+			return ctx.missNear(key, func() []string { return mapKeyCandidates(rv) }, "map has no key %q", key)
 		}
 		return res.Interface(), nil
 	case reflect.Slice, reflect.Array:
@@ -987,10 +1137,13 @@ func getMember(ctx Context, obj any, key string) (any, error) {
 				// Getter-style access shares the invocation tail with explicit
 				// calls, so a trailing error return (or a panic) surfaces instead
 				// of being silently discarded.
+				if ctx.getters != nil {
+					*ctx.getters++
+				}
 				return invokeMethod(m, nil, key)
 			}
 		}
-		return ctx.miss("unknown field %q on %s", key, rv.Type())
+		return ctx.missNear(key, func() []string { return structCandidates(ctx, meta) }, "unknown field %q on %s", key, rv.Type())
 	}
 	return ctx.miss("cannot access %q on %T", key, obj)
 }
@@ -1095,7 +1248,7 @@ func callReflectMethod(obj any, name string, args []any) (any, error) {
 		}
 	}
 	if !mv.IsValid() {
-		return nil, fmt.Errorf("method %s not found on %T", name, obj)
+		return nil, fmt.Errorf("method %q on %T: %w", name, obj, ErrNotFound)
 	}
 
 	mType := mv.Type()
@@ -1272,48 +1425,57 @@ func invokeMethod(mv reflect.Value, in []reflect.Value, name string) (any, error
 	return out[0].Interface(), nil
 }
 
+// intMath is integer + - * / %. Checked arithmetic: overflow is an error
+// (ErrIntOverflow), never a silent two's-complement wrap. Rule values are
+// amounts, counts, and timestamps — a wrapped result is always a wrong answer.
+func intMath(li, ri int64, op rune) (int64, error) {
+	switch op {
+	case '+':
+		if (ri > 0 && li > math.MaxInt64-ri) || (ri < 0 && li < math.MinInt64-ri) {
+			return 0, ErrIntOverflow
+		}
+		return li + ri, nil
+	case '-':
+		if (ri < 0 && li > math.MaxInt64+ri) || (ri > 0 && li < math.MinInt64+ri) {
+			return 0, ErrIntOverflow
+		}
+		return li - ri, nil
+	case '*':
+		if li != 0 && ri != 0 {
+			if (li == math.MinInt64 && ri == -1) || (ri == math.MinInt64 && li == -1) {
+				return 0, ErrIntOverflow
+			}
+			if r := li * ri; r/ri != li {
+				return 0, ErrIntOverflow
+			}
+		}
+		return li * ri, nil
+	case '/':
+		if ri == 0 {
+			return 0, ErrDivByZero
+		}
+		if li == math.MinInt64 && ri == -1 {
+			return 0, ErrIntOverflow
+		}
+		return li / ri, nil
+	case '%':
+		if ri == 0 {
+			return 0, ErrModByZero
+		}
+		return li % ri, nil
+	}
+	return 0, fmt.Errorf("unknown arithmetic operator %c", op)
+}
+
 func evalMath(lv, rv any, op rune) (any, error) {
 	li, okL := toInt64(lv)
 	ri, okR := toInt64(rv)
-	if okL && okR {
-		// Checked arithmetic: overflow is an error (ErrIntOverflow), never a
-		// silent two's-complement wrap. Rule values are amounts, counts, and
-		// timestamps — a wrapped result is always a wrong answer.
-		switch op {
-		case '+':
-			if (ri > 0 && li > math.MaxInt64-ri) || (ri < 0 && li < math.MinInt64-ri) {
-				return nil, ErrIntOverflow
-			}
-			return li + ri, nil
-		case '-':
-			if (ri < 0 && li > math.MaxInt64+ri) || (ri > 0 && li < math.MinInt64+ri) {
-				return nil, ErrIntOverflow
-			}
-			return li - ri, nil
-		case '*':
-			if li != 0 && ri != 0 {
-				if (li == math.MinInt64 && ri == -1) || (ri == math.MinInt64 && li == -1) {
-					return nil, ErrIntOverflow
-				}
-				if r := li * ri; r/ri != li {
-					return nil, ErrIntOverflow
-				}
-			}
-			return li * ri, nil
-		case '/':
-			if ri == 0 {
-				return nil, ErrDivByZero
-			}
-			if li == math.MinInt64 && ri == -1 {
-				return nil, ErrIntOverflow
-			}
-			return li / ri, nil
-		case '%':
-			if ri == 0 {
-				return nil, ErrModByZero
-			}
-			return li % ri, nil
+	if okL && okR && strings.ContainsRune("+-*/%", op) {
+		v, err := intMath(li, ri, op)
+		if err != nil {
+			return nil, err
 		}
+		return v, nil
 	}
 	lf, okL := toNumber(lv)
 	rf, okR := toNumber(rv)
@@ -1431,7 +1593,8 @@ const (
 type token struct {
 	typ tokType
 	val string
-	pos int
+	pos int // byte offset of the first character
+	end int // byte offset just past the last character
 }
 
 type lexer struct {
@@ -1453,7 +1616,7 @@ func (l *lexer) lexNumber(start int) token {
 		for l.pos < len(l.s) && (isHexDigit(l.s[l.pos]) || l.s[l.pos] == '_') {
 			l.pos++
 		}
-		return token{tNumber, l.s[start:l.pos], start}
+		return token{tNumber, l.s[start:l.pos], start, l.pos}
 	}
 	l.pos = start
 	for l.pos < len(l.s) {
@@ -1471,7 +1634,7 @@ func (l *lexer) lexNumber(start int) token {
 		}
 		break
 	}
-	return token{tNumber, l.s[start:l.pos], start}
+	return token{tNumber, l.s[start:l.pos], start, l.pos}
 }
 
 // lexString reads a quoted string beginning just after the opening quote q.
@@ -1481,7 +1644,7 @@ func (l *lexer) lexString(q byte, start int) (token, error) {
 		curr := l.s[l.pos]
 		if curr == q {
 			l.pos++
-			return token{tString, sb.String(), start}, nil
+			return token{tString, sb.String(), start, l.pos}, nil
 		}
 		if curr == '\\' {
 			if l.pos+1 < len(l.s) && l.s[l.pos+1] == q {
@@ -1491,7 +1654,8 @@ func (l *lexer) lexString(q byte, start int) (token, error) {
 			}
 			val, _, tail, err := strconv.UnquoteChar(l.s[l.pos:], q)
 			if err != nil {
-				return token{}, err
+				return token{}, sourceError(KindSyntax, l.s, l.pos, min(l.pos+2, len(l.s)),
+					fmt.Errorf("invalid escape in string at position %d: %w", l.pos, err))
 			}
 			consumed := len(l.s[l.pos:]) - len(tail)
 			l.pos += consumed
@@ -1501,7 +1665,7 @@ func (l *lexer) lexString(q byte, start int) (token, error) {
 		l.pos++
 		sb.WriteByte(curr)
 	}
-	return token{}, errors.New("unterminated string")
+	return token{}, sourceError(KindSyntax, l.s, start, l.pos, errors.New("unterminated string"))
 }
 
 func (l *lexer) nextToken() (token, error) {
@@ -1514,7 +1678,7 @@ func (l *lexer) nextToken() (token, error) {
 		l.pos += size
 	}
 	if l.pos >= len(l.s) {
-		return token{tEOF, "", l.pos}, nil
+		return token{tEOF, "", l.pos, l.pos}, nil
 	}
 	start := l.pos
 	r, size := utf8.DecodeRuneInString(l.s[l.pos:])
@@ -1532,7 +1696,7 @@ func (l *lexer) nextToken() (token, error) {
 			}
 			break
 		}
-		return token{tIdent, l.s[start:l.pos], start}, nil
+		return token{tIdent, l.s[start:l.pos], start, l.pos}, nil
 	case r == '"' || r == '\'':
 		l.pos += size // consume the opening quote (ASCII)
 		return l.lexString(byte(r), start)
@@ -1542,26 +1706,26 @@ func (l *lexer) nextToken() (token, error) {
 	l.pos += size
 	switch r {
 	case '[':
-		return token{tOp, "[", start}, nil
+		return token{tOp, "[", start, l.pos}, nil
 	case ']':
-		return token{tOp, "]", start}, nil
+		return token{tOp, "]", start, l.pos}, nil
 	case '(':
-		return token{tLParen, "(", start}, nil
+		return token{tLParen, "(", start, l.pos}, nil
 	case ')':
-		return token{tRParen, ")", start}, nil
+		return token{tRParen, ")", start, l.pos}, nil
 	case ',':
-		return token{tComma, ",", start}, nil
+		return token{tComma, ",", start, l.pos}, nil
 	case '.':
-		return token{tOp, ".", start}, nil
+		return token{tOp, ".", start, l.pos}, nil
 	}
 	ops := []string{"==", "!=", "<=", ">=", "&&", "||", "<<", ">>"}
 	for _, op := range ops {
 		if strings.HasPrefix(l.s[start:], op) {
 			l.pos = start + len(op)
-			return token{tOp, op, start}, nil
+			return token{tOp, op, start, l.pos}, nil
 		}
 	}
-	return token{tOp, string(r), start}, nil
+	return token{tOp, string(r), start, l.pos}, nil
 }
 
 type parser struct {
@@ -1570,6 +1734,17 @@ type parser struct {
 	next     token
 	lexErr   error
 	maxDepth int
+	// prevEnd is the end offset of the last consumed token, i.e. where the
+	// node being built currently ends.
+	prevEnd int
+	// spans, when non-nil, records the source range of every node built.
+	spans map[Expr]span
+	// recovering switches the parser into ParseAll's error-recovery mode:
+	// instead of stopping at the first problem it records a diagnostic in
+	// diags, resynchronizes, and carries on with a BadExpr placeholder.
+	recovering  bool
+	diags       []*Error
+	lexReported bool
 }
 
 // newParser builds a parser over s with the given nesting limit. A non-positive
@@ -1585,15 +1760,16 @@ func newParser(s string, maxDepth int) *parser {
 }
 
 func (p *parser) advance() {
+	p.prevEnd = p.curr.end
 	p.curr = p.next
 	if p.lexErr != nil {
-		p.next = token{tEOF, "", p.lex.pos}
+		p.next = token{tEOF, "", p.lex.pos, p.lex.pos}
 		return
 	}
 	n, err := p.lex.nextToken()
 	if err != nil {
 		p.lexErr = err
-		p.next = token{tEOF, "", p.lex.pos}
+		p.next = token{tEOF, "", p.lex.pos, p.lex.pos}
 		return
 	}
 	p.next = n
@@ -1601,20 +1777,27 @@ func (p *parser) advance() {
 
 func (p *parser) parse(rbp int, depth int) (Expr, error) {
 	if depth > p.maxDepth {
-		return nil, fmt.Errorf("expression nesting too deep (max %d)", p.maxDepth)
+		return p.bad(sourceError(KindLimit, p.lex.s, p.curr.pos, p.curr.end,
+			fmt.Errorf("expression nesting too deep (max %d)", p.maxDepth)))
 	}
 	if p.lexErr != nil {
-		return nil, p.lexErr
+		return p.bad(p.lexErr)
+	}
+	if p.recovering && p.atSync() {
+		// Leave the separator for the enclosing list/call/group to consume.
+		return p.bad(p.unexpected(p.curr))
 	}
 	t := p.curr
+	start := t.pos
 	p.advance()
 	if p.lexErr != nil {
-		return nil, p.lexErr
+		return p.bad(p.lexErr)
 	}
 	left, err := p.nud(t, depth)
 	if err != nil {
 		return nil, err
 	}
+	p.mark(left, start)
 	for rbp < p.curLbp() {
 		t = p.curr
 		p.advance()
@@ -1625,10 +1808,94 @@ func (p *parser) parse(rbp int, depth int) (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
+		p.mark(left, start)
 	}
 	return left, nil
 }
 
+// report handles a syntax error according to the parser's mode: it returns
+// err unchanged normally, and in recovering mode records it (once per
+// position) and returns nil so parsing can continue.
+func (p *parser) report(err error) error {
+	if !p.recovering {
+		return err
+	}
+	oe, ok := err.(*Error)
+	if !ok {
+		oe = sourceError(KindSyntax, p.lex.s, p.curr.pos, p.curr.end, err)
+	}
+	if oe == p.lexErr {
+		if p.lexReported {
+			return nil
+		}
+		p.lexReported = true
+	}
+	if n := len(p.diags); n == 0 || p.diags[n-1].Start != oe.Start {
+		p.diags = append(p.diags, oe)
+	}
+	return nil
+}
+
+// bad fails the current construct: normally with err, and in recovering mode
+// by recording err, skipping to the next synchronization point, and standing
+// in a BadExpr for the malformed region.
+func (p *parser) bad(err error) (Expr, error) {
+	if err := p.report(err); err != nil {
+		return nil, err
+	}
+	start := p.diags[len(p.diags)-1].Start
+	if oe, ok := err.(*Error); ok {
+		start = oe.Start
+	}
+	p.sync()
+	end := max(start, p.prevEnd)
+	return &BadExpr{Src: p.lex.s[start:end], Err: p.diags[len(p.diags)-1]}, nil
+}
+
+// atSync reports whether the current token is a synchronization point: a
+// separator or closer that an enclosing construct knows how to resume at.
+func (p *parser) atSync() bool {
+	switch p.curr.typ {
+	case tEOF, tComma, tRParen:
+		return true
+	case tOp:
+		return p.curr.val == "]"
+	}
+	return false
+}
+
+// sync skips tokens up to (not including) the next synchronization point.
+func (p *parser) sync() {
+	for !p.atSync() {
+		p.advance()
+	}
+}
+
+// mark records that e spans from start to the end of the last consumed token.
+// The first (tightest) span wins, so a parenthesized node keeps the range of
+// its contents.
+func (p *parser) mark(e Expr, start int) {
+	if p.spans == nil {
+		return
+	}
+	if _, ok := p.spans[e]; !ok {
+		p.spans[e] = span{start, p.prevEnd}
+	}
+}
+
+// unexpected reports a token that cannot start or continue an expression.
+func (p *parser) unexpected(t token) error {
+	if t.typ == tEOF {
+		return p.errorf(t, "unexpected end of expression")
+	}
+	return p.errorf(t, "unexpected token %s", t.val)
+}
+
+// errorf reports a syntax error at the token t.
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return sourceError(KindSyntax, p.lex.s, t.pos, t.end, fmt.Errorf(format, args...))
+}
+
 // curLbp is the binding power of the current token, treating the two-word
 // `not in` operator (curr == "not", next == "in") as a single infix operator.
 func (p *parser) curLbp() int {
@@ -1666,7 +1933,16 @@ func parseNumber(raw string) (Expr, error) {
 func (p *parser) nud(t token, depth int) (Expr, error) {
 	switch t.typ {
 	case tNumber:
-		return parseNumber(t.val)
+		e, err := parseNumber(t.val)
+		if err != nil {
+			// The token itself is consumed whole, so there is nothing to skip.
+			oe := sourceError(KindSyntax, p.lex.s, t.pos, t.end, err)
+			if err := p.report(oe); err != nil {
+				return nil, err
+			}
+			return &BadExpr{Src: t.val, Err: oe}, nil
+		}
+		return e, nil
 	case tString:
 		return &LiteralExpr{t.val}, nil
 	case tIdent:
@@ -1691,7 +1967,13 @@ func (p *parser) nud(t token, depth int) (Expr, error) {
 			return nil, err
 		}
 		if p.curr.typ != tRParen {
-			return nil, fmt.Errorf("missing ) at position %d", p.curr.pos)
+			if err := p.report(p.errorf(p.curr, "missing ) at position %d", p.curr.pos)); err != nil {
+				return nil, err
+			}
+			p.sync()
+			if p.curr.typ != tRParen {
+				return e, nil
+			}
 		}
 		p.advance()
 		return e, nil
@@ -1708,8 +1990,12 @@ func (p *parser) nud(t token, depth int) (Expr, error) {
 			var elems []Expr
 			for p.curr.typ != tOp || p.curr.val != "]" {
 				if p.curr.typ == tEOF {
-					return nil, errors.New("missing ] in list literal")
+					if err := p.report(p.errorf(p.curr, "missing ] in list literal")); err != nil {
+						return nil, err
+					}
+					return &ListExpr{Elems: elems}, nil
 				}
+				before := p.curr.pos
 				el, err := p.parse(0, depth+1)
 				if err != nil {
 					return nil, err
@@ -1717,15 +2003,20 @@ func (p *parser) nud(t token, depth int) (Expr, error) {
 				elems = append(elems, el)
 				if p.curr.typ == tComma {
 					p.advance()
+				} else if p.curr.pos == before {
+					// Recovery stopped at a stray closer (e.g. `)`) it cannot
+					// consume; the list ends here.
+					_ = p.report(p.errorf(p.curr, "missing ] in list literal"))
+					return &ListExpr{Elems: elems}, nil
 				}
 			}
 			p.advance() // consume ]
 			return &ListExpr{Elems: elems}, nil
 		default:
-			return nil, fmt.Errorf("unexpected token %s", t.val)
+			return p.bad(p.unexpected(t))
 		}
 	default:
-		return nil, fmt.Errorf("unexpected token %s", t.val)
+		return p.bad(p.unexpected(t))
 	}
 }
 
@@ -1733,7 +2024,7 @@ func (p *parser) led(t token, left Expr, depth int) (Expr, error) {
 	// Two-word `not in` operator: t is "not" and curr is "in".
 	if t.typ == tIdent && t.val == "not" {
 		if p.curr.typ != tIdent || p.curr.val != "in" {
-			return nil, fmt.Errorf("expected 'in' after 'not' at position %d", p.curr.pos)
+			return p.bad(p.errorf(p.curr, "expected 'in' after 'not' at position %d", p.curr.pos))
 		}
 		p.advance() // consume "in"
 		right, err := p.parse(lbpIn, depth+1)
@@ -1748,7 +2039,11 @@ func (p *parser) led(t token, left Expr, depth int) (Expr, error) {
 			return nil, err
 		}
 		if p.curr.typ != tOp || p.curr.val != ":" {
-			return nil, fmt.Errorf("missing : in ternary expression at position %d", p.curr.pos)
+			elseExpr, err := p.bad(p.errorf(p.curr, "missing : in ternary expression at position %d", p.curr.pos))
+			if err != nil {
+				return nil, err
+			}
+			return &TernaryExpr{Cond: left, Then: thenExpr, Else: elseExpr}, nil
 		}
 		p.advance()
 		elseExpr, err := p.parse(lbp(t)-1, depth+1)
@@ -1762,10 +2057,9 @@ func (p *parser) led(t token, left Expr, depth int) (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		if p.curr.typ != tOp || p.curr.val != "]" {
-			return nil, fmt.Errorf("missing ] in index expression at position %d", p.curr.pos)
+		if err := p.closeBracket("missing ] in index expression at position %d"); err != nil {
+			return nil, err
 		}
-		p.advance()
 		return &IndexExpr{Left: left, Index: idxExpr}, nil
 	}
 	if t.val == "." {
@@ -1775,10 +2069,9 @@ func (p *parser) led(t token, left Expr, depth int) (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
-			if p.curr.typ != tOp || p.curr.val != "]" {
-				return nil, fmt.Errorf("missing ] in index expression at position %d", p.curr.pos)
+			if err := p.closeBracket("missing ] in index expression at position %d"); err != nil {
+				return nil, err
 			}
-			p.advance()
 			return &IndexExpr{Left: left, Index: idxExpr}, nil
 		}
 		member := p.curr.val
@@ -1800,6 +2093,7 @@ func (p *parser) led(t token, left Expr, depth int) (Expr, error) {
 func (p *parser) parseArgs(depth int) ([]Expr, error) {
 	var args []Expr
 	for p.curr.typ != tRParen && p.curr.typ != tEOF {
+		before := p.curr.pos
 		a, err := p.parse(0, depth+1)
 		if err != nil {
 			return nil, err
@@ -1807,15 +2101,37 @@ func (p *parser) parseArgs(depth int) ([]Expr, error) {
 		args = append(args, a)
 		if p.curr.typ == tComma {
 			p.advance()
+		} else if p.curr.pos == before {
+			break // recovery stopped at a stray closer; report the missing )
 		}
 	}
 	if p.curr.typ != tRParen {
-		return nil, errors.New("missing ) in args")
+		if err := p.report(p.errorf(p.curr, "missing ) in args")); err != nil {
+			return nil, err
+		}
+		return args, nil
 	}
 	p.advance()
 	return args, nil
 }
 
+// closeBracket consumes the `]` closing an index expression, or reports the
+// error described by format (which receives the current position). In
+// recovering mode it resynchronizes and consumes a `]` found there.
+func (p *parser) closeBracket(format string) error {
+	if p.curr.typ != tOp || p.curr.val != "]" {
+		if err := p.report(p.errorf(p.curr, format, p.curr.pos)); err != nil {
+			return err
+		}
+		p.sync()
+		if p.curr.typ != tOp || p.curr.val != "]" {
+			return nil
+		}
+	}
+	p.advance()
+	return nil
+}
+
 // lbpIn is the binding power of `in` / `not in`; it sits on the comparison
 // tier, matching how most languages treat membership.
 const lbpIn = 35
@@ -1859,11 +2175,26 @@ func lbp(t token) int {
 // -----------------------------------------------------------------------------
 
 type Engine struct {
-	funcs        atomic.Value // holds map[string]CustomFunc
-	macros       atomic.Value // holds map[string]MacroFunc
+	regMu        sync.Mutex // serializes registrations
+	callables    atomic.Pointer[callables]
 	maxDepth     atomic.Int64
 	strict       atomic.Bool
 	methodFilter atomic.Value // holds methodPolicy
+	maxCost      atomic.Int64
+	flippedOpts  atomic.Uint32 // Optimization passes differing from OptAll
+	// gen counts configuration changes; cache entries compiled under an
+	// older generation no longer match (see SetCacheSize).
+	gen   atomic.Uint64
+	cache atomic.Pointer[programCache]
+}
+
+// callables is one state of an Engine's functions and macros, with their
+// annotations. A registration publishes a new state whole, so Compile never
+// pairs a function with the annotations of the one it replaced.
+type callables struct {
+	funcs  map[string]CustomFunc
+	macros map[string]MacroFunc
+	calls  map[callKey]funcInfo
 }
 
 // methodPolicy wraps the optional method filter so it can live in an
@@ -1960,6 +2291,11 @@ func defaultFuncs() map[string]CustomFunc {
 		"lower":      strUnaryFunc("lower", strings.ToLower),
 		"upper":      strUnaryFunc("upper", strings.ToUpper),
 		"trim":       strUnaryFunc("trim", strings.TrimSpace),
+		// bucket(user.ID, 'new-checkout') < 20 and sample(user.ID,
+		// 'new-checkout', 20) put the same keys in the same rollout everywhere
+		// (see Bucket).
+		"bucket": bucketFunc,
+		"sample": sampleFunc,
 	}
 }
 
@@ -2002,34 +2338,19 @@ func strUnaryFunc(name string, fn func(string) string) CustomFunc {
 	}
 }
 
-func (e *Engine) loadFuncs() (m map[string]CustomFunc) {
-	defer func() {
-		if recover() != nil {
-			m = defaultFuncs()
-			e.funcs.Store(m)
-		}
-	}()
-	return e.funcs.Load().(map[string]CustomFunc)
-}
-
-func (e *Engine) loadMacros() (m map[string]MacroFunc) {
-	defer func() {
-		if recover() != nil {
-			m = map[string]MacroFunc{}
-			e.macros.Store(m)
-		}
-	}()
-	v := e.macros.Load()
-	if v == nil {
-		return map[string]MacroFunc{}
+// loadCallables returns the current functions and macros; a zero Engine has
+// the built-in ones.
+func (e *Engine) loadCallables() *callables {
+	if c := e.callables.Load(); c != nil {
+		return c
 	}
-	return v.(map[string]MacroFunc)
+	e.callables.CompareAndSwap(nil, &callables{funcs: defaultFuncs(), macros: map[string]MacroFunc{}, calls: builtinCalls()})
+	return e.callables.Load()
 }
 
 func NewEngine() *Engine {
 	e := &Engine{}
-	e.funcs.Store(defaultFuncs())
-	e.macros.Store(map[string]MacroFunc{})
+	e.loadCallables()
 	e.maxDepth.Store(MaxStackDepth)
 	// Strict lookups are ON by default: a misspelled field, absent key, or
 	// out-of-range index is a mistake, not a silent nil. Optional members are
@@ -2047,6 +2368,7 @@ func (e *Engine) SetMaxNestingDepth(n int) {
 		n = MaxStackDepth
 	}
 	e.maxDepth.Store(int64(n))
+	e.changed()
 }
 
 func (e *Engine) depthLimit() int {
@@ -2060,7 +2382,10 @@ func (e *Engine) depthLimit() int {
 // field, map key, out-of-range index, or a member of nil returns an error
 // (wrapping ErrUnknownField) instead of nil. On by default; pass false to opt
 // into lenient missing→nil resolution. Safe to call concurrently.
-func (e *Engine) SetStrict(strict bool) { e.strict.Store(strict) }
+func (e *Engine) SetStrict(strict bool) {
+	e.strict.Store(strict)
+	e.changed()
+}
 
 // SetMethodFilter installs a predicate consulted before every reflected method
 // or getter invocation; names for which it returns false are denied with
@@ -2068,6 +2393,7 @@ func (e *Engine) SetStrict(strict bool) { e.strict.Store(strict) }
 // concurrently.
 func (e *Engine) SetMethodFilter(filter func(name string) bool) {
 	e.methodFilter.Store(methodPolicy{filter})
+	e.changed()
 }
 
 func (e *Engine) methodFilterFn() func(string) bool {
@@ -2078,20 +2404,29 @@ func (e *Engine) methodFilterFn() func(string) bool {
 	return v.(methodPolicy).fn
 }
 
-func (e *Engine) RegisterFunc(name string, fn CustomFunc) error {
+// RegisterFunc registers a function on this Engine under a case-insensitive
+// name. Options annotate it for static analysis, e.g. WithCost for
+// Program.Cost. Registration is copy-on-write and only affects Programs
+// compiled after this call.
+func (e *Engine) RegisterFunc(name string, fn CustomFunc, opts ...FuncOption) error {
 	if name == "" {
 		return errors.New("func name cannot be empty")
 	}
 	if fn == nil {
 		return errors.New("func cannot be nil")
 	}
-	curr := e.loadFuncs()
-	next := make(map[string]CustomFunc, len(curr)+1)
-	maps.Copy(next, curr)
+	e.regMu.Lock()
+	defer e.regMu.Unlock()
+	curr := e.loadCallables()
+	next := *curr
+	next.funcs = make(map[string]CustomFunc, len(curr.funcs)+1)
+	maps.Copy(next.funcs, curr.funcs)
 	// Lookup in CallExpr.Eval normalizes names to lower case, so store the
 	// key the same way to keep registration case-insensitive.
-	next[strings.ToLower(name)] = fn
-	e.funcs.Store(next)
+	next.funcs[strings.ToLower(name)] = fn
+	next.setCallInfo(callKey{strings.ToLower(name), false}, opts)
+	e.callables.Store(&next)
+	e.changed()
 	return nil
 }
 
@@ -2101,22 +2436,46 @@ func (e *Engine) RegisterFunc(name string, fn CustomFunc) error {
 // for collection operations like any/all/filter/map. Macros are resolved before
 // plain functions and before the data-method fallback. Registration is
 // per-Engine and copy-on-write, so it is safe to call concurrently; like
-// RegisterFunc, it only affects Programs compiled after this call.
-func (e *Engine) RegisterMacro(name string, fn MacroFunc) error {
+// RegisterFunc, it only affects Programs compiled after this call. Options
+// annotate it for static analysis (WithCost, WithIterations).
+func (e *Engine) RegisterMacro(name string, fn MacroFunc, opts ...FuncOption) error {
 	if name == "" {
 		return errors.New("macro name cannot be empty")
 	}
 	if fn == nil {
 		return errors.New("macro cannot be nil")
 	}
-	curr := e.loadMacros()
-	next := make(map[string]MacroFunc, len(curr)+1)
-	maps.Copy(next, curr)
-	next[strings.ToLower(name)] = fn
-	e.macros.Store(next)
+	e.regMu.Lock()
+	defer e.regMu.Unlock()
+	curr := e.loadCallables()
+	next := *curr
+	next.macros = make(map[string]MacroFunc, len(curr.macros)+1)
+	maps.Copy(next.macros, curr.macros)
+	next.macros[strings.ToLower(name)] = fn
+	next.setCallInfo(callKey{strings.ToLower(name), true}, opts)
+	e.callables.Store(&next)
+	e.changed()
 	return nil
 }
 
+// setCallInfo records (or, re-registering without options, resets) the
+// annotations of a registered name in a copy of c's.
+func (c *callables) setCallInfo(key callKey, opts []FuncOption) {
+	next := make(map[callKey]funcInfo, len(c.calls)+1)
+	maps.Copy(next, c.calls)
+	next[key] = newFuncInfo(opts)
+	c.calls = next
+}
+
+// SetMaxCost makes Compile reject Programs whose estimated cost (see
+// Program.Cost) exceeds n, with a KindLimit *Error wrapping ErrCostExceeded.
+// A non-positive n disables the check (the default). Safe to call
+// concurrently.
+func (e *Engine) SetMaxCost(n int64) {
+	e.maxCost.Store(max(n, 0))
+	e.changed()
+}
+
 // Program is a parsed expression compiled from an Engine. Parsing is done once;
 // Eval can then be called repeatedly against different data without
 // re-lexing/re-parsing, the common rules-engine pattern of evaluating one rule
@@ -2133,48 +2492,85 @@ type Program struct {
 	macros       map[string]MacroFunc
 	strict       bool
 	methodFilter func(name string) bool
+	calls        map[callKey]funcInfo
+	// code is the bytecode compiled from ast (see vm.go). Nil for a Program
+	// not built by Compile, which then evaluates by walking ast.
+	code *bytecode
+	// slots is the number of shared sub-expressions in ast (see OptCSE).
+	slots int
+	// src and spans map AST nodes back to their source text so evaluation
+	// errors can report a line/column (see Error).
+	src   string
+	spans map[Expr]span
 }
 
 // Compile parses exprStr once and returns a reusable Program, honoring the
 // Engine's nesting limit and snapshotting the Engine's current configuration.
-// Parse-time panics are recovered and returned as errors, mirroring Eval.
-func (e *Engine) Compile(exprStr string) (prog *Program, err error) {
+// Parse-time panics are recovered and returned as errors, mirroring Eval. With
+// a cache (see SetCacheSize), a Program compiled earlier from the same text
+// under the same configuration is returned instead.
+func (e *Engine) Compile(exprStr string) (*Program, error) {
+	c := e.cache.Load()
+	if c == nil {
+		return e.compile(exprStr)
+	}
+	// Load the generation before compiling: a concurrent configuration change
+	// then files the result under the older generation, never the newer one.
+	key := cacheKey{exprStr, e.gen.Load()}
+	if prog, ok := c.get(key); ok {
+		return prog, nil
+	}
+	prog, err := e.compile(exprStr)
+	if err == nil {
+		c.add(key, prog)
+	}
+	return prog, err
+}
+
+func (e *Engine) compile(exprStr string) (*Program, error) {
+	return e.compileWith(exprStr, nil)
+}
+
+// compileWith is compile with rewrite, if non-nil, applied to the parsed AST
+// ahead of the optimizer.
+func (e *Engine) compileWith(exprStr string, rewrite func(Expr, map[Expr]span) Expr) (prog *Program, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			prog = nil
 			err = fmt.Errorf("panic: %v", r)
 		}
 	}()
-	ast, err := parseWithDepth(exprStr, e.depthLimit())
+	ast, spans, err := parseSource(exprStr, e.depthLimit())
 	if err != nil {
 		return nil, err
 	}
-	return &Program{
-		ast:          foldConstants(ast),
-		fns:          e.loadFuncs(),
-		macros:       e.loadMacros(),
+	if rewrite != nil {
+		ast = rewrite(ast, spans)
+	}
+	calls := e.loadCallables()
+	prog = &Program{
+		ast:          ast,
+		fns:          calls.funcs,
+		macros:       calls.macros,
 		strict:       e.strict.Load(),
 		methodFilter: e.methodFilterFn(),
-	}, nil
+		calls:        calls.calls,
+		src:          exprStr,
+		spans:        spans,
+	}
+	prog.optimize(e.optimizations())
+	prog.code = compileBytecode(prog.ast, prog.fns, prog.macros)
+	if err := prog.checkCost(e.maxCost.Load()); err != nil {
+		return nil, err
+	}
+	return prog, nil
 }
 
 // Eval evaluates a compiled Program against data using the configuration
 // snapshotted at Compile time. Evaluation panics are recovered and returned as
 // errors.
 func (p *Program) Eval(data any) (res any, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("panic: %v", r)
-			res = nil
-		}
-	}()
-	return p.ast.Eval(Context{
-		Data:         data,
-		Fns:          p.fns,
-		Macros:       p.macros,
-		Strict:       p.strict,
-		MethodFilter: p.methodFilter,
-	})
+	return p.run(p.context(data))
 }
 
 // EvalContext is Eval with cooperative cancellation: evaluation counts its work
@@ -2184,26 +2580,64 @@ func (p *Program) Eval(data any) (res any, err error) {
 // so this cooperative check is the only way to bound a rule that scans a large
 // collection inside a latency budget. The overhead for typical rules is one
 // counter increment per node.
-func (p *Program) EvalContext(ctx context.Context, data any) (res any, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("panic: %v", r)
-			res = nil
-		}
-	}()
+func (p *Program) EvalContext(ctx context.Context, data any) (any, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 	var steps uint64
-	return p.ast.Eval(Context{
+	c := p.context(data)
+	c.ctx, c.steps = ctx, &steps
+	return p.run(c)
+}
+
+// context returns the evaluation Context for data under the Program's
+// snapshotted configuration.
+func (p *Program) context(data any) Context {
+	return Context{
 		Data:         data,
 		Fns:          p.fns,
 		Macros:       p.macros,
 		Strict:       p.strict,
 		MethodFilter: p.methodFilter,
-		ctx:          ctx,
-		steps:        &steps,
-	})
+	}
+}
+
+// run evaluates the Program in c, recovering panics and locating errors in
+// the source.
+func (p *Program) run(c Context) (res any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			res = nil
+		}
+	}()
+	res, err = p.exec(c)
+	return res, p.locate(err)
+}
+
+// exec runs the Program's bytecode, or walks its AST when it has none, with a
+// fresh memo for its shared sub-expressions.
+func (p *Program) exec(ctx Context) (any, error) {
+	if p.slots == 0 {
+		return p.eval(ctx)
+	}
+	m := memoPool.Get().(*memoBuf)
+	if cap(m.slots) < p.slots {
+		m.slots = make([]memoSlot, p.slots)
+	}
+	ctx.memo, ctx.getters = m.slots[:p.slots], &m.getters
+	v, err := p.eval(ctx)
+	clear(ctx.memo)
+	m.getters = 0
+	memoPool.Put(m)
+	return v, err
+}
+
+func (p *Program) eval(ctx Context) (any, error) {
+	if p.code != nil {
+		return p.code.run(ctx)
+	}
+	return p.ast.Eval(ctx)
 }
 
 // Vars returns the distinct root variable/field identifiers the program reads
@@ -2281,6 +2715,12 @@ func walk(e Expr, fn func(Expr)) {
 		for _, el := range n.Elems {
 			walk(el, fn)
 		}
+	case *sharedExpr:
+		walk(n.X, fn)
+	case *chainExpr:
+		walk(n.Written, fn)
+	case *tableInput:
+		walk(n.X, fn)
 	}
 }
 
@@ -2288,23 +2728,30 @@ func walk(e Expr, fn func(Expr)) {
 // literal they evaluate to, so a compiled Program does not recompute constant
 // arithmetic on every Eval. Folding is skipped for any subtree whose evaluation
 // errors (e.g. `1/0`), preserving the original error-at-eval semantics.
-func foldConstants(e Expr) Expr {
+func foldConstants(e Expr) Expr { return folder{}.fold(e) }
+
+// folder is constant folding that may also call pure functions (see Pure):
+// a call to one of them whose arguments fold to literals is itself folded.
+// Nothing else is ever called at compile time.
+type folder struct{ pure map[string]CustomFunc }
+
+func (f folder) fold(e Expr) Expr {
 	switch n := e.(type) {
 	case *UnaryExpr:
-		n.Right = foldConstants(n.Right)
+		n.Right = f.fold(n.Right)
 		if isLiteral(n.Right) {
 			return tryFold(n)
 		}
 	case *InfixExpr:
-		n.Left = foldConstants(n.Left)
-		n.Right = foldConstants(n.Right)
+		n.Left = f.fold(n.Left)
+		n.Right = f.fold(n.Right)
 		if isLiteral(n.Left) && isLiteral(n.Right) {
 			return tryFold(n)
 		}
 	case *TernaryExpr:
-		n.Cond = foldConstants(n.Cond)
-		n.Then = foldConstants(n.Then)
-		n.Else = foldConstants(n.Else)
+		n.Cond = f.fold(n.Cond)
+		n.Then = f.fold(n.Then)
+		n.Else = f.fold(n.Else)
 		if lit, ok := n.Cond.(*LiteralExpr); ok {
 			// Only fold when the constant condition is actually a bool; a non-bool
 			// constant is left intact so it surfaces the type error at Eval time.
@@ -2318,7 +2765,7 @@ func foldConstants(e Expr) Expr {
 	case *ListExpr:
 		allLit := true
 		for i := range n.Elems {
-			n.Elems[i] = foldConstants(n.Elems[i])
+			n.Elems[i] = f.fold(n.Elems[i])
 			if !isLiteral(n.Elems[i]) {
 				allLit = false
 			}
@@ -2326,19 +2773,35 @@ func foldConstants(e Expr) Expr {
 		if allLit {
 			return tryFold(n)
 		}
+	case *CallExpr:
+		if _, ok := f.pure[n.key()]; !ok {
+			break
+		}
+		allLit := true
+		for i := range n.Args {
+			n.Args[i] = f.fold(n.Args[i])
+			if !isLiteral(n.Args[i]) {
+				allLit = false
+			}
+		}
+		if allLit {
+			return tryFoldIn(Context{Fns: f.pure}, n)
+		}
 	}
 	return e
 }
 
 // tryFold evaluates a fully-constant node with an empty context; on any error
 // (or panic) it returns the node unchanged so the error surfaces at Eval time.
-func tryFold(e Expr) (out Expr) {
+func tryFold(e Expr) Expr { return tryFoldIn(Context{}, e) }
+
+func tryFoldIn(ctx Context, e Expr) (out Expr) {
 	defer func() {
 		if recover() != nil {
 			out = e
 		}
 	}()
-	v, err := e.Eval(Context{})
+	v, err := e.Eval(ctx)
 	if err != nil {
 		return e
 	}
@@ -2483,25 +2946,34 @@ const MaxExprLen = 1 << 20 // 1 MiB
 
 // parseWithDepth parses s with the given nesting limit. Any panic is recovered
 // and returned as an error so parsing can never crash the caller.
-func parseWithDepth(s string, maxDepth int) (ast Expr, err error) {
+func parseWithDepth(s string, maxDepth int) (Expr, error) {
+	ast, _, err := parseSource(s, maxDepth)
+	return ast, err
+}
+
+// parseSource is parseWithDepth that also returns the source span of every
+// node, for position-aware errors.
+func parseSource(s string, maxDepth int) (ast Expr, spans map[Expr]span, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			ast = nil
+			ast, spans = nil, nil
 			err = fmt.Errorf("panic: %v", r)
 		}
 	}()
 	if len(s) > MaxExprLen {
-		return nil, fmt.Errorf("expression too long (%d bytes, max %d)", len(s), MaxExprLen)
+		return nil, nil, sourceError(KindLimit, s, 0, 0,
+			fmt.Errorf("expression too long (%d bytes, max %d)", len(s), MaxExprLen))
 	}
 	p := newParser(s, maxDepth)
+	p.spans = map[Expr]span{}
 	ast, err = p.parse(0, 0)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if p.curr.typ != tEOF {
-		return nil, fmt.Errorf("extra token %s at position %d", p.curr.val, p.curr.pos)
+		return nil, nil, p.errorf(p.curr, "extra token %s at position %d", p.curr.val, p.curr.pos)
 	}
-	return ast, nil
+	return ast, p.spans, nil
 }
 
 // ParseExpr parses s into an AST using the default nesting limit. It never
@@ -2509,3 +2981,34 @@ func parseWithDepth(s string, maxDepth int) (ast Expr, err error) {
 func ParseExpr(s string) (Expr, error) {
 	return parseWithDepth(s, MaxStackDepth)
 }
+
+// ParseAll parses s in error-recovery mode, for live editing feedback: rather
+// than stopping at the first problem it resynchronizes at commas, closing
+// brackets and parentheses and keeps going, returning a partial AST (with a
+// BadExpr standing in for each malformed region) together with every syntax
+// diagnostic found, in source order. A nil diagnostics slice means s parsed
+// cleanly and the AST is the one ParseExpr would return. It never panics.
+func ParseAll(s string) (ast Expr, diags []*Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ast = nil
+			diags = append(diags, sourceError(KindSyntax, s, 0, 0, fmt.Errorf("panic: %v", r)))
+		}
+	}()
+	if len(s) > MaxExprLen {
+		return nil, []*Error{sourceError(KindLimit, s, 0, 0,
+			fmt.Errorf("expression too long (%d bytes, max %d)", len(s), MaxExprLen))}
+	}
+	p := newParser(s, MaxStackDepth)
+	p.recovering = true
+	ast, _ = p.parse(0, 0)
+	for p.curr.typ != tEOF {
+		_ = p.report(p.errorf(p.curr, "extra token %s at position %d", p.curr.val, p.curr.pos))
+		p.advance()
+		p.sync()
+	}
+	if p.lexErr != nil {
+		_ = p.report(p.lexErr)
+	}
+	return ast, p.diags
+}
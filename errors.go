@@ -0,0 +1,194 @@
+package okra
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrorKind classifies an *Error by the phase that produced it.
+type ErrorKind int
+
+const (
+	// KindSyntax: the expression is malformed and was rejected by the parser.
+	KindSyntax ErrorKind = iota + 1
+	// KindLimit: the expression exceeds a configured size or nesting limit.
+	KindLimit
+	// KindEval: evaluation failed at a specific sub-expression.
+	KindEval
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindSyntax:
+		return "syntax"
+	case KindLimit:
+		return "limit"
+	case KindEval:
+		return "eval"
+	}
+	return "unknown"
+}
+
+// Error is the structured, position-aware error returned by Compile, ParseExpr
+// and Program evaluation. It lets tooling (a rule editor, a linter front-end)
+// point at the exact location of a failure instead of parsing messages:
+//
+//	var oe *okra.Error
+//	if errors.As(err, &oe) {
+//		fmt.Println(oe.Line, oe.Column)
+//		fmt.Println(oe.Snippet())
+//	}
+//
+// Error() renders exactly the message okra has always produced — for an
+// evaluation failure `<sub-expression>: <reason>` — and Unwrap exposes the
+// underlying error, so errors.Is on the sentinel errors keeps working.
+type Error struct {
+	Kind ErrorKind
+	// Line and Column locate Start (both 1-based; Column counts runes). They
+	// are 0 when the position is unknown, e.g. for a hand-built AST.
+	Line, Column int
+	// Start and End are the byte span [Start, End) of the failing node (or
+	// offending token) in Source.
+	Start, End int
+	// Expr is the failing node's source form (its String()). Empty for syntax
+	// and limit errors, which are not tied to a parsed node.
+	Expr string
+	// Source is the full expression text the error was reported against.
+	Source string
+	// Cause is the sentinel error behind the failure (ErrDivByZero,
+	// ErrUnknownField, …), or nil when the failure has no sentinel.
+	Cause error
+	// Suggestions holds the closest known names when a field, key, function
+	// or method was not found ("did you mean"), closest first. The message
+	// already mentions them; this is the same list for tooling.
+	Suggestions []string
+	// Err is the underlying error.
+	Err error
+
+	// node is the AST node an evaluation error was born at; Program.Eval uses
+	// it to look up the node's span once the error reaches the top.
+	node Expr
+	// located is set once a position has been resolved (or found unknowable),
+	// so an error propagating through nested Programs is located only once.
+	located bool
+}
+
+func (e *Error) Error() string {
+	if e.Expr != "" {
+		return e.Expr + ": " + e.Err.Error()
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Snippet renders the source line containing the error with a caret marker
+// under the failing span, for display in a terminal or editor:
+//
+//	user.Age > user.Name && ok
+//	^^^^^^^^^^^^^^^^^^^^
+//
+// A span crossing a line break is underlined to the end of its first line. It
+// returns "" when the position is unknown.
+func (e *Error) Snippet() string { return renderSnippet(e.Source, e.Start, e.End, e.Line) }
+
+func renderSnippet(src string, start, end, line int) string {
+	if line == 0 || start < 0 || start > len(src) {
+		return ""
+	}
+	lineStart := strings.LastIndexByte(src[:start], '\n') + 1
+	lineEnd := len(src)
+	if i := strings.IndexByte(src[start:], '\n'); i >= 0 {
+		lineEnd = start + i
+	}
+	if end > lineEnd {
+		end = lineEnd
+	}
+	var sb strings.Builder
+	sb.WriteString(src[lineStart:lineEnd])
+	sb.WriteByte('\n')
+	// Pad with the same whitespace kind so tabs keep the caret aligned.
+	for _, r := range src[lineStart:start] {
+		if r == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+	n := utf8.RuneCountInString(src[start:max(start, end)])
+	sb.WriteString(strings.Repeat("^", max(n, 1)))
+	return sb.String()
+}
+
+// lineCol converts a byte offset into a 1-based line and rune column.
+func lineCol(src string, off int) (line, col int) {
+	if off > len(src) {
+		off = len(src)
+	}
+	line = 1 + strings.Count(src[:off], "\n")
+	lineStart := strings.LastIndexByte(src[:off], '\n') + 1
+	return line, 1 + utf8.RuneCountInString(src[lineStart:off])
+}
+
+// sentinels lists the exported sentinel errors, most specific first, for
+// filling Error.Cause.
+var sentinels = []error{
+	ErrDivByZero, ErrModByZero, ErrFloatModulo, ErrNegativeShift,
+	ErrIntOverflow, ErrUnknownField, ErrMethodDenied, ErrNotFound,
+	ErrCostExceeded,
+}
+
+func sentinelOf(err error) error {
+	for _, s := range sentinels {
+		if errors.Is(err, s) {
+			return s
+		}
+	}
+	return nil
+}
+
+// sourceError builds a syntax or limit error covering [start, end) of src.
+func sourceError(kind ErrorKind, src string, start, end int, err error) *Error {
+	line, col := lineCol(src, start)
+	return &Error{
+		Kind:    kind,
+		Line:    line,
+		Column:  col,
+		Start:   start,
+		End:     end,
+		Source:  src,
+		Cause:   sentinelOf(err),
+		Err:     err,
+		located: true,
+	}
+}
+
+// span is the byte range [start, end) of a parsed node in its source.
+type span struct{ start, end int }
+
+// locate fills in the position of an evaluation error from the Program's span
+// table. Errors not born at a node of this Program are returned untouched.
+func (p *Program) locate(err error) error {
+	if err == nil {
+		return nil
+	}
+	var oe *Error
+	if !errors.As(err, &oe) || oe.located {
+		return err
+	}
+	oe.located = true
+	oe.Source = p.src
+	if sp, ok := p.spans[oe.node]; ok {
+		oe.Start, oe.End = sp.start, sp.end
+		oe.Line, oe.Column = lineCol(p.src, sp.start)
+	}
+	return err
+}
+
+// notBool is the *Error of a Program that yielded v where a bool is wanted,
+// positioned at the whole expression.
+func (p *Program) notBool(v any) error {
+	return p.locate(opErr(p.ast, fmt.Errorf("yielded %T, want bool", v)))
+}
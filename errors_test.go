@@ -0,0 +1,199 @@
+package okra
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestErrorParsePositions(t *testing.T) {
+	e := NewEngine()
+	cases := []struct {
+		src        string
+		kind       ErrorKind
+		line, col  int
+		start, end int
+	}{
+		{"(a + b", KindSyntax, 1, 7, 6, 6},         // missing ) at EOF
+		{"a + * b", KindSyntax, 1, 5, 4, 5},        // unexpected token *
+		{"a\n  && 'oops", KindSyntax, 2, 6, 7, 12}, // unterminated string on line 2
+		{"1.2.3 + x", KindSyntax, 1, 1, 0, 5},      // malformed number
+		{"a b", KindSyntax, 1, 3, 2, 3},            // extra token
+	}
+	for _, c := range cases {
+		_, err := e.Compile(c.src)
+		var oe *Error
+		if !errors.As(err, &oe) {
+			t.Fatalf("%q: expected *Error, got %T %v", c.src, err, err)
+		}
+		if oe.Kind != c.kind || oe.Line != c.line || oe.Column != c.col || oe.Start != c.start || oe.End != c.end {
+			t.Fatalf("%q: got kind=%v line=%d col=%d span=[%d,%d), want kind=%v line=%d col=%d span=[%d,%d)",
+				c.src, oe.Kind, oe.Line, oe.Column, oe.Start, oe.End, c.kind, c.line, c.col, c.start, c.end)
+		}
+		if oe.Source != c.src {
+			t.Fatalf("%q: Source = %q", c.src, oe.Source)
+		}
+	}
+
+	e.SetMaxNestingDepth(2)
+	_, err := e.Compile("((((1))))")
+	var oe *Error
+	if !errors.As(err, &oe) || oe.Kind != KindLimit {
+		t.Fatalf("nesting limit: expected KindLimit, got %v", err)
+	}
+}
+
+func TestErrorEvalPositions(t *testing.T) {
+	e := NewEngine()
+	data := map[string]any{"user": map[string]any{"Age": int64(30), "Name": "Alice"}}
+	src := "user.Age > 18 &&\n\tuser.Age > user.Name"
+	_, err := e.Eval(src, data)
+	var oe *Error
+	if !errors.As(err, &oe) {
+		t.Fatalf("expected *Error, got %T %v", err, err)
+	}
+	if oe.Kind != KindEval || oe.Line != 2 || oe.Column != 2 {
+		t.Fatalf("got kind=%v line=%d col=%d", oe.Kind, oe.Line, oe.Column)
+	}
+	if got := src[oe.Start:oe.End]; got != "user.Age > user.Name" {
+		t.Fatalf("span covers %q", got)
+	}
+	if oe.Expr != "(user.Age > user.Name)" {
+		t.Fatalf("Expr = %q", oe.Expr)
+	}
+	// The message is unchanged from the plain annotated form.
+	if !strings.HasPrefix(err.Error(), "(user.Age > user.Name): invalid comparison") {
+		t.Fatalf("message = %q", err.Error())
+	}
+	want := "\tuser.Age > user.Name\n\t^^^^^^^^^^^^^^^^^^^^"
+	if got := oe.Snippet(); got != want {
+		t.Fatalf("Snippet:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestErrorCauseAndBirthplace(t *testing.T) {
+	e := NewEngine()
+	data := map[string]any{"n": int64(0), "user": map[string]any{"Name": "x"}}
+	cases := []struct {
+		src   string
+		cause error
+		span  string
+	}{
+		{"1 + 10 / n", ErrDivByZero, "10 / n"},
+		{"user.Naem == 'x'", ErrUnknownField, "user.Naem"},
+		{"missing > 1", ErrUnknownField, "missing"},
+		{"nope(1) && true", ErrNotFound, "nope(1)"},
+		{"user['Naem'] == 1", ErrUnknownField, "user['Naem']"},
+	}
+	for _, c := range cases {
+		_, err := e.Eval(c.src, data)
+		var oe *Error
+		if !errors.As(err, &oe) {
+			t.Fatalf("%s: expected *Error, got %v", c.src, err)
+		}
+		if oe.Cause != c.cause || !errors.Is(err, c.cause) {
+			t.Fatalf("%s: Cause = %v, want %v", c.src, oe.Cause, c.cause)
+		}
+		if got := c.src[oe.Start:oe.End]; got != c.span {
+			t.Fatalf("%s: span covers %q, want %q", c.src, got, c.span)
+		}
+	}
+}
+
+func TestErrorNotReannotated(t *testing.T) {
+	e := NewEngine()
+	inner, err := e.Compile("x / 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A function that evaluates another Program returns that Program's located
+	// error; the outer call must pass it through rather than wrap it again.
+	if err := e.RegisterFunc("inner", func(args []any) (any, error) {
+		return inner.Eval(map[string]any{"x": args[0]})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.Eval("1 + inner(4)", nil)
+	var oe *Error
+	if !errors.As(err, &oe) || oe.Source != "x / 0" || oe.Expr != "(x / 0)" {
+		t.Fatalf("expected the inner program's error, got %v (%+v)", err, oe)
+	}
+	if strings.Count(err.Error(), ":") != 1 {
+		t.Fatalf("error annotated more than once: %v", err)
+	}
+}
+
+func TestErrorUnknownPosition(t *testing.T) {
+	// A hand-built AST has no source spans: the error is still structured, but
+	// carries no position and renders no snippet.
+	ast := &InfixExpr{Left: &LiteralExpr{Value: int64(1)}, Op: "/", Right: &LiteralExpr{Value: int64(0)}}
+	_, err := (&Engine{}).evalAST(ast)
+	var oe *Error
+	if !errors.As(err, &oe) || oe.Line != 0 || oe.Snippet() != "" {
+		t.Fatalf("got %v (%+v)", err, oe)
+	}
+}
+
+func TestParseAllRecovers(t *testing.T) {
+	cases := []struct {
+		src   string
+		ast   string   // String() of the partial AST
+		diags []string // "line:col message"
+	}{
+		{"user.Age > 18 && ok", "((user.Age > 18) && ok)", nil},
+		{"a +", "(a + <bad>)", []string{"1:4 unexpected end of expression"}},
+		{"f(a +, b, * c)", "f((a + <bad>), b, * c)", []string{
+			"1:6 unexpected token ,",
+			"1:11 unexpected token *",
+		}},
+		{"[1, 2", "[1, 2]", []string{"1:6 missing ] in list literal"}},
+		{"(a + b c) && d", "((a + b) && d)", []string{"1:8 missing ) at position 7"}},
+		{"x[1 + ) * 3", "x[(1 + <bad>)]", []string{"1:7 unexpected token )"}},
+		{"1.2.3 + (2 *) + [", "((1.2.3 + (2 * <bad>)) + [])", []string{
+			"1:1 invalid number \"1.2.3\": strconv.ParseFloat: parsing \"1.2.3\": invalid syntax",
+			"1:13 unexpected token )",
+			"1:18 missing ] in list literal",
+		}},
+		{"a, b, c", "a", []string{
+			"1:2 extra token , at position 1",
+			"1:5 extra token , at position 4",
+		}},
+	}
+	for _, c := range cases {
+		ast, diags := ParseAll(c.src)
+		if ast == nil || ast.String() != c.ast {
+			t.Errorf("%q: partial AST = %v, want %s", c.src, ast, c.ast)
+		}
+		var got []string
+		for _, d := range diags {
+			got = append(got, fmt.Sprintf("%d:%d %v", d.Line, d.Column, d))
+		}
+		if strings.Join(got, "\n") != strings.Join(c.diags, "\n") {
+			t.Errorf("%q: diagnostics\n%s\nwant\n%s", c.src, strings.Join(got, "\n"), strings.Join(c.diags, "\n"))
+		}
+	}
+}
+
+func TestParseAllMatchesParseExpr(t *testing.T) {
+	// On valid input ParseAll is ParseExpr; on invalid input its first
+	// diagnostic is the error ParseExpr reports.
+	for _, src := range []string{"a.b[c] + f(1, [2, 3])", "(a", "a ? b", "'oops", "a not b", ")"} {
+		want, wantErr := ParseExpr(src)
+		got, diags := ParseAll(src)
+		if wantErr == nil {
+			if len(diags) != 0 || got.String() != want.String() {
+				t.Fatalf("%q: got %v %v, want %v", src, got, diags, want)
+			}
+			continue
+		}
+		if len(diags) == 0 || diags[0].Error() != wantErr.Error() {
+			t.Fatalf("%q: first diagnostic %v, want %v", src, diags, wantErr)
+		}
+	}
+	// A BadExpr placeholder fails evaluation with its diagnostic.
+	ast, diags := ParseAll("1 + ")
+	if _, err := (&Engine{}).evalAST(ast); err == nil || err != error(diags[0]) {
+		t.Fatalf("evaluating a partial AST: got %v", err)
+	}
+}
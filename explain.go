@@ -0,0 +1,237 @@
+package okra
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Explanation is the record of one node of an explained evaluation (see
+// Program.Explain): the node's source text, whether it was evaluated and to
+// what, and the same for the nodes below it.
+type Explanation struct {
+	// Expr is the node's source text.
+	Expr string
+	// Start and End are the node's byte span [Start, End) in the Program's
+	// source; both are 0 when unknown.
+	Start, End int
+	// Evaluated is false for a node never reached: the right operand of a
+	// short-circuited && or ||, the branch a ternary did not take, or an
+	// operand after one that failed.
+	Evaluated bool
+	// Value is what the node evaluated to, when it did without error.
+	Value any
+	// Err is the error the node failed with; its ancestors fail with the
+	// same error.
+	Err error
+	// Children are the node's operands, in source order. Macro arguments
+	// are not explained: a macro call has no children.
+	Children []*Explanation
+
+	node    Expr // the node explained, as written
+	literal bool // the node is a constant: a literal, or a list of them
+}
+
+// Explain evaluates the Program against data, like Eval, recording every node
+// it visits. The result and error of the evaluation are those of the returned
+// root. It is meant for finding out why a rule decided as it did, not for
+// production traffic. It evaluates the AST as written, without the bytecode,
+// folded constants, shared sub-expressions or reordered conditions of the
+// optimizer, which change only its speed.
+func (p *Program) Explain(data any) *Explanation {
+	cp := *p
+	cp.code, cp.slots = nil, 0
+	ast, spans := p.ast, maps.Clone(p.spans)
+	if p.src != "" {
+		// Re-parse for the unoptimized tree, as Lint does.
+		if a, s, err := parseSource(p.src, len(p.src)+1); err == nil {
+			ast, spans = a, s
+		}
+	}
+	cp.spans = spans
+	var root *Explanation
+	cp.ast, root = cp.explainNode(ast)
+	v, err := cp.run(cp.context(data))
+	root.Evaluated, root.Value, root.Err = true, v, err
+	if err != nil {
+		root.Value = nil
+	}
+	return root
+}
+
+// explainNode returns a copy of e that records its evaluation in the returned
+// Explanation, as do the copies of its operands.
+func (p *Program) explainNode(e Expr) (Expr, *Explanation) {
+	switch n := e.(type) {
+	case *sharedExpr:
+		return p.explainNode(n.X)
+	case *chainExpr:
+		return p.explainNode(n.Written)
+	case *tableInput:
+		return p.explainNode(n.X)
+	}
+	_, lit := e.(*LiteralExpr)
+	x := &Explanation{Expr: e.String(), node: e, literal: lit}
+	if sp, ok := p.spans[e]; ok {
+		x.Start, x.End = sp.start, sp.end
+		if sp.end <= len(p.src) {
+			x.Expr = p.src[sp.start:sp.end]
+		}
+	}
+	sub := func(c Expr) Expr {
+		c, cx := p.explainNode(c)
+		x.Children = append(x.Children, cx)
+		return c
+	}
+	subs := func(cs []Expr) []Expr {
+		out := make([]Expr, len(cs))
+		for i, c := range cs {
+			out[i] = sub(c)
+		}
+		return out
+	}
+	var cp Expr
+	switch n := e.(type) {
+	case *UnaryExpr:
+		cp = &UnaryExpr{Op: n.Op, Right: sub(n.Right)}
+	case *InfixExpr:
+		cp = &InfixExpr{Left: sub(n.Left), Op: n.Op, Right: sub(n.Right)}
+	case *TernaryExpr:
+		cp = &TernaryExpr{Cond: sub(n.Cond), Then: sub(n.Then), Else: sub(n.Else)}
+	case *MemberAccessExpr:
+		cp = &MemberAccessExpr{Left: sub(n.Left), Key: n.Key}
+	case *IndexExpr:
+		cp = &IndexExpr{Left: sub(n.Left), Index: sub(n.Index)}
+	case *MethodCallExpr:
+		cp = &MethodCallExpr{Left: sub(n.Left), Method: n.Method, Args: subs(n.Args)}
+	case *CallExpr:
+		if _, macro := p.macros[n.key()]; macro {
+			cp = n
+		} else {
+			cp = &CallExpr{Name: n.Name, Args: subs(n.Args), lower: n.lower}
+		}
+	case *ListExpr:
+		cp = &ListExpr{Elems: subs(n.Elems)}
+		x.literal = !slices.ContainsFunc(x.Children, func(c *Explanation) bool { return !c.literal })
+	default: // literals, variables, bad nodes
+		cp = e
+	}
+	if sp, ok := p.spans[e]; ok {
+		p.spans[cp] = sp
+	}
+	return &explainExpr{X: cp, x: x}, x
+}
+
+// explainExpr evaluates X, recording the outcome in x.
+type explainExpr struct {
+	X Expr
+	x *Explanation
+}
+
+func (e *explainExpr) Eval(ctx Context) (any, error) {
+	v, err := e.X.Eval(ctx)
+	e.x.Evaluated = true
+	if err != nil {
+		e.x.Err = err
+	} else {
+		e.x.Value = v
+	}
+	return v, err
+}
+
+func (e *explainExpr) String() string { return e.X.String() }
+
+// failedHere reports whether x's error was born at x rather than passed up
+// from one of its children.
+func (x *Explanation) failedHere() bool {
+	for _, c := range x.Children {
+		if c.Err != nil && errors.Is(x.Err, c.Err) {
+			return false
+		}
+	}
+	return x.Err != nil
+}
+
+// String renders the tree, one node per line, indented under its parent:
+//
+//	amount < 100 && country in ['NL', 'BE'] => false
+//	  amount < 100 => true
+//	    amount => 50
+//	  country in ['NL', 'BE'] => false
+//	    country => 'DE'
+//
+// Literals evaluated, which are their own value, are left out; a node not
+// evaluated is marked so, and an error is shown where it was born.
+func (x *Explanation) String() string {
+	var sb strings.Builder
+	x.write(&sb, 0)
+	return sb.String()
+}
+
+func (x *Explanation) write(sb *strings.Builder, depth int) {
+	sb.WriteString(strings.Repeat("  ", depth))
+	sb.WriteString(x.Expr)
+	switch {
+	case !x.Evaluated:
+		sb.WriteString(" (not evaluated)")
+	case x.failedHere():
+		var oe *Error
+		if errors.As(x.Err, &oe) && oe.Err != nil {
+			fmt.Fprintf(sb, " => error: %v", oe.Err)
+		} else {
+			fmt.Fprintf(sb, " => error: %v", x.Err)
+		}
+	case x.Err != nil:
+		sb.WriteString(" => failed")
+	default:
+		sb.WriteString(" => " + renderLiteral(x.Value))
+	}
+	sb.WriteByte('\n')
+	for _, c := range x.Children {
+		if c.literal && c.Evaluated {
+			continue
+		}
+		c.write(sb, depth+1)
+	}
+}
+
+// MarshalJSON renders the tree for tooling:
+//
+//	{"expr": "amount < 100", "start": 0, "end": 12, "evaluated": true,
+//	 "value": true, "children": [...]}
+//
+// "value" is present when the node evaluated without error, "error" when it
+// failed; a value JSON cannot represent is rendered as okra source text.
+func (x *Explanation) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Expr      string          `json:"expr"`
+		Start     int             `json:"start"`
+		End       int             `json:"end"`
+		Evaluated bool            `json:"evaluated"`
+		Value     json.RawMessage `json:"value,omitempty"`
+		Error     string          `json:"error,omitempty"`
+		Children  []*Explanation  `json:"children,omitempty"`
+	}{Expr: x.Expr, Start: x.Start, End: x.End, Evaluated: x.Evaluated, Children: x.Children}
+	switch {
+	case x.Err != nil:
+		out.Error = x.Err.Error()
+	case x.Evaluated:
+		v, err := json.Marshal(x.Value)
+		if err != nil {
+			v, _ = json.Marshal(renderLiteral(x.Value))
+		}
+		out.Value = v
+	}
+	// HTML escaping, if wanted, is the outermost encoder's to apply.
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(out); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
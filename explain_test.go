@@ -0,0 +1,138 @@
+package okra
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	e := NewEngine()
+	for _, opt := range []Optimization{0, OptAll} {
+		e.SetOptimizations(opt)
+		p, err := e.Compile("amount < 100 && country in ['NL', 'BE'] || vip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		x := p.Explain(map[string]any{"amount": int64(50), "country": "DE", "vip": false})
+		want := `amount < 100 && country in ['NL', 'BE'] || vip => false
+  amount < 100 && country in ['NL', 'BE'] => false
+    amount < 100 => true
+      amount => 50
+    country in ['NL', 'BE'] => false
+      country => 'DE'
+  vip => false
+`
+		if got := x.String(); got != want {
+			t.Errorf("optimizations %v:\n%s\nwant\n%s", opt, got, want)
+		}
+
+		x = p.Explain(map[string]any{"amount": int64(500), "vip": true})
+		and := x.Children[0]
+		if x.Value != true || and.Value != false || !and.Children[0].Evaluated || and.Children[1].Evaluated {
+			t.Errorf("optimizations %v: short circuit not recorded:\n%s", opt, x)
+		}
+		if c := and.Children[1]; c.Expr != "country in ['NL', 'BE']" || c.Start != 16 || c.End != 39 {
+			t.Errorf("span of %q: %d-%d", c.Expr, c.Start, c.End)
+		}
+	}
+}
+
+func TestExplainBranchesAndErrors(t *testing.T) {
+	e := NewEngine()
+	e.SetStrict(true)
+	p, err := e.Compile("tier == 'gold' ? total / count : 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := p.Explain(map[string]any{"tier": "gold", "total": int64(10), "count": int64(0)})
+	want := `tier == 'gold' ? total / count : 0 => failed
+  tier == 'gold' => true
+    tier => 'gold'
+  total / count => error: division by zero
+    total => 10
+    count => 0
+  0 (not evaluated)
+`
+	if got := x.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	var oe *Error
+	if !errors.Is(x.Err, ErrDivByZero) || !errors.As(x.Err, &oe) || oe.Line != 1 || oe.Column != 18 {
+		t.Fatalf("root error %v", x.Err)
+	}
+	if _, err := p.Eval(map[string]any{"tier": "gold", "total": int64(10), "count": int64(0)}); err.Error() != x.Err.Error() {
+		t.Fatalf("Eval %v, Explain %v", err, x.Err)
+	}
+
+	// Operands after a failure are not reached; macro arguments are opaque.
+	registerAnyAll(t, e)
+	p, err = e.Compile("missing + 1 > 2 && any(xs, v > 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	x = p.Explain(map[string]any{"xs": []any{map[string]any{"v": int64(1)}}})
+	if !strings.Contains(x.String(), "missing => error: map has no key") || x.Children[1].Evaluated {
+		t.Errorf("got\n%s", x)
+	}
+	x = p.Explain(map[string]any{"missing": int64(5), "xs": []any{map[string]any{"v": int64(3)}}})
+	if call := x.Children[1]; x.Value != true || call.Expr != "any(xs, v > 1)" || call.Value != true || len(call.Children) != 0 {
+		t.Errorf("macro call:\n%s", x)
+	}
+}
+
+func TestExplainJSON(t *testing.T) {
+	p, err := NewEngine().Compile("a > 1 || b / 0 > 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(p.Explain(map[string]any{"a": int64(2), "b": func() {}})); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"expr":"a > 1 || b / 0 > 1","start":0,"end":18,"evaluated":true,"value":true,"children":[` +
+		`{"expr":"a > 1","start":0,"end":5,"evaluated":true,"value":true,"children":[` +
+		`{"expr":"a","start":0,"end":1,"evaluated":true,"value":2},` +
+		`{"expr":"1","start":4,"end":5,"evaluated":true,"value":1}]},` +
+		`{"expr":"b / 0 > 1","start":9,"end":18,"evaluated":false,"children":[` +
+		`{"expr":"b / 0","start":9,"end":14,"evaluated":false,"children":[` +
+		`{"expr":"b","start":9,"end":10,"evaluated":false},` +
+		`{"expr":"0","start":13,"end":14,"evaluated":false}]},` +
+		`{"expr":"1","start":17,"end":18,"evaluated":false}]}]}`
+	if got := strings.TrimSpace(sb.String()); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+// Explain shows the rule as written: the list is not the optimizer's
+// indexed set, and 1 + 2 is not folded away.
+func TestExplainAsWritten(t *testing.T) {
+	p, err := NewEngine().Compile("x in [1, 2, 3] && 1 + 2 > x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(p.Explain(map[string]any{"x": int64(2)})); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"expr":"x in [1, 2, 3] && 1 + 2 > x","start":0,"end":27,"evaluated":true,"value":true,"children":[` +
+		`{"expr":"x in [1, 2, 3]","start":0,"end":14,"evaluated":true,"value":true,"children":[` +
+		`{"expr":"x","start":0,"end":1,"evaluated":true,"value":2},` +
+		`{"expr":"[1, 2, 3]","start":5,"end":14,"evaluated":true,"value":[1,2,3],"children":[` +
+		`{"expr":"1","start":6,"end":7,"evaluated":true,"value":1},` +
+		`{"expr":"2","start":9,"end":10,"evaluated":true,"value":2},` +
+		`{"expr":"3","start":12,"end":13,"evaluated":true,"value":3}]}]},` +
+		`{"expr":"1 + 2 > x","start":18,"end":27,"evaluated":true,"value":true,"children":[` +
+		`{"expr":"1 + 2","start":18,"end":23,"evaluated":true,"value":3,"children":[` +
+		`{"expr":"1","start":18,"end":19,"evaluated":true,"value":1},` +
+		`{"expr":"2","start":22,"end":23,"evaluated":true,"value":2}]},` +
+		`{"expr":"x","start":26,"end":27,"evaluated":true,"value":2}]}]}`
+	if got := strings.TrimSpace(sb.String()); got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
@@ -619,10 +619,11 @@ func TestStringRoundTrip(t *testing.T) {
 // evalAST is a tiny test helper to evaluate a pre-built AST with default funcs.
 func (e *Engine) evalAST(ast Expr) (any, error) {
 	src := NewEngine()
+	calls := src.loadCallables()
 	return (&Program{
 		ast:          ast,
-		fns:          src.loadFuncs(),
-		macros:       src.loadMacros(),
+		fns:          calls.funcs,
+		macros:       calls.macros,
 		strict:       src.strict.Load(),
 		methodFilter: src.methodFilterFn(),
 	}).Eval(nil)
@@ -649,6 +650,7 @@ func FuzzEvalNeverPanics(f *testing.F) {
 			_, _ = prog.Eval(data)
 		}
 		_, _ = ParseExpr(expr)
+		_, _ = ParseAll(expr)
 	})
 }
 
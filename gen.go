@@ -0,0 +1,1196 @@
+package okra
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	gotoken "go/token"
+	"maps"
+	"math"
+	"path"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GenConfig configures GenerateGo.
+type GenConfig struct {
+	// Package is the package clause of the generated file.
+	Package string
+	// ImportPath is the import path of that package, so types declared in it
+	// are referred to unqualified. Leave it empty when the file lives outside
+	// the packages of DataType.
+	ImportPath string
+	// DataType is the type of the data parameter of every generated function:
+	// the static counterpart of the value passed to Program.Eval.
+	DataType reflect.Type
+}
+
+// GenFunc names a Program to emit as a Go function.
+type GenFunc struct {
+	Name    string
+	Program *Program
+}
+
+// GenerateGo emits a Go source file with one function per GenFunc,
+//
+//	func Name(data T) (R, error)
+//
+// where T is cfg.DataType and R the static type of the expression. Each
+// function computes exactly what Program.Eval computes for a data value of type
+// T — the same result with the same dynamic type, and on failure an *Error with
+// the same Kind, Expr, position, Cause and message — without an interpreter:
+// member access compiles to selectors with the strict-mode miss checks,
+// arithmetic to inline overflow-checked Go, literal lists on the right of `in`
+// to switches. The one difference is that a missing map key's message carries
+// no "did you mean" suggestions.
+//
+// Generation is static, so it refuses what it cannot resolve from T: a lenient
+// Program or one compiled with OptReorder, macros and custom functions,
+// methods and getters, has/get, operations on interface-typed values, and any
+// operation that fails whatever the data holds (an unknown field, `name + 1`,
+// a float `%`). The error names the function and the failing sub-expression.
+// The generated code imports okra for *Error and the sentinel errors.
+func GenerateGo(cfg GenConfig, funcs ...GenFunc) ([]byte, error) {
+	if !gotoken.IsIdentifier(cfg.Package) {
+		return nil, fmt.Errorf("okra: invalid package name %q", cfg.Package)
+	}
+	if cfg.DataType == nil {
+		return nil, errors.New("okra: GenConfig.DataType is nil")
+	}
+	g := &generator{cfg: cfg, names: map[string]string{}, std: map[string]bool{}}
+	seen := map[string]bool{}
+	var body bytes.Buffer
+	for _, fn := range funcs {
+		if !gotoken.IsIdentifier(fn.Name) || seen[fn.Name] {
+			return nil, fmt.Errorf("okra: invalid or duplicate function name %q", fn.Name)
+		}
+		seen[fn.Name] = true
+		code, err := g.function(fn)
+		if err != nil {
+			return nil, err
+		}
+		body.WriteString(code)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by okra-gen. DO NOT EDIT.\n\npackage %s\n\n", cfg.Package)
+	out.WriteString(g.imports())
+	out.Write(body.Bytes())
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("okra: generated code does not parse: %w", err)
+	}
+	return src, nil
+}
+
+var (
+	anyType     = reflect.TypeFor[any]()
+	boolType    = reflect.TypeFor[bool]()
+	stringType  = reflect.TypeFor[string]()
+	int64Type   = reflect.TypeFor[int64]()
+	float64Type = reflect.TypeFor[float64]()
+	listType    = reflect.TypeFor[[]any]()
+	timeType    = reflect.TypeFor[time.Time]()
+)
+
+// genStd are the packages generated code may import, by the name it uses for
+// them. Data packages never take these names.
+var genStd = map[string]string{
+	"errors":  "errors",
+	"fmt":     "fmt",
+	"math":    "math",
+	"strings": "strings",
+	"time":    "time",
+	"okra":    reflect.TypeFor[Error]().PkgPath(),
+}
+
+// builtinFuncs identifies the built-ins by code pointer, so a Program whose
+// Engine re-registered one of their names is not mistaken for the original.
+var builtinFuncs = defaultFuncs()
+
+// generator is the state shared by the functions of one generated file.
+type generator struct {
+	cfg   GenConfig
+	names map[string]string // import name -> path, for data packages
+	std   map[string]bool   // genStd entries in use
+}
+
+// genError aborts generation at node (nil when the failure is not tied to
+// one, e.g. an unnameable type).
+type genError struct {
+	node Expr
+	msg  string
+}
+
+func genFail(node Expr, format string, args ...any) {
+	panic(genError{node, fmt.Sprintf(format, args...)})
+}
+
+// zeroMark stands for the zero value of a function's result type in its body,
+// which is only known once the whole expression is generated.
+const zeroMark = "\x00zero\x00"
+
+func (g *generator) function(fn GenFunc) (code string, err error) {
+	p := fn.Program
+	if p == nil {
+		return "", fmt.Errorf("okra: %s: nil Program", fn.Name)
+	}
+	if !p.strict {
+		return "", fmt.Errorf("okra: %s: code generation needs a strict Program", fn.Name)
+	}
+	f := &funcGen{g: g, p: p, body: &strings.Builder{}, checked: map[string]bool{}}
+	defer func() {
+		if r := recover(); r != nil {
+			ge, ok := r.(genError)
+			if !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("okra: %s: %s", fn.Name, f.describe(ge))
+		}
+	}()
+	data := g.typeName(g.cfg.DataType)
+	res := f.expr(p.ast)
+	result := g.typeName(res.t)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "// %s evaluates the okra expression\n//\n", fn.Name)
+	for line := range strings.SplitSeq(p.src, "\n") {
+		fmt.Fprintf(&sb, "//\t%s\n", line)
+	}
+	fmt.Fprintf(&sb, "func %s(data %s) (%s, error) {\n", fn.Name, data, result)
+	fmt.Fprintf(&sb, "const src = %s\n", strconv.Quote(p.src))
+	sb.WriteString(strings.ReplaceAll(f.body.String(), zeroMark, g.zero(res.t)))
+	fmt.Fprintf(&sb, "return %s, nil\n}\n\n", bare(res.x))
+	return sb.String(), nil
+}
+
+func (g *generator) imports() string {
+	var std, data []string
+	for name := range g.std {
+		if name == "okra" {
+			data = append(data, strconv.Quote(genStd[name]))
+		} else {
+			std = append(std, strconv.Quote(name))
+		}
+	}
+	for name, p := range g.names {
+		if name == path.Base(p) {
+			data = append(data, strconv.Quote(p))
+		} else {
+			data = append(data, name+" "+strconv.Quote(p))
+		}
+	}
+	if len(std)+len(data) == 0 {
+		return ""
+	}
+	sort.Strings(std)
+	sort.Slice(data, func(i, j int) bool { return importPath(data[i]) < importPath(data[j]) })
+	var sb strings.Builder
+	sb.WriteString("import (\n")
+	for _, s := range std {
+		sb.WriteString(s + "\n")
+	}
+	if len(std) > 0 && len(data) > 0 {
+		sb.WriteString("\n")
+	}
+	for _, s := range data {
+		sb.WriteString(s + "\n")
+	}
+	sb.WriteString(")\n\n")
+	return sb.String()
+}
+
+func importPath(spec string) string { return spec[strings.IndexByte(spec, '"'):] }
+
+// use marks a genStd package as imported and returns its name.
+func (g *generator) use(name string) string {
+	g.std[name] = true
+	return name
+}
+
+// typeName renders t as a Go type expression in the generated package.
+func (g *generator) typeName(t reflect.Type) string {
+	if t == anyType {
+		return "any"
+	}
+	if t.Name() != "" {
+		switch {
+		case t.PkgPath() == "":
+			return t.Name() // predeclared
+		case strings.ContainsRune(t.Name(), '['):
+			genFail(nil, "generic type %s is not supported", t)
+		case t.PkgPath() == g.cfg.ImportPath:
+			return t.Name()
+		case t == timeType:
+			return g.use("time") + ".Time"
+		case !gotoken.IsExported(t.Name()) || t.PkgPath() == "main":
+			genFail(nil, "type %s is not accessible from package %s", t, g.cfg.Package)
+		}
+		return g.pkgName(t) + "." + t.Name()
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return "*" + g.typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + g.typeName(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), g.typeName(t.Elem()))
+	case reflect.Map:
+		return "map[" + g.typeName(t.Key()) + "]" + g.typeName(t.Elem())
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "any"
+		}
+	}
+	genFail(nil, "type %s cannot be named in generated code", t)
+	return ""
+}
+
+// pkgName returns the import name of the package declaring the named type t,
+// importing it under its own name unless that is taken.
+func (g *generator) pkgName(t reflect.Type) string {
+	p := t.PkgPath()
+	base := strings.TrimSuffix(t.String(), "."+t.Name())
+	name := base
+	for i := 2; ; i++ {
+		if q, ok := g.names[name]; ok && q == p {
+			return name
+		}
+		if _, taken := g.names[name]; !taken && genStd[name] == "" && name != "data" && name != "src" {
+			g.names[name] = p
+			return name
+		}
+		name = base + strconv.Itoa(i)
+	}
+}
+
+// zero renders the zero value of t.
+func (g *generator) zero(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "false"
+	case reflect.String:
+		return `""`
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return "nil"
+	case reflect.Struct, reflect.Array:
+		return g.typeName(t) + "{}"
+	}
+	return "0"
+}
+
+// funcGen generates the body of one function. Every sub-expression becomes a
+// gval: a side-effect-free Go expression, over the data parameter and
+// temporaries assigned by earlier statements, with the static type of the
+// value the interpreter would produce.
+type funcGen struct {
+	g    *generator
+	p    *Program
+	body *strings.Builder
+	n    int
+	// checked holds the pointers known to be non-nil at the current point
+	// of the body.
+	checked map[string]bool
+}
+
+type gval struct {
+	x string
+	t reflect.Type
+}
+
+func (f *funcGen) describe(ge genError) string {
+	if ge.node == nil {
+		return ge.msg
+	}
+	if sp, ok := f.p.spans[ge.node]; ok {
+		line, col := lineCol(f.p.src, sp.start)
+		return fmt.Sprintf("%d:%d: %s: %s", line, col, ge.node, ge.msg)
+	}
+	return fmt.Sprintf("%s: %s", ge.node, ge.msg)
+}
+
+func (f *funcGen) line(format string, args ...any) {
+	fmt.Fprintf(f.body, format, args...)
+	f.body.WriteByte('\n')
+}
+
+func (f *funcGen) temp() string {
+	f.n++
+	return "v" + strconv.Itoa(f.n)
+}
+
+// bind assigns v to a temporary unless it already is a variable. Operands are
+// bound before arithmetic so the Go compiler never folds (and rejects) a
+// constant overflow the interpreter reports at run time.
+func (f *funcGen) bind(v gval) gval {
+	if gotoken.IsIdentifier(v.x) {
+		return v
+	}
+	t := f.temp()
+	f.line("%s := %s", t, bare(v.x))
+	return gval{t, v.t}
+}
+
+// discard keeps an operand whose value does not matter in use, so the Go
+// compiler accepts the temporaries its evaluation declared.
+func (f *funcGen) discard(v gval) { f.line("_ = %s", bare(v.x)) }
+
+// failIf returns an evaluation *Error born at node when cond holds. errX is
+// the Go expression of the underlying error, cause the name of its sentinel
+// (or "").
+func (f *funcGen) failIf(cond string, node Expr, errX, cause string) {
+	f.line("if %s {", bare(cond))
+	okra := f.g.use("okra")
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "return %s, &%s.Error{Kind: %s.KindEval", zeroMark, okra, okra)
+	if sp, ok := f.p.spans[node]; ok {
+		line, col := lineCol(f.p.src, sp.start)
+		fmt.Fprintf(&sb, ", Line: %d, Column: %d, Start: %d, End: %d", line, col, sp.start, sp.end)
+	}
+	fmt.Fprintf(&sb, ", Expr: %s, Source: src", strconv.Quote(node.String()))
+	if cause != "" {
+		fmt.Fprintf(&sb, ", Cause: %s.%s", okra, cause)
+	}
+	fmt.Fprintf(&sb, ", Err: %s}", errX)
+	f.line("%s", sb.String())
+	f.line("}")
+}
+
+// nilCheck fails at node when the pointer x is nil, unless an earlier check
+// already covers this point.
+func (f *funcGen) nilCheck(x string, node Expr, errX, cause string) {
+	if !f.checked[x] {
+		f.failIf(x+" == nil", node, errX, cause)
+		f.checked[x] = true
+	}
+}
+
+// block generates a nested block with gen: the checks made inside do not hold
+// after it.
+func (f *funcGen) block(gen func()) {
+	outer := maps.Clone(f.checked)
+	gen()
+	f.checked = outer
+}
+
+// sentinel is the error expression of a bare sentinel error.
+func (f *funcGen) sentinel(name string) string { return f.g.use("okra") + "." + name }
+
+// missErr is the error expression of a strict-mode miss: format with the Go
+// expressions args, wrapping ErrUnknownField.
+func (f *funcGen) missErr(format string, args ...string) string {
+	return fmt.Sprintf("%s.Errorf(%s, %s%s.ErrUnknownField)",
+		f.g.use("fmt"), strconv.Quote(format+": %w"), joinArgs(args), f.g.use("okra"))
+}
+
+func joinArgs(args []string) string {
+	var sb strings.Builder
+	for _, a := range args {
+		sb.WriteString(bare(a) + ", ")
+	}
+	return sb.String()
+}
+
+func (f *funcGen) expr(e Expr) gval {
+	switch n := e.(type) {
+	case *sharedExpr:
+		// Recomputing is cheaper than sharing across the branches of the
+		// generated code, and the value is the same.
+		return f.expr(n.X)
+	case *LiteralExpr:
+		return gval{f.constant(n, n.Value), constType(n.Value)}
+	case *ListExpr:
+		elems := make([]string, len(n.Elems))
+		for i, el := range n.Elems {
+			elems[i] = bare(f.expr(el).x)
+		}
+		return f.bind(gval{"[]any{" + strings.Join(elems, ", ") + "}", listType})
+	case *VariableExpr:
+		return f.member(n, gval{"data", f.g.cfg.DataType}, n.Name)
+	case *MemberAccessExpr:
+		return f.member(n, f.expr(n.Left), n.Key)
+	case *IndexExpr:
+		return f.index(n)
+	case *UnaryExpr:
+		return f.unary(n)
+	case *InfixExpr:
+		return f.infix(n)
+	case *TernaryExpr:
+		return f.ternary(n)
+	case *CallExpr:
+		return f.call(n)
+	case *MethodCallExpr:
+		if n.Method == "len" && len(n.Args) == 0 {
+			if v, ok := f.length(f.expr(n.Left)); ok {
+				return v
+			}
+		}
+		genFail(n, "method calls are not supported")
+	case *chainExpr:
+		// Its results may differ from the chain as written on failure, and the
+		// order of OptSelectivity changes at run time.
+		genFail(n, "reordered chains are not supported; compile without OptReorder")
+	}
+	genFail(e, "unsupported expression %T", e)
+	return gval{}
+}
+
+func constType(v any) reflect.Type {
+	if _, ok := v.(*valueSet); ok {
+		return listType
+	}
+	return reflect.TypeOf(v)
+}
+
+// constant renders a literal's value.
+func (f *funcGen) constant(node Expr, v any) string {
+	switch x := v.(type) {
+	case bool:
+		return strconv.FormatBool(x)
+	case int64:
+		return fmt.Sprintf("int64(%d)", x)
+	case float64:
+		return "float64(" + f.floatLit(x) + ")"
+	case string:
+		return strconv.Quote(x)
+	case time.Time:
+		loc := f.g.use("time") + ".UTC"
+		if x.Location() != time.UTC {
+			name, off := x.Zone()
+			loc = fmt.Sprintf("time.FixedZone(%q, %d)", name, off)
+		}
+		return fmt.Sprintf("time.Date(%d, %d, %d, %d, %d, %d, %d, %s)",
+			x.Year(), x.Month(), x.Day(), x.Hour(), x.Minute(), x.Second(), x.Nanosecond(), loc)
+	case *valueSet:
+		return f.constant(node, x.list)
+	case []any:
+		elems := make([]string, len(x))
+		for i, el := range x {
+			elems[i] = f.constant(node, el)
+		}
+		return "[]any{" + strings.Join(elems, ", ") + "}"
+	}
+	genFail(node, "cannot generate a constant of type %T", v)
+	return ""
+}
+
+// floatLit renders x as a Go expression of exactly that float64.
+func (f *funcGen) floatLit(x float64) string {
+	switch {
+	case math.IsInf(x, 0):
+		return fmt.Sprintf("%s.Inf(%d)", f.g.use("math"), int(math.Copysign(1, x)))
+	case math.IsNaN(x):
+		return f.g.use("math") + ".NaN()"
+	case x == 0 && math.Signbit(x):
+		return f.g.use("math") + ".Copysign(0, -1)"
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+// dynamic gives an interface-typed member its dynamic value, as Interface()
+// does for the interpreter.
+func dynamic(v gval) gval {
+	if v.t.Kind() == reflect.Interface && v.t != anyType {
+		return gval{"any(" + v.x + ")", anyType}
+	}
+	return v
+}
+
+// member implements getMember(obj, key) for a statically typed obj.
+func (f *funcGen) member(node Expr, obj gval, key string) gval {
+	x, t := obj.x, obj.t
+	if t == anyType {
+		genFail(node, "cannot access %q on a value of unknown type", key)
+	}
+	for t.Kind() == reflect.Pointer {
+		f.nilCheck(x, node, f.missErr("cannot access %q on nil", strconv.Quote(key)), "ErrUnknownField")
+		x, t = "(*"+x+")", t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		meta := getStructMeta(t)
+		path, ok := meta.fields[key]
+		if !ok {
+			if _, ok := meta.methods[key]; ok {
+				genFail(node, "getter %s is not supported", key)
+			}
+			genFail(node, "unknown field %q on %s", key, t)
+		}
+		for i, idx := range path {
+			sf := t.Field(idx)
+			x, t = x+"."+sf.Name, sf.Type
+			if i < len(path)-1 && t.Kind() == reflect.Pointer {
+				f.nilCheck(x, node, f.missErr("cannot access %q through nil embedded pointer", strconv.Quote(key)), "ErrUnknownField")
+				t = t.Elem()
+			}
+		}
+		return dynamic(gval{x, t})
+	case reflect.Map:
+		if t.Key() != stringType {
+			genFail(node, "member access on %s is not supported", t)
+		}
+		v := f.temp()
+		f.line("%s, ok := %s[%s]", v, x, strconv.Quote(key))
+		f.failIf("!ok", node, f.missErr("map has no key %q", strconv.Quote(key)), "ErrUnknownField")
+		return dynamic(gval{v, t.Elem()})
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || t.Kind() == reflect.Array && i >= t.Len() {
+			genFail(node, "index %q out of range", key)
+		}
+		if t.Kind() == reflect.Slice {
+			f.failIf(fmt.Sprintf("len(%s) <= %d", x, i), node,
+				f.missErr("index %q out of range (len %d)", strconv.Quote(key), "len("+x+")"), "ErrUnknownField")
+		}
+		return dynamic(gval{fmt.Sprintf("%s[%d]", x, i), t.Elem()})
+	}
+	genFail(node, "cannot access %q on %s", key, t)
+	return gval{}
+}
+
+// index implements indexValue(obj, idx).
+func (f *funcGen) index(n *IndexExpr) gval {
+	obj := f.expr(n.Left)
+	idx := f.expr(n.Index)
+	x, t := obj.x, obj.t
+	if t == anyType || idx.t == anyType {
+		genFail(n, "cannot index with a value of unknown type")
+	}
+	for t.Kind() == reflect.Pointer {
+		f.nilCheck(x, n, f.missErr("cannot index nil"), "ErrUnknownField")
+		x, t = "(*"+x+")", t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if !isInt(idx.t) {
+			genFail(n, "non-integer index of type %s", idx.t)
+		}
+		// Always a variable, so an out-of-range constant index into an array
+		// fails at run time like the interpreter, not at compile time.
+		i := f.temp()
+		f.line("%s := %s", i, int64Of(idx))
+		f.failIf(fmt.Sprintf("%s < 0 || %s >= int64(len(%s))", i, i, x), n,
+			f.missErr("index %d out of range (len %d)", i, "len("+x+")"), "ErrUnknownField")
+		return dynamic(gval{x + "[" + i + "]", t.Elem()})
+	case reflect.Map:
+		kt := t.Key()
+		var key string
+		switch {
+		case idx.t.AssignableTo(kt):
+			key = idx.x
+		case isNum(idx.t) && isNum(kt):
+			key = f.g.typeName(kt) + "(" + f.bind(idx).x + ")"
+		default:
+			genFail(n, "invalid map key of type %s for %s", idx.t, t)
+		}
+		v := f.temp()
+		f.line("%s, ok := %s[%s]", v, x, bare(key))
+		verb := "%v"
+		if idx.t == stringType {
+			verb = "%q"
+		}
+		f.failIf("!ok", n, f.missErr("map has no key "+verb, idx.x), "ErrUnknownField")
+		return dynamic(gval{v, t.Elem()})
+	}
+	genFail(n, "cannot index %s", t)
+	return gval{}
+}
+
+// isInt reports whether toInt64 accepts every value of t. uint, uint64 and
+// uintptr are left out: their values above MaxInt64 are not numbers to the
+// interpreter.
+func isInt(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return true
+	}
+	return false
+}
+
+// isNum reports whether toNumber accepts every value of t.
+func isNum(t reflect.Type) bool {
+	return isInt(t) || t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+}
+
+func int64Of(v gval) string {
+	if v.t == int64Type {
+		return v.x
+	}
+	return "int64(" + bare(v.x) + ")"
+}
+
+func float64Of(v gval) string {
+	if v.t == float64Type {
+		return v.x
+	}
+	return "float64(" + bare(v.x) + ")"
+}
+
+func (f *funcGen) unary(n *UnaryExpr) gval {
+	v := f.expr(n.Right)
+	switch {
+	case n.Op == "!" && v.t == boolType:
+		return gval{"(!" + v.x + ")", boolType}
+	case n.Op == "-" && isInt(v.t):
+		i := f.bind(gval{int64Of(v), int64Type})
+		f.failIf(i.x+" == math.MinInt64", n, f.sentinel("ErrIntOverflow"), "ErrIntOverflow")
+		f.g.use("math")
+		return gval{"(-" + i.x + ")", int64Type}
+	case n.Op == "-" && isNum(v.t):
+		return gval{"(-" + float64Of(v) + ")", float64Type}
+	case n.Op == "~" && isInt(v.t):
+		return gval{"(^" + int64Of(v) + ")", int64Type}
+	}
+	genFail(n, "invalid unary %s for %s", n.Op, v.t)
+	return gval{}
+}
+
+func (f *funcGen) infix(n *InfixExpr) gval {
+	switch n.Op {
+	case "&&", "||":
+		return f.logic(n)
+	case "in", "not in":
+		x := f.in(n, f.expr(n.Left), n.Right)
+		if n.Op == "not in" {
+			x = negate(x)
+		}
+		return gval{x, boolType}
+	}
+	l, r := f.expr(n.Left), f.expr(n.Right)
+	switch n.Op {
+	case "==", "!=":
+		x := f.equal(n, l, r)
+		if x == "false" {
+			f.discard(l)
+			f.discard(r)
+		}
+		if n.Op == "!=" {
+			x = negate(x)
+		}
+		return gval{x, boolType}
+	case "+", "-", "*", "/", "%":
+		return f.arith(n, l, r)
+	case ">", "<", ">=", "<=":
+		return gval{f.compare(n, l, r), boolType}
+	case "&", "|", "^", "<<", ">>":
+		if !isInt(l.t) || !isInt(r.t) {
+			genFail(n, "invalid bitwise op %s between %s and %s", n.Op, l.t, r.t)
+		}
+		a, b := f.bind(gval{int64Of(l), int64Type}), f.bind(gval{int64Of(r), int64Type})
+		if n.Op == "<<" || n.Op == ">>" {
+			f.failIf(b.x+" < 0", n, f.sentinel("ErrNegativeShift"), "ErrNegativeShift")
+			return gval{"(" + a.x + " " + n.Op + " uint64(" + b.x + "))", int64Type}
+		}
+		return gval{"(" + a.x + " " + n.Op + " " + b.x + ")", int64Type}
+	}
+	genFail(n, "unknown operator %q", n.Op)
+	return gval{}
+}
+
+func negate(x string) string {
+	switch x {
+	case "true":
+		return "false"
+	case "false":
+		return "true"
+	}
+	return "(!" + x + ")"
+}
+
+func (f *funcGen) logic(n *InfixExpr) gval {
+	l := f.expr(n.Left)
+	if l.t != boolType {
+		genFail(n, "expected bool condition, got %s", l.t)
+	}
+	v := f.temp()
+	if n.Op == "&&" {
+		f.line("%s := false", v)
+		f.line("if %s {", bare(l.x))
+	} else {
+		f.line("%s := true", v)
+		f.line("if !%s {", l.x)
+	}
+	f.block(func() {
+		r := f.expr(n.Right)
+		if r.t != boolType {
+			genFail(n, "expected bool condition, got %s", r.t)
+		}
+		f.line("%s = %s", v, bare(r.x))
+	})
+	f.line("}")
+	return gval{v, boolType}
+}
+
+// scalar reports whether valuesEqual compares t by the scalar rules: exact
+// strings, exact bools, times, and numbers.
+func scalar(t reflect.Type) bool {
+	return t == stringType || t == boolType || t == timeType || isNum(t)
+}
+
+// equal renders valuesEqual(l, r), or "false" when it cannot hold.
+func (f *funcGen) equal(node Expr, l, r gval) string {
+	switch {
+	case l.t == anyType || r.t == anyType:
+		genFail(node, "cannot compare a value of unknown type")
+	case l.t == r.t && (l.t == stringType || l.t == boolType || l.t == int64Type || l.t == float64Type):
+		return "(" + l.x + " == " + r.x + ")"
+	case l.t == timeType && r.t == timeType:
+		return l.x + ".Equal(" + bare(r.x) + ")"
+	case isNum(l.t) && isNum(r.t):
+		// Every other numeric pair compares as float64, like the interpreter.
+		return "(" + float64Of(l) + " == " + float64Of(r) + ")"
+	case scalar(l.t) && scalar(r.t):
+		return "false"
+	}
+	genFail(node, "equality between %s and %s is not supported", l.t, r.t)
+	return ""
+}
+
+func (f *funcGen) arith(n *InfixExpr, l, r gval) gval {
+	op := n.Op
+	if op == "+" && (l.t == stringType || r.t == stringType) {
+		if l.t != stringType || r.t != stringType {
+			genFail(n, "invalid + between %s and %s", l.t, r.t)
+		}
+		return gval{"(" + l.x + " + " + r.x + ")", stringType}
+	}
+	if isInt(l.t) && isInt(r.t) {
+		a, b := f.bind(gval{int64Of(l), int64Type}).x, f.bind(gval{int64Of(r), int64Type}).x
+		f.g.use("math")
+		overflow := func(cond string) {
+			f.failIf(cond, n, f.sentinel("ErrIntOverflow"), "ErrIntOverflow")
+		}
+		switch op {
+		case "+":
+			overflow(fmt.Sprintf("(%[2]s > 0 && %[1]s > math.MaxInt64-%[2]s) || (%[2]s < 0 && %[1]s < math.MinInt64-%[2]s)", a, b))
+		case "-":
+			overflow(fmt.Sprintf("(%[2]s < 0 && %[1]s > math.MaxInt64+%[2]s) || (%[2]s > 0 && %[1]s < math.MinInt64+%[2]s)", a, b))
+		case "*":
+			overflow(fmt.Sprintf("%[1]s != 0 && %[2]s != 0 && (%[1]s == math.MinInt64 && %[2]s == -1 || %[2]s == math.MinInt64 && %[1]s == -1 || %[1]s*%[2]s/%[2]s != %[1]s)", a, b))
+		case "/":
+			f.failIf(b+" == 0", n, f.sentinel("ErrDivByZero"), "ErrDivByZero")
+			overflow(fmt.Sprintf("%s == math.MinInt64 && %s == -1", a, b))
+		case "%":
+			f.failIf(b+" == 0", n, f.sentinel("ErrModByZero"), "ErrModByZero")
+		}
+		return gval{"(" + a + " " + op + " " + b + ")", int64Type}
+	}
+	if !isNum(l.t) || !isNum(r.t) {
+		genFail(n, "invalid arithmetic %s between %s and %s", op, l.t, r.t)
+	}
+	if op == "%" {
+		genFail(n, "%s", ErrFloatModulo)
+	}
+	a, b := f.bind(gval{float64Of(l), float64Type}).x, f.bind(gval{float64Of(r), float64Type}).x
+	if op == "/" {
+		f.failIf(b+" == 0", n, f.sentinel("ErrDivByZero"), "ErrDivByZero")
+	}
+	return gval{"(" + a + " " + op + " " + b + ")", float64Type}
+}
+
+func (f *funcGen) compare(n *InfixExpr, l, r gval) string {
+	switch {
+	case l.t == timeType && r.t == timeType:
+		switch n.Op {
+		case ">":
+			return l.x + ".After(" + bare(r.x) + ")"
+		case "<":
+			return l.x + ".Before(" + bare(r.x) + ")"
+		case ">=":
+			return "(!" + l.x + ".Before(" + bare(r.x) + "))"
+		default:
+			return "(!" + l.x + ".After(" + bare(r.x) + "))"
+		}
+	case l.t == stringType && r.t == stringType:
+		return "(" + l.x + " " + n.Op + " " + r.x + ")"
+	case isNum(l.t) && isNum(r.t):
+		return "(" + float64Of(l) + " " + n.Op + " " + float64Of(r) + ")"
+	}
+	genFail(n, "invalid comparison between %s and %s", l.t, r.t)
+	return ""
+}
+
+func (f *funcGen) ternary(n *TernaryExpr) gval {
+	c := f.expr(n.Cond)
+	if c.t != boolType {
+		genFail(n.Cond, "expected bool condition, got %s", c.t)
+	}
+	outer := f.body
+	var a, b gval
+	f.body = &strings.Builder{}
+	f.block(func() { a = f.expr(n.Then) })
+	then := f.body.String()
+	f.body = &strings.Builder{}
+	f.block(func() { b = f.expr(n.Else) })
+	els := f.body.String()
+	f.body = outer
+
+	t := a.t
+	if b.t != t {
+		t = anyType
+	}
+	v := f.temp()
+	f.line("var %s %s", v, f.g.typeName(t))
+	f.line("if %s {", bare(c.x))
+	f.body.WriteString(then)
+	f.line("%s = %s", v, bare(a.x))
+	f.line("} else {")
+	f.body.WriteString(els)
+	f.line("%s = %s", v, bare(b.x))
+	f.line("}")
+	return gval{v, t}
+}
+
+func (f *funcGen) call(n *CallExpr) gval {
+	name := n.key()
+	if _, ok := f.p.macros[name]; ok {
+		genFail(n, "macro %s is not supported", n.Name)
+	}
+	fn, ok := f.p.fns[name]
+	if !ok {
+		genFail(n, "%s is not a function; methods on data are not supported", n.Name)
+	}
+	builtin, ok := builtinFuncs[name]
+	if !ok || reflect.ValueOf(fn).Pointer() != reflect.ValueOf(builtin).Pointer() {
+		genFail(n, "custom function %s is not supported", n.Name)
+	}
+	args := make([]gval, len(n.Args))
+	for i, a := range n.Args {
+		args[i] = f.expr(a)
+	}
+	arity := func(k int, types ...reflect.Type) {
+		if len(args) != k {
+			genFail(n, "%s expects %d argument(s), got %d", n.Name, k, len(args))
+		}
+		for i, t := range types {
+			if t != nil && args[i].t != t { // nil: checked by the caller
+				genFail(n, "%s: expected %s, got %s", n.Name, t, args[i].t)
+			}
+		}
+	}
+	strs := func(k int) []reflect.Type { return slices.Repeat([]reflect.Type{stringType}, k) }
+	switch name {
+	case "len":
+		arity(1)
+		if v, ok := f.length(args[0]); ok {
+			return v
+		}
+		genFail(n, "len: unsupported type %s", args[0].t)
+	case "now":
+		for _, a := range args {
+			f.discard(a)
+		}
+		return f.bind(gval{f.g.use("time") + ".Now().Unix()", int64Type})
+	case "date":
+		arity(1, strs(1)...)
+		return f.date(n, f.bind(args[0]))
+	case "unix":
+		arity(1, timeType)
+		return gval{args[0].x + ".Unix()", int64Type}
+	case "contains", "startswith", "endswith":
+		arity(2, strs(2)...)
+		fns := map[string]string{"contains": "Contains", "startswith": "HasPrefix", "endswith": "HasSuffix"}
+		return gval{f.g.use("strings") + "." + fns[name] + "(" + bare(args[0].x) + ", " + bare(args[1].x) + ")", boolType}
+	case "lower", "upper", "trim":
+		arity(1, strs(1)...)
+		fns := map[string]string{"lower": "ToLower", "upper": "ToUpper", "trim": "TrimSpace"}
+		return gval{f.g.use("strings") + "." + fns[name] + "(" + bare(args[0].x) + ")", stringType}
+	case "bucket":
+		buckets := "100"
+		if len(args) == 2 {
+			arity(2, nil, stringType)
+		} else {
+			arity(3, nil, stringType)
+			x, ok := f.integer(args[2])
+			if !ok {
+				genFail(n, "bucket: expected an integer count of buckets, got %s", args[2].t)
+			}
+			b := f.bind(gval{x, int64Type})
+			f.failIf(b.x+" <= 0", n, fmt.Sprintf(`%s.Errorf("bucket: buckets must be a positive integer, got %%v", %s)`, f.g.use("fmt"), b.x), "")
+			buckets = "int(" + b.x + ")"
+		}
+		key := f.bucketKey(n, args[0])
+		return gval{"int64(" + f.g.use("okra") + ".Bucket(" + key + ", " + bare(args[1].x) + ", " + buckets + "))", int64Type}
+	case "sample":
+		arity(3, nil, stringType)
+		key := f.bucketKey(n, args[0])
+		pct, ok := f.integer(args[2])
+		if ok {
+			pct = "float64(" + pct + ")"
+		} else if k := args[2].t.Kind(); k == reflect.Float64 || k == reflect.Float32 {
+			pct = "float64(" + bare(args[2].x) + ")"
+		} else {
+			genFail(n, "sample: expected a number, got %s", args[2].t)
+		}
+		return gval{f.g.use("okra") + ".Sample(" + key + ", " + bare(args[1].x) + ", " + pct + ")", boolType}
+	}
+	genFail(n, "%s is not supported", n.Name)
+	return gval{}
+}
+
+// bucketKey renders the key of bucket and sample: a string, or an integer in
+// decimal.
+func (f *funcGen) bucketKey(n *CallExpr, key gval) string {
+	if key.t == stringType {
+		return bare(key.x)
+	}
+	if i, ok := f.integer(key); ok {
+		return f.g.use("strconv") + ".FormatInt(" + i + ", 10)"
+	}
+	genFail(n, "%s: expected a string or integer key, got %s", n.Name, key.t)
+	return ""
+}
+
+// integer renders v as an int64 if its type is an integer type whose every
+// value converts, which excludes uint, uint64 and uintptr.
+func (f *funcGen) integer(v gval) (string, bool) {
+	switch v.t.Kind() {
+	case reflect.Int64:
+		if v.t == int64Type {
+			return bare(v.x), true
+		}
+		fallthrough
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return "int64(" + bare(v.x) + ")", true
+	}
+	return "", false
+}
+
+// length implements len(v) and v.len() for sized values, through any number
+// of pointers (a nil pointer has length 0).
+func (f *funcGen) length(v gval) (gval, bool) {
+	x, t, depth := v.x, v.t, 0
+	for t.Kind() == reflect.Pointer {
+		x, t, depth = "(*"+x+")", t.Elem(), depth+1
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.String:
+	default:
+		return gval{}, false
+	}
+	if depth == 0 {
+		return gval{"int64(len(" + bare(x) + "))", int64Type}, true
+	}
+	r := f.temp()
+	f.line("%s := int64(0)", r)
+	p := v.x
+	for range depth {
+		f.line("if %s != nil {", p)
+		p = "(*" + p + ")"
+	}
+	f.line("%s = int64(len(%s))", r, x)
+	f.line("%s", strings.Repeat("}\n", depth))
+	return gval{r, int64Type}, true
+}
+
+// date implements the date built-in on a string variable.
+func (f *funcGen) date(n *CallExpr, s gval) gval {
+	v := f.temp()
+	tm := f.g.use("time")
+	f.line("var %s %s.Time", v, tm)
+	f.line("{")
+	f.line("ok := false")
+	f.line(`for _, layout := range [...]string{%s.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {`, tm)
+	f.line("if t, err := %s.Parse(layout, %s); err == nil {", tm, s.x)
+	f.line("%s, ok = t, true", v)
+	f.line("break")
+	f.line("}")
+	f.line("}")
+	f.failIf("!ok", n, fmt.Sprintf(`%s.Errorf("date: cannot parse %%q (want RFC3339, '2006-01-02 15:04:05', or '2006-01-02')", %s)`, f.g.use("fmt"), s.x), "")
+	f.line("}")
+	return gval{v, timeType}
+}
+
+// in renders evalIn(needle, hay).
+func (f *funcGen) in(n *InfixExpr, needle gval, hay Expr) string {
+	if needle.t == anyType {
+		genFail(n, "'in' on a value of unknown type")
+	}
+	switch h := hay.(type) {
+	case *LiteralExpr:
+		if set, ok := h.Value.(*valueSet); ok {
+			return f.setHas(n, needle, set)
+		}
+	case *ListExpr:
+		needle = f.bind(needle)
+		var elems []gval
+		for _, el := range h.Elems {
+			elems = append(elems, f.expr(el))
+		}
+		var probes []string
+		for _, el := range elems {
+			switch x := f.equal(n, needle, el); x {
+			case "false":
+				f.discard(el)
+			default:
+				probes = append(probes, x)
+			}
+		}
+		if len(probes) == 0 {
+			f.discard(needle)
+			return "false"
+		}
+		return "(" + strings.Join(probes, " || ") + ")"
+	}
+	hv := f.expr(hay)
+	x, t := hv.x, hv.t
+	if t == anyType {
+		genFail(n, "'in' on a value of unknown type")
+	}
+	if t == stringType {
+		if needle.t != stringType {
+			genFail(n, "invalid 'in': need string on left, got %s", needle.t)
+		}
+		return f.g.use("strings") + ".Contains(" + bare(x) + ", " + bare(needle.x) + ")"
+	}
+	for t.Kind() == reflect.Pointer {
+		f.nilCheck(x, n, f.g.use("errors")+`.New("invalid 'in': container is nil")`, "")
+		x, t = "(*"+x+")", t.Elem()
+	}
+	needle = f.bind(needle)
+	var el gval
+	var loop string
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		i := f.temp()
+		el, loop = gval{x + "[" + i + "]", t.Elem()}, i
+	case reflect.Map:
+		if t.Key() == stringType && needle.t == stringType {
+			r := f.temp()
+			f.line("_, %s := %s[%s]", r, x, needle.x)
+			return r
+		}
+		k := f.temp()
+		el, loop = gval{k, t.Key()}, k
+	default:
+		genFail(n, "invalid 'in' on %s", t)
+	}
+	probe := f.equal(n, needle, dynamic(el))
+	if probe == "false" {
+		f.discard(gval{x, t})
+		f.discard(needle)
+		return "false"
+	}
+	r := f.temp()
+	f.line("%s := false", r)
+	f.line("for %s := range %s {", loop, bare(x))
+	f.line("if %s {", bare(probe))
+	f.line("%s = true", r)
+	f.line("break")
+	f.line("}")
+	f.line("}")
+	return r
+}
+
+// setHas renders set.has(needle) as switches over the set's elements.
+func (f *funcGen) setHas(n *InfixExpr, needle gval, set *valueSet) string {
+	t := needle.t
+	var cases, floats []string
+	var x, fx string
+	switch {
+	case t == stringType:
+		for s := range set.strs {
+			cases = append(cases, strconv.Quote(s))
+		}
+		sort.Strings(cases)
+		x = needle.x
+	case t == boolType:
+		switch set.bools {
+		case [2]bool{true, true}:
+			f.discard(needle)
+			return "true"
+		case [2]bool{false, true}:
+			return needle.x
+		case [2]bool{true, false}:
+			return negate(needle.x)
+		}
+	case t == int64Type:
+		needle = f.bind(needle)
+		ints := slices.Sorted(maps.Keys(set.ints))
+		for _, v := range ints {
+			cases = append(cases, strconv.FormatInt(v, 10))
+		}
+		x, fx = needle.x, "float64("+needle.x+")"
+		floats = f.floatCases(set.floats)
+	case isNum(t):
+		merged := maps.Clone(set.floats)
+		maps.Copy(merged, set.intFloats)
+		fx = float64Of(needle)
+		floats = f.floatCases(merged)
+	case t.Kind() == reflect.Uint || t.Kind() == reflect.Uint64 || t.Kind() == reflect.Uintptr:
+		genFail(n, "'in' with a %s needle is not supported", t)
+	}
+	if len(cases)+len(floats) == 0 {
+		f.discard(needle)
+		return "false"
+	}
+	r := f.temp()
+	f.line("%s := false", r)
+	if len(cases) > 0 {
+		f.line("switch %s {", bare(x))
+		f.line("case %s:", strings.Join(cases, ", "))
+		f.line("%s = true", r)
+		f.line("}")
+	}
+	if len(floats) > 0 {
+		// int64 elements and needles compare exactly; everything else as
+		// float64.
+		if len(cases) > 0 {
+			f.line("if !%s {", r)
+		}
+		f.line("switch %s {", bare(fx))
+		f.line("case %s:", strings.Join(floats, ", "))
+		f.line("%s = true", r)
+		f.line("}")
+		if len(cases) > 0 {
+			f.line("}")
+		}
+	}
+	return r
+}
+
+// floatCases renders the elements of vals as switch cases, in order. NaN
+// equals nothing and is left out.
+func (f *funcGen) floatCases(vals map[float64]struct{}) []string {
+	var cases []string
+	for _, v := range slices.Sorted(maps.Keys(vals)) {
+		if !math.IsNaN(v) {
+			cases = append(cases, f.floatLit(v))
+		}
+	}
+	return cases
+}
+
+// bare strips the parentheses enclosing all of x, which operators put around
+// their result so it nests safely inside a larger expression.
+func bare(x string) string {
+	if len(x) < 2 || x[0] != '(' || x[len(x)-1] != ')' {
+		return x
+	}
+	depth := 0
+	for i := 0; i < len(x); i++ {
+		switch x[i] {
+		case '"':
+			// Skip a quoted string, escapes included.
+			for i++; i < len(x) && x[i] != '"'; i++ {
+				if x[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && i < len(x)-1 {
+				return x // the first group closes early: (a) + (b)
+			}
+		}
+	}
+	return x[1 : len(x)-1]
+}
@@ -0,0 +1,92 @@
+package okra
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type GenData struct {
+	Name  string
+	Age   int64
+	Rate  float64
+	Big   uint64
+	Tags  []string
+	Extra any
+}
+
+func genConfig() GenConfig {
+	return GenConfig{Package: "okra", ImportPath: "github.com/coolbit/okra", DataType: reflect.TypeFor[*GenData]()}
+}
+
+func TestGenerateGo(t *testing.T) {
+	e := NewEngine()
+	e.SetStrict(true)
+	p, err := e.Compile("Age * 2 > 10 && Name in ['a', 'b']")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := GenerateGo(genConfig(), GenFunc{Name: "Check", Program: p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"// Code generated by okra-gen. DO NOT EDIT.",
+		"func Check(data *GenData) (bool, error) {",
+		`case "a", "b":`,
+		"okra.ErrIntOverflow",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated code lacks %q:\n%s", want, src)
+		}
+	}
+}
+
+func TestGenerateGoRejects(t *testing.T) {
+	strict := func(e *Engine) { e.SetStrict(true) }
+	cases := []struct {
+		name, expr string
+		setup      func(*Engine)
+		want       string
+	}{
+		{"lenient", "Age > 1", func(e *Engine) { e.SetStrict(false) }, "needs a strict Program"},
+		{"macro", "twice(Age)", func(e *Engine) {
+			strict(e)
+			_ = e.RegisterMacro("twice", func(Context, []Expr) (any, error) { return 2, nil })
+		}, "macro twice is not supported"},
+		{"custom function", "f(Age)", func(e *Engine) {
+			strict(e)
+			_ = e.RegisterFunc("f", func([]any) (any, error) { return 1, nil })
+		}, "custom function f is not supported"},
+		{"unknown field", "Missing > 1", strict, `unknown field "Missing"`},
+		{"string plus int", "Name + 1", strict, "1:1: (Name + 1): invalid + between string and int64"},
+		{"float modulo", "Rate % 2", strict, ErrFloatModulo.Error()},
+		{"method", "Name.upper()", strict, "not supported"},
+		{"uint64 arithmetic", "Big + 1", strict, "invalid arithmetic"},
+		{"interface", "Extra + 1", strict, "between interface {} and int64"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := NewEngine()
+			tc.setup(e)
+			p, err := e.Compile(tc.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = GenerateGo(genConfig(), GenFunc{Name: "F", Program: p})
+			if err == nil || !strings.Contains(err.Error(), tc.want) || !strings.HasPrefix(err.Error(), "okra: F: ") {
+				t.Fatalf("err = %v, want it to mention %q", err, tc.want)
+			}
+		})
+	}
+
+	if _, err := GenerateGo(GenConfig{Package: "x-y", DataType: reflect.TypeFor[int]()}); err == nil {
+		t.Error("invalid package name accepted")
+	}
+	e := NewEngine()
+	e.SetStrict(true)
+	p, _ := e.Compile("1")
+	if _, err := GenerateGo(genConfig(), GenFunc{Name: "A", Program: p}, GenFunc{Name: "A", Program: p}); err == nil {
+		t.Error("duplicate function name accepted")
+	}
+}
@@ -0,0 +1,224 @@
+package gentest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coolbit/okra"
+)
+
+// generated maps every rule of rules.txt to its generated function.
+var generated = map[string]any{
+	"Big": Big, "Total": Total, "Average": Average, "Remainder": Remainder,
+	"Scaled": Scaled, "Negated": Negated, "Bits": Bits, "Shift": Shift,
+	"Label": Label, "Greeting": Greeting, "Affixes": Affixes, "Tier": Tier,
+	"Mixed": Mixed, "Region": Region, "Numbers": Numbers, "Tagged": Tagged,
+	"ScoreHit": ScoreHit, "Limit": Limit, "LimitIndex": LimitIndex, "Code": Code,
+	"FirstTag": FirstTag, "ItemCost": ItemCost, "Weight": Weight, "Created": Created,
+	"PaidBefore": PaidBefore, "Length": Length, "Equalities": Equalities,
+	"StatusOf": StatusOf, "NoteOr": NoteOr, "DateParse": DateParse,
+	"SameCity": SameCity, "Keys": Keys, "List": List, "Shared": Shared,
+	"Rollout": Rollout,
+}
+
+type rule struct{ name, src string }
+
+func loadRules(t *testing.T) []rule {
+	t.Helper()
+	data, err := os.ReadFile("rules.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rules []rule
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, src, _ := strings.Cut(line, ":")
+		rules = append(rules, rule{strings.TrimSpace(name), strings.TrimSpace(src)})
+	}
+	return rules
+}
+
+func compile(t *testing.T, rules []rule) []okra.GenFunc {
+	t.Helper()
+	e := okra.NewEngine()
+	funcs := make([]okra.GenFunc, len(rules))
+	for i, r := range rules {
+		prog, err := e.Compile(r.src)
+		if err != nil {
+			t.Fatalf("%s: %v", r.name, err)
+		}
+		funcs[i] = okra.GenFunc{Name: r.name, Program: prog}
+	}
+	return funcs
+}
+
+func TestGeneratedUpToDate(t *testing.T) {
+	src, err := okra.GenerateGo(okra.GenConfig{
+		Package:    "gentest",
+		ImportPath: "github.com/coolbit/okra/internal/gentest",
+		DataType:   reflect.TypeFor[*Order](),
+	}, compile(t, loadRules(t))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("rules_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, committed) {
+		t.Fatal("rules_gen.go is stale; run go generate ./internal/gentest")
+	}
+}
+
+func TestGeneratedMatchesEval(t *testing.T) {
+	rules := loadRules(t)
+	funcs := compile(t, rules)
+	r := rand.New(rand.NewPCG(1, 2))
+	orders := make([]*Order, 3000)
+	for i := range orders {
+		orders[i] = randomOrder(r)
+	}
+	for i, rl := range rules {
+		fn, ok := generated[rl.name]
+		if !ok {
+			t.Fatalf("%s is missing from the generated table", rl.name)
+		}
+		fv := reflect.ValueOf(fn)
+		outcomes := map[bool]int{}
+		for _, o := range orders {
+			want, wantErr := funcs[i].Program.Eval(o)
+			out := fv.Call([]reflect.Value{reflect.ValueOf(o)})
+			got, _ := out[0].Interface(), out[1].Interface()
+			gotErr, _ := out[1].Interface().(error)
+			outcomes[wantErr == nil]++
+			if wantErr != nil {
+				if gotErr == nil {
+					t.Fatalf("%s(%+v) = %v, want error %v", rl.name, o, got, wantErr)
+				}
+				if msg := sameError(gotErr, wantErr); msg != "" {
+					t.Fatalf("%s(%+v): %s\ngenerated: %v\neval:      %v", rl.name, o, msg, gotErr, wantErr)
+				}
+				continue
+			}
+			if gotErr != nil {
+				t.Fatalf("%s(%+v) failed: %v, want %#v", rl.name, o, gotErr, want)
+			}
+			if !sameValue(got, want) {
+				t.Fatalf("%s(%+v) = %#v, want %#v", rl.name, o, got, want)
+			}
+		}
+		if outcomes[true] == 0 {
+			t.Errorf("%s never succeeded on the random orders", rl.name)
+		}
+	}
+}
+
+func sameValue(a, b any) bool {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Equal(bt)
+	}
+	if af, ok := a.(float64); ok && math.IsNaN(af) {
+		bf, ok := b.(float64)
+		return ok && math.IsNaN(bf)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// sameError compares everything but the "did you mean" suggestions, which
+// generated code leaves out.
+func sameError(got, want error) string {
+	var g, w *okra.Error
+	if !errors.As(got, &g) || !errors.As(want, &w) {
+		return "not an *okra.Error"
+	}
+	msg, _, _ := strings.Cut(w.Error(), " (did you mean")
+	switch {
+	case g.Error() != msg:
+		return "messages differ"
+	case g.Kind != w.Kind || g.Expr != w.Expr || g.Source != w.Source:
+		return "Kind, Expr or Source differs"
+	case g.Line != w.Line || g.Column != w.Column || g.Start != w.Start || g.End != w.End:
+		return "positions differ"
+	case g.Cause != w.Cause:
+		return "causes differ"
+	}
+	return ""
+}
+
+func pick[T any](r *rand.Rand, vals ...T) T { return vals[r.IntN(len(vals))] }
+
+var names = []string{"", "A", "Abz", "x", "vip", "daily", " Hi ", "2024-02-03", "2024-02-03T10:00:00Z", "Paris", "Lyon"}
+
+func randomTime(r *rand.Rand) time.Time {
+	return time.Unix(r.Int64N(2e9), 0).In(pick(r, time.UTC, time.FixedZone("X", 3600)))
+}
+
+func randomAddress(r *rand.Rand) Address {
+	return Address{City: pick(r, names...), Zip: pick(r, "", "1", "75001", "69000")}
+}
+
+// randomOrder draws an order biased towards edge cases: nil pointers and
+// maps, empty collections, zero divisors, and integers at the overflow limits.
+func randomOrder(r *rand.Rand) *Order {
+	if r.IntN(50) == 0 {
+		return nil
+	}
+	o := &Order{
+		Amount:   pick(r, 0, 1, -1, 7, 8, 101, 501, 1001, math.MaxInt64, math.MinInt64, math.MaxInt64/3, r.Int64N(4000)-2000),
+		Discount: pick[float32](r, 0, 0.5, 1, 2.5),
+		Qty:      pick(r, -1, 0, 1, 2, 3, 4, 70),
+		Small:    pick[int8](r, -128, -1, 0, 1, 2, 3, 127),
+		Count:    pick[uint16](r, 0, 1, 255, 65535),
+		Rate:     pick(r, 0, 0.5, 1, 2, math.Copysign(0, -1), 1e308),
+		Name:     pick(r, names...),
+		Status:   pick[Status](r, "open", "closed"),
+		Level:    pick[Level](r, -1, 3, 4),
+		VIP:      r.IntN(2) == 0,
+		Weights:  [3]float64{r.Float64(), 1, 2},
+		Bill:     randomAddress(r),
+		Paid:     randomTime(r),
+		Note:     pick[any](r, nil, int64(1), "note"),
+	}
+	if r.IntN(3) > 0 {
+		o.Base = &Base{ID: pick[int64](r, -1, 0, 1), Created: randomTime(r)}
+	}
+	if r.IntN(4) > 0 {
+		a := randomAddress(r)
+		o.Ship = &a
+	}
+	for range r.IntN(4) {
+		o.Tags = append(o.Tags, pick(r, names...))
+	}
+	for range r.IntN(4) {
+		o.Scores = append(o.Scores, r.IntN(5)-1)
+	}
+	for range r.IntN(3) {
+		o.Items = append(o.Items, Item{SKU: "s", Qty: r.IntN(3), Price: pick(r, 0.5, 2, 1e308)})
+	}
+	if r.IntN(4) > 0 {
+		o.Limits = map[string]int64{}
+		for range r.IntN(3) {
+			o.Limits[pick(r, names...)] = pick[int64](r, 0, 100, math.MaxInt64)
+		}
+	}
+	if r.IntN(2) > 0 {
+		o.Codes = map[int]string{}
+		for range r.IntN(3) {
+			o.Codes[r.IntN(5)-1] = pick(r, names...)
+		}
+	}
+	return o
+}
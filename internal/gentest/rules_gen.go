@@ -0,0 +1,726 @@
+// Code generated by okra-gen. DO NOT EDIT.
+
+package gentest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coolbit/okra"
+)
+
+// Big evaluates the okra expression
+//
+//	Amount > 1000
+func Big(data *Order) (bool, error) {
+	const src = "Amount > 1000"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 6, Expr: "Amount", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Amount", okra.ErrUnknownField)}
+	}
+	return float64((*data).Amount) > float64(int64(1000)), nil
+}
+
+// Total evaluates the okra expression
+//
+//	Amount * Qty + Small - Count
+func Total(data *Order) (int64, error) {
+	const src = "Amount * Qty + Small - Count"
+	if data == nil {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 6, Expr: "Amount", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Amount", okra.ErrUnknownField)}
+	}
+	v1 := (*data).Amount
+	v2 := int64((*data).Qty)
+	if v1 != 0 && v2 != 0 && (v1 == math.MinInt64 && v2 == -1 || v2 == math.MinInt64 && v1 == -1 || v1*v2/v2 != v1) {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 12, Expr: "(Amount * Qty)", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+	}
+	v3 := v1 * v2
+	v4 := int64((*data).Small)
+	if (v4 > 0 && v3 > math.MaxInt64-v4) || (v4 < 0 && v3 < math.MinInt64-v4) {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 20, Expr: "((Amount * Qty) + Small)", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+	}
+	v5 := v3 + v4
+	v6 := int64((*data).Count)
+	if (v6 < 0 && v5 > math.MaxInt64+v6) || (v6 > 0 && v5 < math.MinInt64+v6) {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 28, Expr: "(((Amount * Qty) + Small) - Count)", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+	}
+	return v5 - v6, nil
+}
+
+// Average evaluates the okra expression
+//
+//	Amount / Qty
+func Average(data *Order) (int64, error) {
+	const src = "Amount / Qty"
+	if data == nil {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 6, Expr: "Amount", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Amount", okra.ErrUnknownField)}
+	}
+	v1 := (*data).Amount
+	v2 := int64((*data).Qty)
+	if v2 == 0 {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 12, Expr: "(Amount / Qty)", Source: src, Cause: okra.ErrDivByZero, Err: okra.ErrDivByZero}
+	}
+	if v1 == math.MinInt64 && v2 == -1 {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 12, Expr: "(Amount / Qty)", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+	}
+	return v1 / v2, nil
+}
+
+// Remainder evaluates the okra expression
+//
+//	Amount % Small
+func Remainder(data *Order) (int64, error) {
+	const src = "Amount % Small"
+	if data == nil {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 6, Expr: "Amount", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Amount", okra.ErrUnknownField)}
+	}
+	v1 := (*data).Amount
+	v2 := int64((*data).Small)
+	if v2 == 0 {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 14, Expr: "(Amount % Small)", Source: src, Cause: okra.ErrModByZero, Err: okra.ErrModByZero}
+	}
+	return v1 % v2, nil
+}
+
+// Scaled evaluates the okra expression
+//
+//	Rate * Discount / Qty
+func Scaled(data *Order) (float64, error) {
+	const src = "Rate * Discount / Qty"
+	if data == nil {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 4, Expr: "Rate", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Rate", okra.ErrUnknownField)}
+	}
+	v1 := (*data).Rate
+	v2 := float64((*data).Discount)
+	v3 := v1 * v2
+	v4 := float64((*data).Qty)
+	if v4 == 0 {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 21, Expr: "((Rate * Discount) / Qty)", Source: src, Cause: okra.ErrDivByZero, Err: okra.ErrDivByZero}
+	}
+	return v3 / v4, nil
+}
+
+// Negated evaluates the okra expression
+//
+//	-Amount
+func Negated(data *Order) (int64, error) {
+	const src = "-Amount"
+	if data == nil {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 2, Start: 1, End: 7, Expr: "Amount", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Amount", okra.ErrUnknownField)}
+	}
+	v1 := (*data).Amount
+	if v1 == math.MinInt64 {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 7, Expr: "(-Amount)", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+	}
+	return -v1, nil
+}
+
+// Bits evaluates the okra expression
+//
+//	(Amount & 255) | (Small << Qty) ^ ~Count
+func Bits(data *Order) (int64, error) {
+	const src = "(Amount & 255) | (Small << Qty) ^ ~Count"
+	if data == nil {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 2, Start: 1, End: 7, Expr: "Amount", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Amount", okra.ErrUnknownField)}
+	}
+	v1 := (*data).Amount
+	v2 := int64(255)
+	v3 := int64((*data).Small)
+	v4 := int64((*data).Qty)
+	if v4 < 0 {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 19, Start: 18, End: 30, Expr: "(Small << Qty)", Source: src, Cause: okra.ErrNegativeShift, Err: okra.ErrNegativeShift}
+	}
+	v5 := v1 & v2
+	v6 := v3 << uint64(v4)
+	v7 := v5 | v6
+	v8 := ^int64((*data).Count)
+	return v7 ^ v8, nil
+}
+
+// Shift evaluates the okra expression
+//
+//	Amount >> Small
+func Shift(data *Order) (int64, error) {
+	const src = "Amount >> Small"
+	if data == nil {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 6, Expr: "Amount", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Amount", okra.ErrUnknownField)}
+	}
+	v1 := (*data).Amount
+	v2 := int64((*data).Small)
+	if v2 < 0 {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 15, Expr: "(Amount >> Small)", Source: src, Cause: okra.ErrNegativeShift, Err: okra.ErrNegativeShift}
+	}
+	return v1 >> uint64(v2), nil
+}
+
+// Label evaluates the okra expression
+//
+//	Name + '-' + Ship.City
+func Label(data *Order) (string, error) {
+	const src = "Name + '-' + Ship.City"
+	if data == nil {
+		return "", &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 4, Expr: "Name", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Name", okra.ErrUnknownField)}
+	}
+	if (*data).Ship == nil {
+		return "", &okra.Error{Kind: okra.KindEval, Line: 1, Column: 14, Start: 13, End: 22, Expr: "Ship.City", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "City", okra.ErrUnknownField)}
+	}
+	return ((*data).Name + "-") + (*(*data).Ship).City, nil
+}
+
+// Greeting evaluates the okra expression
+//
+//	upper(trim(Name)) + lower(billing.City)
+func Greeting(data *Order) (string, error) {
+	const src = "upper(trim(Name)) + lower(billing.City)"
+	if data == nil {
+		return "", &okra.Error{Kind: okra.KindEval, Line: 1, Column: 12, Start: 11, End: 15, Expr: "Name", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Name", okra.ErrUnknownField)}
+	}
+	return strings.ToUpper(strings.TrimSpace((*data).Name)) + strings.ToLower((*data).Bill.City), nil
+}
+
+// Affixes evaluates the okra expression
+//
+//	startsWith(Name, 'A') || endsWith(Name, 'z') && contains(billing.zip, '1')
+func Affixes(data *Order) (bool, error) {
+	const src = "startsWith(Name, 'A') || endsWith(Name, 'z') && contains(billing.zip, '1')"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 12, Start: 11, End: 15, Expr: "Name", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Name", okra.ErrUnknownField)}
+	}
+	v1 := true
+	if !strings.HasPrefix((*data).Name, "A") {
+		v2 := false
+		if strings.HasSuffix((*data).Name, "z") {
+			v2 = strings.Contains((*data).Bill.Zip, "1")
+		}
+		v1 = v2
+	}
+	return v1, nil
+}
+
+// Tier evaluates the okra expression
+//
+//	Amount > 500 ? 'gold' : Amount > 100 ? 'silver' : 'bronze'
+func Tier(data *Order) (string, error) {
+	const src = "Amount > 500 ? 'gold' : Amount > 100 ? 'silver' : 'bronze'"
+	if data == nil {
+		return "", &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 6, Expr: "Amount", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Amount", okra.ErrUnknownField)}
+	}
+	var v2 string
+	if float64((*data).Amount) > float64(int64(500)) {
+		v2 = "gold"
+	} else {
+		var v1 string
+		if float64((*data).Amount) > float64(int64(100)) {
+			v1 = "silver"
+		} else {
+			v1 = "bronze"
+		}
+		v2 = v1
+	}
+	return v2, nil
+}
+
+// Mixed evaluates the okra expression
+//
+//	VIP ? Amount : Name
+func Mixed(data *Order) (any, error) {
+	const src = "VIP ? Amount : Name"
+	if data == nil {
+		return nil, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 3, Expr: "VIP", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "VIP", okra.ErrUnknownField)}
+	}
+	var v1 any
+	if (*data).VIP {
+		v1 = (*data).Amount
+	} else {
+		v1 = (*data).Name
+	}
+	return v1, nil
+}
+
+// Region evaluates the okra expression
+//
+//	Ship.City in ['Paris', 'Lyon', 'Nice']
+func Region(data *Order) (bool, error) {
+	const src = "Ship.City in ['Paris', 'Lyon', 'Nice']"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 4, Expr: "Ship", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Ship", okra.ErrUnknownField)}
+	}
+	if (*data).Ship == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 9, Expr: "Ship.City", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "City", okra.ErrUnknownField)}
+	}
+	v1 := false
+	switch (*(*data).Ship).City {
+	case "Lyon", "Nice", "Paris":
+		v1 = true
+	}
+	return v1, nil
+}
+
+// Numbers evaluates the okra expression
+//
+//	Qty not in [1, 2.5, 3] && Small in [1, 2, 3] || Rate in [0.5, 1, 2] || Amount in [7, 8.0]
+func Numbers(data *Order) (bool, error) {
+	const src = "Qty not in [1, 2.5, 3] && Small in [1, 2, 3] || Rate in [0.5, 1, 2] || Amount in [7, 8.0]"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 3, Expr: "Qty", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Qty", okra.ErrUnknownField)}
+	}
+	v1 := false
+	switch float64((*data).Qty) {
+	case 1, 2.5, 3:
+		v1 = true
+	}
+	v2 := false
+	if !v1 {
+		v3 := false
+		switch float64((*data).Small) {
+		case 1, 2, 3:
+			v3 = true
+		}
+		v2 = v3
+	}
+	v4 := true
+	if !v2 {
+		v5 := false
+		switch (*data).Rate {
+		case 0.5, 1, 2:
+			v5 = true
+		}
+		v4 = v5
+	}
+	v6 := true
+	if !v4 {
+		v7 := (*data).Amount
+		v8 := false
+		switch v7 {
+		case 7:
+			v8 = true
+		}
+		if !v8 {
+			switch float64(v7) {
+			case 8:
+				v8 = true
+			}
+		}
+		v6 = v8
+	}
+	return v6, nil
+}
+
+// Tagged evaluates the okra expression
+//
+//	'vip' in Tags || Name in Tags
+func Tagged(data *Order) (bool, error) {
+	const src = "'vip' in Tags || Name in Tags"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 10, Start: 9, End: 13, Expr: "Tags", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Tags", okra.ErrUnknownField)}
+	}
+	v1 := "vip"
+	v3 := false
+	for v2 := range (*data).Tags {
+		if v1 == (*data).Tags[v2] {
+			v3 = true
+			break
+		}
+	}
+	v4 := true
+	if !v3 {
+		v5 := (*data).Name
+		v7 := false
+		for v6 := range (*data).Tags {
+			if v5 == (*data).Tags[v6] {
+				v7 = true
+				break
+			}
+		}
+		v4 = v7
+	}
+	return v4, nil
+}
+
+// ScoreHit evaluates the okra expression
+//
+//	Qty in Scores
+func ScoreHit(data *Order) (bool, error) {
+	const src = "Qty in Scores"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 3, Expr: "Qty", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Qty", okra.ErrUnknownField)}
+	}
+	v1 := (*data).Qty
+	v3 := false
+	for v2 := range (*data).Scores {
+		if float64(v1) == float64((*data).Scores[v2]) {
+			v3 = true
+			break
+		}
+	}
+	return v3, nil
+}
+
+// Limit evaluates the okra expression
+//
+//	Limits.daily > Amount
+func Limit(data *Order) (bool, error) {
+	const src = "Limits.daily > Amount"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 6, Expr: "Limits", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Limits", okra.ErrUnknownField)}
+	}
+	v1, ok := (*data).Limits["daily"]
+	if !ok {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 12, Expr: "Limits.daily", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("map has no key %q: %w", "daily", okra.ErrUnknownField)}
+	}
+	return float64(v1) > float64((*data).Amount), nil
+}
+
+// LimitIndex evaluates the okra expression
+//
+//	Limits[Name] + 1
+func LimitIndex(data *Order) (int64, error) {
+	const src = "Limits[Name] + 1"
+	if data == nil {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 6, Expr: "Limits", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Limits", okra.ErrUnknownField)}
+	}
+	v1, ok := (*data).Limits[(*data).Name]
+	if !ok {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 12, Expr: "Limits[Name]", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("map has no key %q: %w", (*data).Name, okra.ErrUnknownField)}
+	}
+	v2 := int64(1)
+	if (v2 > 0 && v1 > math.MaxInt64-v2) || (v2 < 0 && v1 < math.MinInt64-v2) {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 16, Expr: "(Limits[Name] + 1)", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+	}
+	return v1 + v2, nil
+}
+
+// Code evaluates the okra expression
+//
+//	Codes[Qty]
+func Code(data *Order) (string, error) {
+	const src = "Codes[Qty]"
+	if data == nil {
+		return "", &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 5, Expr: "Codes", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Codes", okra.ErrUnknownField)}
+	}
+	v1, ok := (*data).Codes[(*data).Qty]
+	if !ok {
+		return "", &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 10, Expr: "Codes[Qty]", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("map has no key %v: %w", (*data).Qty, okra.ErrUnknownField)}
+	}
+	return v1, nil
+}
+
+// FirstTag evaluates the okra expression
+//
+//	Tags[0] == Name
+func FirstTag(data *Order) (bool, error) {
+	const src = "Tags[0] == Name"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 4, Expr: "Tags", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Tags", okra.ErrUnknownField)}
+	}
+	v1 := int64(0)
+	if v1 < 0 || v1 >= int64(len((*data).Tags)) {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 7, Expr: "Tags[0]", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("index %d out of range (len %d): %w", v1, len((*data).Tags), okra.ErrUnknownField)}
+	}
+	return (*data).Tags[v1] == (*data).Name, nil
+}
+
+// ItemCost evaluates the okra expression
+//
+//	Items[Small].Qty * Items[Small].Price
+func ItemCost(data *Order) (float64, error) {
+	const src = "Items[Small].Qty * Items[Small].Price"
+	if data == nil {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 5, Expr: "Items", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Items", okra.ErrUnknownField)}
+	}
+	v1 := int64((*data).Small)
+	if v1 < 0 || v1 >= int64(len((*data).Items)) {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 12, Expr: "Items[Small]", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("index %d out of range (len %d): %w", v1, len((*data).Items), okra.ErrUnknownField)}
+	}
+	v2 := int64((*data).Small)
+	if v2 < 0 || v2 >= int64(len((*data).Items)) {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 20, Start: 19, End: 31, Expr: "Items[Small]", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("index %d out of range (len %d): %w", v2, len((*data).Items), okra.ErrUnknownField)}
+	}
+	v3 := float64((*data).Items[v1].Qty)
+	v4 := (*data).Items[v2].Price
+	return v3 * v4, nil
+}
+
+// Weight evaluates the okra expression
+//
+//	Weights[Qty] >= Rate
+func Weight(data *Order) (bool, error) {
+	const src = "Weights[Qty] >= Rate"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 7, Expr: "Weights", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Weights", okra.ErrUnknownField)}
+	}
+	v1 := int64((*data).Qty)
+	if v1 < 0 || v1 >= int64(len((*data).Weights)) {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 12, Expr: "Weights[Qty]", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("index %d out of range (len %d): %w", v1, len((*data).Weights), okra.ErrUnknownField)}
+	}
+	return (*data).Weights[v1] >= (*data).Rate, nil
+}
+
+// Created evaluates the okra expression
+//
+//	Created > date('2024-01-01') && ID > 0
+func Created(data *Order) (bool, error) {
+	const src = "Created > date('2024-01-01') && ID > 0"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 7, Expr: "Created", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Created", okra.ErrUnknownField)}
+	}
+	if (*data).Base == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 7, Expr: "Created", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q through nil embedded pointer: %w", "Created", okra.ErrUnknownField)}
+	}
+	v1 := false
+	if (*data).Base.Created.After(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		v1 = float64((*data).Base.ID) > float64(int64(0))
+	}
+	return v1, nil
+}
+
+// PaidBefore evaluates the okra expression
+//
+//	unix(Paid) - now() < 0
+func PaidBefore(data *Order) (bool, error) {
+	const src = "unix(Paid) - now() < 0"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 6, Start: 5, End: 9, Expr: "Paid", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Paid", okra.ErrUnknownField)}
+	}
+	v1 := time.Now().Unix()
+	v2 := (*data).Paid.Unix()
+	if (v1 < 0 && v2 > math.MaxInt64+v1) || (v1 > 0 && v2 < math.MinInt64+v1) {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 18, Expr: "(unix(Paid) - now())", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+	}
+	return float64(v2-v1) < float64(int64(0)), nil
+}
+
+// Length evaluates the okra expression
+//
+//	len(Tags) + len(Name) + Limits.len() + len(Ship.City)
+func Length(data *Order) (int64, error) {
+	const src = "len(Tags) + len(Name) + Limits.len() + len(Ship.City)"
+	if data == nil {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 5, Start: 4, End: 8, Expr: "Tags", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Tags", okra.ErrUnknownField)}
+	}
+	v1 := int64(len((*data).Tags))
+	v2 := int64(len((*data).Name))
+	if (v2 > 0 && v1 > math.MaxInt64-v2) || (v2 < 0 && v1 < math.MinInt64-v2) {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 21, Expr: "(len(Tags) + len(Name))", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+	}
+	v3 := v1 + v2
+	v4 := int64(len((*data).Limits))
+	if (v4 > 0 && v3 > math.MaxInt64-v4) || (v4 < 0 && v3 < math.MinInt64-v4) {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 36, Expr: "((len(Tags) + len(Name)) + Limits.len())", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+	}
+	if (*data).Ship == nil {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 44, Start: 43, End: 52, Expr: "Ship.City", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "City", okra.ErrUnknownField)}
+	}
+	v5 := v3 + v4
+	v6 := int64(len((*(*data).Ship).City))
+	if (v6 > 0 && v5 > math.MaxInt64-v6) || (v6 < 0 && v5 < math.MinInt64-v6) {
+		return 0, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 53, Expr: "(((len(Tags) + len(Name)) + Limits.len()) + len(Ship.City))", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+	}
+	return v5 + v6, nil
+}
+
+// Equalities evaluates the okra expression
+//
+//	Level == 3 || Amount == Qty || Rate == Discount || Paid == Created || Name == 'x'
+func Equalities(data *Order) (bool, error) {
+	const src = "Level == 3 || Amount == Qty || Rate == Discount || Paid == Created || Name == 'x'"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 5, Expr: "Level", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Level", okra.ErrUnknownField)}
+	}
+	v1 := true
+	if !(float64((*data).Level) == float64(int64(3))) {
+		v1 = float64((*data).Amount) == float64((*data).Qty)
+	}
+	v2 := true
+	if !v1 {
+		v2 = (*data).Rate == float64((*data).Discount)
+	}
+	v3 := true
+	if !v2 {
+		if (*data).Base == nil {
+			return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 60, Start: 59, End: 66, Expr: "Created", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q through nil embedded pointer: %w", "Created", okra.ErrUnknownField)}
+		}
+		v3 = (*data).Paid.Equal((*data).Base.Created)
+	}
+	v4 := true
+	if !v3 {
+		v4 = (*data).Name == "x"
+	}
+	return v4, nil
+}
+
+// StatusOf evaluates the okra expression
+//
+//	Status
+func StatusOf(data *Order) (Status, error) {
+	const src = "Status"
+	if data == nil {
+		return "", &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 6, Expr: "Status", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Status", okra.ErrUnknownField)}
+	}
+	return (*data).Status, nil
+}
+
+// NoteOr evaluates the okra expression
+//
+//	VIP ? Note : Ship
+func NoteOr(data *Order) (any, error) {
+	const src = "VIP ? Note : Ship"
+	if data == nil {
+		return nil, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 3, Expr: "VIP", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "VIP", okra.ErrUnknownField)}
+	}
+	var v1 any
+	if (*data).VIP {
+		v1 = (*data).Note
+	} else {
+		v1 = (*data).Ship
+	}
+	return v1, nil
+}
+
+// DateParse evaluates the okra expression
+//
+//	date(Name) < Paid
+func DateParse(data *Order) (bool, error) {
+	const src = "date(Name) < Paid"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 6, Start: 5, End: 9, Expr: "Name", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Name", okra.ErrUnknownField)}
+	}
+	v1 := (*data).Name
+	var v2 time.Time
+	{
+		ok := false
+		for _, layout := range [...]string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, v1); err == nil {
+				v2, ok = t, true
+				break
+			}
+		}
+		if !ok {
+			return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 10, Expr: "date(Name)", Source: src, Err: fmt.Errorf("date: cannot parse %q (want RFC3339, '2006-01-02 15:04:05', or '2006-01-02')", v1)}
+		}
+	}
+	return v2.Before((*data).Paid), nil
+}
+
+// SameCity evaluates the okra expression
+//
+//	Ship.City == billing.City && Ship.zip != billing.zip
+func SameCity(data *Order) (bool, error) {
+	const src = "Ship.City == billing.City && Ship.zip != billing.zip"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 4, Expr: "Ship", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Ship", okra.ErrUnknownField)}
+	}
+	if (*data).Ship == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 9, Expr: "Ship.City", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "City", okra.ErrUnknownField)}
+	}
+	v1 := false
+	if (*(*data).Ship).City == (*data).Bill.City {
+		v1 = !((*(*data).Ship).Zip == (*data).Bill.Zip)
+	}
+	return v1, nil
+}
+
+// Keys evaluates the okra expression
+//
+//	'daily' in Limits || Qty in Codes
+func Keys(data *Order) (bool, error) {
+	const src = "'daily' in Limits || Qty in Codes"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 12, Start: 11, End: 17, Expr: "Limits", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Limits", okra.ErrUnknownField)}
+	}
+	v1 := "daily"
+	_, v2 := (*data).Limits[v1]
+	v3 := true
+	if !v2 {
+		v4 := (*data).Qty
+		v6 := false
+		for v5 := range (*data).Codes {
+			if float64(v4) == float64(v5) {
+				v6 = true
+				break
+			}
+		}
+		v3 = v6
+	}
+	return v3, nil
+}
+
+// List evaluates the okra expression
+//
+//	[Amount, Qty, Name]
+func List(data *Order) ([]any, error) {
+	const src = "[Amount, Qty, Name]"
+	if data == nil {
+		return nil, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 2, Start: 1, End: 7, Expr: "Amount", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Amount", okra.ErrUnknownField)}
+	}
+	v1 := []any{(*data).Amount, (*data).Qty, (*data).Name}
+	return v1, nil
+}
+
+// Shared evaluates the okra expression
+//
+//	(Amount + 1) * (Amount + 1) > Qty && (Amount + 1) != 0
+func Shared(data *Order) (bool, error) {
+	const src = "(Amount + 1) * (Amount + 1) > Qty && (Amount + 1) != 0"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 2, Start: 1, End: 7, Expr: "Amount", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Amount", okra.ErrUnknownField)}
+	}
+	v1 := (*data).Amount
+	v2 := int64(1)
+	if (v2 > 0 && v1 > math.MaxInt64-v2) || (v2 < 0 && v1 < math.MinInt64-v2) {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 2, Start: 1, End: 11, Expr: "(Amount + 1)", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+	}
+	v3 := (*data).Amount
+	v4 := int64(1)
+	if (v4 > 0 && v3 > math.MaxInt64-v4) || (v4 < 0 && v3 < math.MinInt64-v4) {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 17, Start: 16, End: 26, Expr: "(Amount + 1)", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+	}
+	v5 := v1 + v2
+	v6 := v3 + v4
+	if v5 != 0 && v6 != 0 && (v5 == math.MinInt64 && v6 == -1 || v6 == math.MinInt64 && v5 == -1 || v5*v6/v6 != v5) {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 1, Start: 0, End: 27, Expr: "((Amount + 1) * (Amount + 1))", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+	}
+	v7 := false
+	if float64(v5*v6) > float64((*data).Qty) {
+		v8 := (*data).Amount
+		v9 := int64(1)
+		if (v9 > 0 && v8 > math.MaxInt64-v9) || (v9 < 0 && v8 < math.MinInt64-v9) {
+			return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 39, Start: 38, End: 48, Expr: "(Amount + 1)", Source: src, Cause: okra.ErrIntOverflow, Err: okra.ErrIntOverflow}
+		}
+		v7 = !((v8 + v9) == int64(0))
+	}
+	return v7, nil
+}
+
+// Rollout evaluates the okra expression
+//
+//	bucket(Name, 'checkout') < 20 || sample(ID, 'beta', Rate * 10) && bucket(Qty, Ship.City, Small) > 0
+func Rollout(data *Order) (bool, error) {
+	const src = "bucket(Name, 'checkout') < 20 || sample(ID, 'beta', Rate * 10) && bucket(Qty, Ship.City, Small) > 0"
+	if data == nil {
+		return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 8, Start: 7, End: 11, Expr: "Name", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "Name", okra.ErrUnknownField)}
+	}
+	v1 := true
+	if !(float64(int64(okra.Bucket((*data).Name, "checkout", 100))) < float64(int64(20))) {
+		if (*data).Base == nil {
+			return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 41, Start: 40, End: 42, Expr: "ID", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q through nil embedded pointer: %w", "ID", okra.ErrUnknownField)}
+		}
+		v2 := (*data).Rate
+		v3 := float64(int64(10))
+		v4 := false
+		if okra.Sample(strconv.FormatInt((*data).Base.ID, 10), "beta", float64(v2*v3)) {
+			if (*data).Ship == nil {
+				return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 79, Start: 78, End: 87, Expr: "Ship.City", Source: src, Cause: okra.ErrUnknownField, Err: fmt.Errorf("cannot access %q on nil: %w", "City", okra.ErrUnknownField)}
+			}
+			v5 := int64((*data).Small)
+			if v5 <= 0 {
+				return false, &okra.Error{Kind: okra.KindEval, Line: 1, Column: 67, Start: 66, End: 95, Expr: "bucket(Qty, Ship.City, Small)", Source: src, Err: fmt.Errorf("bucket: buckets must be a positive integer, got %v", v5)}
+			}
+			v4 = float64(int64(okra.Bucket(strconv.FormatInt(int64((*data).Qty), 10), (*(*data).Ship).City, int(v5)))) > float64(int64(0))
+		}
+		v1 = v4
+	}
+	return v1, nil
+}
@@ -0,0 +1,56 @@
+// Package gentest cross-checks the code okra generates (see okra.GenerateGo)
+// against Program.Eval. rules.txt lists the rules; rules_gen.go is generated
+// from it by okra-gen and committed, and the tests fail when it is stale or
+// when a generated function disagrees with the interpreter on random orders.
+package gentest
+
+//go:generate go run ../../cmd/okra-gen -type *github.com/coolbit/okra/internal/gentest.Order -rules rules.txt -o rules_gen.go
+
+import "time"
+
+type Level int8
+
+type Status string
+
+type Base struct {
+	ID      int64
+	Created time.Time
+}
+
+type Address struct {
+	City string
+	Zip  string `json:"zip"`
+}
+
+type Item struct {
+	SKU   string
+	Qty   int
+	Price float64
+}
+
+// Order exercises every kind of value generated code handles: sized and
+// named integers, floats, strings, times, pointers (and a nil-able embedded
+// pointer), slices, arrays, maps, and interface-typed fields.
+type Order struct {
+	*Base
+	Amount   int64
+	Discount float32
+	Qty      int
+	Small    int8
+	Count    uint16
+	Rate     float64
+	Name     string
+	Status   Status
+	Level    Level
+	VIP      bool
+	Tags     []string
+	Scores   []int
+	Weights  [3]float64
+	Limits   map[string]int64
+	Codes    map[int]string
+	Items    []Item
+	Ship     *Address
+	Bill     Address `json:"billing"`
+	Paid     time.Time
+	Note     any
+}
@@ -0,0 +1,388 @@
+package okra
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Diagnostic is a finding reported by Lint: a sub-expression that is legal but
+// almost certainly not what the author meant.
+type Diagnostic struct {
+	// Check names the rule that fired: "tautology", "contradiction",
+	// "redundant-operand", "constant-comparison", "mismatched-types",
+	// "unreachable-branch", "identical-branches", "duplicate-element" or
+	// "unknown-enum-value".
+	Check   string
+	Message string
+	// Expr is the offending sub-expression as written.
+	Expr string
+	// Line, Column, Start and End locate Expr in Source, as for Error. They
+	// are 0 when the Program has no source (a hand-built AST).
+	Line, Column int
+	Start, End   int
+	Source       string
+}
+
+func (d Diagnostic) String() string {
+	if d.Line == 0 {
+		return d.Check + ": " + d.Message
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Check, d.Message)
+}
+
+// Snippet renders the offending source line with a caret marker, like
+// (*Error).Snippet.
+func (d Diagnostic) Snippet() string { return renderSnippet(d.Source, d.Start, d.End, d.Line) }
+
+// Linter reports suspicious constructs in compiled rules. The zero value runs
+// every structural check; Enums adds domain knowledge.
+type Linter struct {
+	// Enums maps an access path, spelled as in rules ("status",
+	// "user.Status"), to its complete set of known values. Comparing that path
+	// against a literal outside the set (`status == 'actve'`) is reported.
+	Enums map[string][]any
+}
+
+// Lint runs the default Linter over p.
+func Lint(p *Program) []Diagnostic { return (&Linter{}).Lint(p) }
+
+// Lint analyzes p as its author wrote it — before constant folding, which
+// would hide exactly the constant comparisons and dead branches it looks for —
+// and returns its findings ordered by position.
+func (l *Linter) Lint(p *Program) []Diagnostic {
+	ast, spans := p.ast, p.spans
+	if p.src != "" {
+		// Re-parse for the unfolded tree. It compiled once, so it parses again;
+		// the nesting bound only needs to exceed anything that fits in src.
+		if a, s, err := parseSource(p.src, len(p.src)+1); err == nil {
+			ast, spans = a, s
+		}
+	}
+	r := &linter{cfg: l, src: p.src, spans: spans}
+	r.run(ast)
+	sort.SliceStable(r.out, func(i, j int) bool { return r.out[i].Start < r.out[j].Start })
+	return r.out
+}
+
+type linter struct {
+	cfg   *Linter
+	src   string
+	spans map[Expr]span
+	out   []Diagnostic
+}
+
+// text is how a node is quoted in messages: its source text when known,
+// otherwise its canonical String() form.
+func (l *linter) text(e Expr) string {
+	if sp, ok := l.spans[e]; ok && l.src != "" {
+		return l.src[sp.start:sp.end]
+	}
+	return e.String()
+}
+
+func (l *linter) report(e Expr, check, format string, args ...any) {
+	d := Diagnostic{Check: check, Message: fmt.Sprintf(format, args...), Expr: l.text(e), Source: l.src}
+	if sp, ok := l.spans[e]; ok && l.src != "" {
+		d.Start, d.End = sp.start, sp.end
+		d.Line, d.Column = lineCol(l.src, sp.start)
+	}
+	l.out = append(l.out, d)
+}
+
+func (l *linter) run(ast Expr) {
+	// Operands nested inside a longer &&/|| chain are analyzed with the whole
+	// chain, at its top node.
+	inner := map[Expr]bool{}
+	walk(ast, func(e Expr) {
+		if in, ok := e.(*InfixExpr); ok && (in.Op == "&&" || in.Op == "||") {
+			for _, side := range []Expr{in.Left, in.Right} {
+				if c, ok := side.(*InfixExpr); ok && c.Op == in.Op {
+					inner[c] = true
+				}
+			}
+		}
+	})
+	walk(ast, func(e Expr) {
+		switch n := e.(type) {
+		case *InfixExpr:
+			switch n.Op {
+			case "&&", "||":
+				if !inner[n] {
+					l.chain(n)
+				}
+			case "==", "!=", "<", "<=", ">", ">=":
+				l.comparison(n)
+			case "in", "not in":
+				l.membership(n)
+			}
+		case *TernaryExpr:
+			l.ternary(n)
+		}
+	})
+}
+
+// comparison checks a single relational node.
+func (l *linter) comparison(n *InfixExpr) {
+	lv, lok := constant(n.Left)
+	rv, rok := constant(n.Right)
+	if lok && rok {
+		if lc, rc := valueCategory(lv), valueCategory(rv); lc != rc {
+			if n.Op == "==" || n.Op == "!=" {
+				l.report(n, "mismatched-types", "`%s` compares a %s with a %s, so it is always %v",
+					l.text(n), lc, rc, n.Op == "!=")
+			} else {
+				l.report(n, "mismatched-types", "`%s` orders a %s against a %s, which always fails",
+					l.text(n), lc, rc)
+			}
+			return
+		}
+		if v, ok := constant(n); ok {
+			l.report(n, "constant-comparison", "`%s` is always %v", l.text(n), v)
+		}
+		return
+	}
+	if pure(n.Left) && n.Left.String() == n.Right.String() {
+		switch n.Op {
+		case "==", "<=", ">=":
+			l.report(n, "tautology", "`%s` compares a value with itself, so it is always true", l.text(n))
+		default:
+			l.report(n, "contradiction", "`%s` compares a value with itself, so it is always false", l.text(n))
+		}
+		return
+	}
+	if n.Op == "==" || n.Op == "!=" {
+		if lok {
+			l.enumValue(n.Right, n.Left, lv)
+		} else if rok {
+			l.enumValue(n.Left, n.Right, rv)
+		}
+	}
+}
+
+// enumValue reports lit when path has a known value set that lacks it.
+func (l *linter) enumValue(path, lit Expr, v any) {
+	values, ok := l.cfg.Enums[path.String()]
+	if !ok {
+		return
+	}
+	for _, known := range values {
+		if valuesEqual(v, known) {
+			return
+		}
+	}
+	msg := fmt.Sprintf("%s is not a known value of %s", l.text(lit), path.String())
+	if s, ok := v.(string); ok {
+		var names []string
+		for _, known := range values {
+			if ks, ok := known.(string); ok {
+				names = append(names, ks)
+			}
+		}
+		if hint := suggest(s, names); len(hint) > 0 {
+			msg += fmt.Sprintf(" (did you mean %s?)", renderLiteral(hint[0]))
+		}
+	}
+	l.report(lit, "unknown-enum-value", "%s", msg)
+}
+
+// membership checks `x in [...]` against a list literal.
+func (l *linter) membership(n *InfixExpr) {
+	list, ok := n.Right.(*ListExpr)
+	if !ok {
+		return
+	}
+	var seen []any
+	for _, el := range list.Elems {
+		v, ok := constant(el)
+		if !ok {
+			continue
+		}
+		for _, prev := range seen {
+			if valuesEqual(v, prev) {
+				l.report(el, "duplicate-element", "%s is already in the list, so this element is dead", l.text(el))
+				break
+			}
+		}
+		seen = append(seen, v)
+		l.enumValue(n.Left, el, v)
+	}
+}
+
+// chain checks a whole && or || chain: operand pairs that cancel out or
+// repeat, and a path pinned to two different values.
+func (l *linter) chain(n *InfixExpr) {
+	var ops []Expr
+	var flatten func(e Expr)
+	flatten = func(e Expr) {
+		if c, ok := e.(*InfixExpr); ok && c.Op == n.Op {
+			flatten(c.Left)
+			flatten(c.Right)
+			return
+		}
+		ops = append(ops, e)
+	}
+	flatten(n)
+
+	always := "false"
+	check := "contradiction"
+	if n.Op == "||" {
+		always, check = "true", "tautology"
+	}
+	for i, a := range ops {
+		if !pure(a) {
+			continue
+		}
+		for _, b := range ops[i+1:] {
+			if !pure(b) {
+				continue
+			}
+			switch {
+			case a.String() == b.String():
+				l.report(b, "redundant-operand", "%s repeats an earlier operand of the same %s chain", l.text(b), n.Op)
+			case isNegationOf(a, b) || isNegationOf(b, a):
+				l.report(n, check, "`%s` combines %s with its negation, so it is always %s", l.text(n), l.text(a), always)
+			}
+		}
+	}
+
+	// p == 'a' && p == 'b' can never hold; p != 'a' || p != 'b' always does.
+	pin := "=="
+	if n.Op == "||" {
+		pin = "!="
+	}
+	type pinned struct {
+		lit  Expr
+		v    any
+		pins bool // compared with the pinning operator, not its inverse
+	}
+	byPath := map[string][]pinned{}
+	var order []string
+	for _, op := range ops {
+		c, ok := op.(*InfixExpr)
+		if !ok || (c.Op != "==" && c.Op != "!=") {
+			continue
+		}
+		path, lit := c.Left, c.Right
+		v, ok := constant(lit)
+		if !ok {
+			path, lit = c.Right, c.Left
+			if v, ok = constant(lit); !ok {
+				continue
+			}
+		}
+		if _, isConst := constant(path); isConst || !pure(path) {
+			continue
+		}
+		key := path.String()
+		if _, ok := byPath[key]; !ok {
+			order = append(order, key)
+		}
+		byPath[key] = append(byPath[key], pinned{lit, v, c.Op == pin})
+	}
+	for _, key := range order {
+		group := byPath[key]
+		cats := map[string]bool{}
+		var first *pinned
+		for i := range group {
+			cats[valueCategory(group[i].v)] = true
+			if !group[i].pins {
+				continue
+			}
+			if first == nil {
+				first = &group[i]
+			} else if !valuesEqual(first.v, group[i].v) {
+				l.report(n, check, "`%s` requires %s %s both %s and %s, so it is always %s",
+					l.text(n), key, pin, l.text(first.lit), l.text(group[i].lit), always)
+				first = &group[i] // one report per conflicting pair is enough
+			}
+		}
+		if len(cats) > 1 {
+			names := make([]string, 0, len(cats))
+			for c := range cats {
+				names = append(names, c)
+			}
+			sort.Strings(names)
+			l.report(n, "mismatched-types", "%s is compared with %s literals; at most one kind can ever match",
+				key, strings.Join(names, " and "))
+		}
+	}
+}
+
+// ternary checks a conditional for a constant condition or identical arms.
+func (l *linter) ternary(n *TernaryExpr) {
+	if v, ok := constant(n.Cond); ok {
+		if b, isBool := v.(bool); isBool {
+			dead := n.Else
+			if !b {
+				dead = n.Then
+			}
+			l.report(dead, "unreachable-branch", "the condition %s is always %v, so %s is never evaluated",
+				l.text(n.Cond), b, l.text(dead))
+		}
+		return
+	}
+	if pure(n.Then) && n.Then.String() == n.Else.String() {
+		l.report(n, "identical-branches", "both branches of `%s` are %s, so the condition does not matter",
+			l.text(n), l.text(n.Then))
+	}
+}
+
+// isNegationOf reports whether neg is `!e`.
+func isNegationOf(neg, e Expr) bool {
+	u, ok := neg.(*UnaryExpr)
+	return ok && u.Op == "!" && u.Right.String() == e.String()
+}
+
+// pure reports whether evaluating e twice is guaranteed to give the same
+// result: no function or method calls (now(), a stateful method, …).
+func pure(e Expr) bool {
+	ok := true
+	walk(e, func(n Expr) {
+		switch n.(type) {
+		case *CallExpr, *MethodCallExpr, *BadExpr:
+			ok = false
+		}
+	})
+	return ok
+}
+
+// constant evaluates e if it depends on nothing but literals, reporting false
+// when it reads data, calls anything, or fails to evaluate.
+func constant(e Expr) (any, bool) {
+	ok := true
+	walk(e, func(n Expr) {
+		switch n.(type) {
+		case *VariableExpr, *MemberAccessExpr, *IndexExpr, *CallExpr, *MethodCallExpr, *BadExpr:
+			ok = false
+		}
+	})
+	if !ok {
+		return nil, false
+	}
+	folded := tryFold(e)
+	lit, isLit := folded.(*LiteralExpr)
+	if !isLit {
+		return nil, false
+	}
+	return lit.Value, true
+}
+
+// valueCategory names the equality class of a constant: values in different
+// classes are never == to each other.
+func valueCategory(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	}
+	if _, ok := toNumber(v); ok {
+		return "number"
+	}
+	if k := reflect.ValueOf(v).Kind(); isSeqKind(k) {
+		return "list"
+	}
+	return fmt.Sprintf("%T", v)
+}
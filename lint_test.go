@@ -0,0 +1,75 @@
+package okra
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	e := NewEngine()
+	cases := []struct {
+		src  string
+		want []string // "check expr" per diagnostic, in order
+	}{
+		{"user.Age >= 18 && user.Country == 'NL'", nil},
+		{"user.Age == user.Age", []string{"tautology user.Age == user.Age"}},
+		{"x < x || y", []string{"contradiction x < x"}},
+		{"ok && y > 1 && !ok", []string{"contradiction ok && y > 1 && !ok"}},
+		{"!ok || ok", []string{"tautology !ok || ok"}},
+		{"a && b && a", []string{"redundant-operand a"}},
+		{"s == 'a' && s == 'b'", []string{"contradiction s == 'a' && s == 'b'"}},
+		{"s != 'a' || s != 'b'", []string{"tautology s != 'a' || s != 'b'"}},
+		{"s == 'a' && s == 'a' ", []string{"redundant-operand s == 'a'"}},
+		{"s == 1 || s == 'one'", []string{"mismatched-types s == 1 || s == 'one'"}},
+		{"x > 1 && 1 == '1'", []string{"mismatched-types 1 == '1'"}},
+		{"2 * 3 > 5 && x", []string{"constant-comparison 2 * 3 > 5"}},
+		{"1 == 1.0 ? x : y", []string{"constant-comparison 1 == 1.0", "unreachable-branch y"}},
+		{"false ? x : y", []string{"unreachable-branch x"}},
+		{"ok ? user.Name : user.Name", []string{"identical-branches ok ? user.Name : user.Name"}},
+		{"c in ['a', 'b', 'a', 'c', 'b']", []string{"duplicate-element 'a'", "duplicate-element 'b'"}},
+		{"n in [1, 2, 1.0]", []string{"duplicate-element 1.0"}},
+		// Calls may be impure, so repeating one is not a tautology.
+		{"now() == now() && rand() != rand()", nil},
+	}
+	for _, c := range cases {
+		prog, err := e.Compile(c.src)
+		if err != nil {
+			t.Fatalf("%q: %v", c.src, err)
+		}
+		var got []string
+		for _, d := range Lint(prog) {
+			got = append(got, d.Check+" "+d.Expr)
+			if c.src[d.Start:d.End] != d.Expr {
+				t.Errorf("%q: span [%d,%d) does not cover %q", c.src, d.Start, d.End, d.Expr)
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(c.want, "\n") {
+			t.Errorf("%q:\n got  %q\n want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestLintEnums(t *testing.T) {
+	prog, err := NewEngine().Compile("user.Status == 'actve' || user.Status in ['active', 'banned']\n  || plan != 'gold'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &Linter{Enums: map[string][]any{
+		"user.Status": {"active", "suspended"},
+		"plan":        {"free", "gold"},
+	}}
+	diags := l.Lint(prog)
+	if len(diags) != 2 {
+		t.Fatalf("got %v", diags)
+	}
+	if got := diags[0].String(); got != `1:16: unknown-enum-value: 'actve' is not a known value of user.Status (did you mean 'active'?)` {
+		t.Fatalf("got %s", got)
+	}
+	if d := diags[1]; d.Expr != "'banned'" || d.Line != 1 || d.Column != 53 {
+		t.Fatalf("got %+v", d)
+	}
+	want := "user.Status == 'actve' || user.Status in ['active', 'banned']\n                                                    ^^^^^^^^"
+	if got := diags[1].Snippet(); got != want {
+		t.Fatalf("Snippet:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,460 @@
+package okra
+
+import "sync"
+
+// Optimization is a set of optimizer passes Compile runs over a parsed rule
+// (see Engine.SetOptimizations). Every pass in OptAll preserves results,
+// errors and error positions — only an error's quoted sub-expression
+// (Error.Expr) shows the optimized form, as it already does for folded
+// constants. Rewrites that would drop a type check (`true && x` -> x) only
+// fire when x is statically a bool: a comparison, a logical operator, `in`,
+// `!`, or a bool literal. The opt-in passes after OptAll relax this slightly;
+// see OptReorder.
+type Optimization uint32
+
+const (
+	// OptFold evaluates sub-expressions built entirely from literals at
+	// compile time (`1 + 2 * 3` becomes `7`), including calls to pure
+	// functions (see Pure) with constant arguments (`lower('ABC')`).
+	OptFold Optimization = 1 << iota
+	// OptSimplify removes boolean identities: `true && x`, `x || false`, `!!x`
+	// and `x && x` become x, `false && x` becomes false, `c ? true : false`
+	// becomes c, and `!(a == b)` becomes `a != b`.
+	OptSimplify
+	// OptStrength replaces operations with cheaper equivalents: `x == true`
+	// becomes x, `x == false` becomes `!x`, and a chain of equality tests
+	// `x == 'a' || x == 'b'` becomes the single scan `x in ['a', 'b']` (and
+	// `x != 'a' && x != 'b'` becomes `x not in ['a', 'b']`).
+	OptStrength
+	// OptCSE evaluates a repeated side-effect-free sub-expression
+	// (`user.Profile.Score` in five places) once per evaluation and reuses the
+	// value.
+	OptCSE
+
+	// OptReorder evaluates the operands of a `&&` / `||` chain cheapest
+	// first, by the static cost model of Program.Cost (so WithCost
+	// annotations count): in a lenient `matches(s, re) && a == 1` the
+	// comparison runs first and usually spares the call. A chain is only
+	// reordered when no operand calls a method, a macro or an impure
+	// function, and only operands that cannot fail (see infallible) are ever
+	// skipped. Results and errors are unchanged: when an operand fails, the
+	// chain is evaluated again as written, so guards like
+	// `x != nil && x.a > 1` keep working. A getter may be called where, as
+	// written, the chain would have decided first. Opt-in; not part of
+	// OptAll.
+	OptReorder
+	// OptSelectivity is OptReorder adapting to the data: each chain counts
+	// how often every operand decides it (is false in `&&`, true in `||`)
+	// and periodically reorders them by cost per decision, so a cheap test
+	// that rarely decides anything moves behind a dearer one that usually
+	// does. Counting costs a few atomic additions per evaluated operand.
+	// Program.String shows the current order. Opt-in; implies OptReorder.
+	OptSelectivity
+
+	// OptAll enables every pass that preserves errors exactly (the default).
+	OptAll = OptFold | OptSimplify | OptStrength | OptCSE
+)
+
+// SetOptimizations selects the optimizer passes run by Compile; the default is
+// OptAll. Disable a pass with e.g. SetOptimizations(okra.OptAll &^ okra.OptCSE),
+// or add an opt-in one with SetOptimizations(okra.OptAll | okra.OptReorder).
+// Like every Engine setting, it only affects Programs compiled after the call.
+// Safe to call concurrently.
+func (e *Engine) SetOptimizations(o Optimization) {
+	e.flippedOpts.Store(uint32(o ^ OptAll))
+	e.changed()
+}
+
+func (e *Engine) optimizations() Optimization {
+	return OptAll ^ Optimization(e.flippedOpts.Load())
+}
+
+// String returns the Program's expression as Compile optimized it, in the
+// canonical fully-parenthesized form (a shared sub-expression is printed at
+// each of its uses).
+func (p *Program) String() string { return p.ast.String() }
+
+// optimize runs the enabled passes over the freshly parsed p.ast and prepares
+// `in` lookups against literal lists (see valueSet), setting p.slots to the
+// number of memo slots its shared sub-expressions use. Nodes that replace
+// others inherit their source spans. Macro arguments are never rewritten: a
+// macro receives them as written and may inspect them, and it may evaluate
+// them against other data, which would defeat sharing.
+func (p *Program) optimize(passes Optimization) {
+	ast := p.ast
+	if passes&OptFold != 0 {
+		ast = folder{pure: p.pureFuncs()}.fold(ast)
+	}
+	o := &optimizer{prog: p, passes: passes, spans: p.spans, macros: p.macros}
+	if passes&(OptSimplify|OptStrength) != 0 {
+		ast = o.rewrite(ast)
+	}
+	o.indexLists(ast)
+	if passes&OptCSE != 0 {
+		o.counts = map[string]int{}
+		o.slots = map[string]int{}
+		o.visit(ast, func(e Expr) {
+			if shareable(e) {
+				o.counts[e.String()]++
+			}
+		})
+		ast = o.share(ast, 0)
+	}
+	if passes&(OptReorder|OptSelectivity) != 0 {
+		o.pure = p.pureFuncs()
+		ast = o.reorder(ast)
+	}
+	p.ast, p.slots = ast, len(o.slots)
+}
+
+// pureFuncs returns the functions registered as Pure, except those a macro of
+// the same name shadows.
+func (p *Program) pureFuncs() map[string]CustomFunc {
+	pure := map[string]CustomFunc{}
+	for name, fn := range p.fns {
+		if _, ok := p.macros[name]; !ok && p.calls[callKey{name, false}].pure {
+			pure[name] = fn
+		}
+	}
+	return pure
+}
+
+type optimizer struct {
+	prog   *Program
+	passes Optimization
+	spans  map[Expr]span
+	macros map[string]MacroFunc
+	counts map[string]int // occurrences of each shareable sub-expression
+	slots  map[string]int // memo slot of each shared one
+	pure   map[string]CustomFunc
+}
+
+// inherit gives a replacement node the source span of the node it replaces.
+func (o *optimizer) inherit(old, repl Expr) {
+	if _, ok := o.spans[repl]; ok {
+		return
+	}
+	if sp, ok := o.spans[old]; ok {
+		o.spans[repl] = sp
+	}
+}
+
+// children calls fn on each direct sub-expression slot of e, letting fn
+// replace it, and skips macro arguments.
+func (o *optimizer) children(e Expr, fn func(Expr) Expr) {
+	switch n := e.(type) {
+	case *UnaryExpr:
+		n.Right = fn(n.Right)
+	case *InfixExpr:
+		n.Left = fn(n.Left)
+		n.Right = fn(n.Right)
+	case *TernaryExpr:
+		n.Cond = fn(n.Cond)
+		n.Then = fn(n.Then)
+		n.Else = fn(n.Else)
+	case *MemberAccessExpr:
+		n.Left = fn(n.Left)
+	case *IndexExpr:
+		n.Left = fn(n.Left)
+		n.Index = fn(n.Index)
+	case *MethodCallExpr:
+		n.Left = fn(n.Left)
+		for i := range n.Args {
+			n.Args[i] = fn(n.Args[i])
+		}
+	case *CallExpr:
+		if _, ok := o.macros[n.key()]; ok {
+			return
+		}
+		for i := range n.Args {
+			n.Args[i] = fn(n.Args[i])
+		}
+	case *ListExpr:
+		for i := range n.Elems {
+			n.Elems[i] = fn(n.Elems[i])
+		}
+	}
+}
+
+// visit calls fn on e and its sub-expressions in pre-order, outside macro
+// arguments.
+func (o *optimizer) visit(e Expr, fn func(Expr)) {
+	fn(e)
+	o.children(e, func(c Expr) Expr {
+		o.visit(c, fn)
+		return c
+	})
+}
+
+// rewrite applies the simplification and strength-reduction rules bottom-up,
+// repeating at each node until none applies.
+func (o *optimizer) rewrite(e Expr) Expr {
+	o.children(e, o.rewrite)
+	for {
+		next := e
+		if o.passes&OptSimplify != 0 {
+			next = simplify(e)
+		}
+		if next == e && o.passes&OptStrength != 0 {
+			next = reduce(e)
+		}
+		if next == e {
+			return e
+		}
+		o.inherit(e, next)
+		e = next
+	}
+}
+
+func simplify(e Expr) Expr {
+	switch n := e.(type) {
+	case *UnaryExpr:
+		if n.Op != "!" {
+			break
+		}
+		switch r := n.Right.(type) {
+		case *UnaryExpr:
+			if r.Op == "!" && isBoolExpr(r.Right) {
+				return r.Right
+			}
+		case *InfixExpr:
+			// == and != never fail, so nothing is lost with the `!`.
+			if r.Op == "==" || r.Op == "!=" {
+				return &InfixExpr{Left: r.Left, Op: negatedEq[r.Op], Right: r.Right}
+			}
+		}
+	case *InfixExpr:
+		if n.Op != "&&" && n.Op != "||" {
+			break
+		}
+		and := n.Op == "&&"
+		if b, ok := boolLiteral(n.Left); ok {
+			if b != and { // false && x, true || x
+				return &LiteralExpr{b}
+			}
+			if isBoolExpr(n.Right) {
+				return n.Right
+			}
+		}
+		if b, ok := boolLiteral(n.Right); ok && b == and && isBoolExpr(n.Left) {
+			return n.Left
+		}
+		if isBoolExpr(n.Left) && shareable(n.Left) && n.Left.String() == n.Right.String() {
+			return n.Left
+		}
+	case *TernaryExpr:
+		t, ok1 := boolLiteral(n.Then)
+		f, ok2 := boolLiteral(n.Else)
+		if ok1 && ok2 && t != f && isBoolExpr(n.Cond) {
+			if t {
+				return n.Cond
+			}
+			return &UnaryExpr{Op: "!", Right: n.Cond}
+		}
+	}
+	return e
+}
+
+var negatedEq = map[string]string{"==": "!=", "!=": "=="}
+
+func reduce(e Expr) Expr {
+	n, ok := e.(*InfixExpr)
+	if !ok {
+		return e
+	}
+	switch n.Op {
+	case "==", "!=":
+		x, b, ok := n.Left, false, false
+		if b, ok = boolLiteral(n.Right); !ok {
+			x = n.Right
+			b, ok = boolLiteral(n.Left)
+		}
+		if ok && isBoolExpr(x) {
+			if b == (n.Op == "==") {
+				return x
+			}
+			return &UnaryExpr{Op: "!", Right: x}
+		}
+	case "||", "&&":
+		if m := mergeTests(n.Op, n.Left, n.Right); m != nil {
+			return m
+		}
+		// (a || x == 1) || x == 2 -> a || x in [1, 2]. Regrouping is only
+		// invisible when a is a bool; otherwise it changes which node reports
+		// the type error.
+		if l, ok := n.Left.(*InfixExpr); ok && l.Op == n.Op && isBoolExpr(l.Left) {
+			if m := mergeTests(n.Op, l.Right, n.Right); m != nil {
+				return &InfixExpr{Left: l.Left, Op: n.Op, Right: m}
+			}
+		}
+	}
+	return e
+}
+
+// mergeTests merges two membership tests of the same pure operand joined by
+// op — equalities (or `in` a literal list) under ||, inequalities (or `not
+// in`) under && — into one `in` / `not in` over a literal list. It returns nil
+// when they don't merge. `in` compares list elements with the same equality as
+// ==, so the result is unchanged; the operand is just evaluated once.
+func mergeTests(op string, l, r Expr) Expr {
+	eq, in := "==", "in"
+	if op == "&&" {
+		eq, in = "!=", "not in"
+	}
+	lx, lv := memberTest(l, eq, in)
+	rx, rv := memberTest(r, eq, in)
+	if lx == nil || rx == nil || !shareable(lx) || lx.String() != rx.String() {
+		return nil
+	}
+	return &InfixExpr{Left: lx, Op: in, Right: &LiteralExpr{append(lv, rv...)}}
+}
+
+// memberTest matches `x eq lit`, `lit eq x` or `x in [lits]`, returning x and
+// the literal values.
+func memberTest(e Expr, eq, in string) (Expr, []any) {
+	n, ok := e.(*InfixExpr)
+	if !ok {
+		return nil, nil
+	}
+	switch n.Op {
+	case eq:
+		if lit, ok := n.Right.(*LiteralExpr); ok {
+			return n.Left, []any{lit.Value}
+		}
+		if lit, ok := n.Left.(*LiteralExpr); ok {
+			return n.Right, []any{lit.Value}
+		}
+	case in:
+		// A literal string haystack means substring search, not equality.
+		if lit, ok := n.Right.(*LiteralExpr); ok {
+			if vs, ok := lit.Value.([]any); ok {
+				return n.Left, append([]any(nil), vs...)
+			}
+		}
+	}
+	return nil, nil
+}
+
+func boolLiteral(e Expr) (bool, bool) {
+	if lit, ok := e.(*LiteralExpr); ok {
+		b, ok := lit.Value.(bool)
+		return b, ok
+	}
+	return false, false
+}
+
+// isBoolExpr reports whether e always evaluates to a bool (or fails).
+func isBoolExpr(e Expr) bool {
+	switch n := e.(type) {
+	case *LiteralExpr:
+		_, ok := n.Value.(bool)
+		return ok
+	case *UnaryExpr:
+		return n.Op == "!"
+	case *InfixExpr:
+		switch n.Op {
+		case "==", "!=", "<", "<=", ">", ">=", "&&", "||", "in", "not in":
+			return true
+		}
+	case *TernaryExpr:
+		return isBoolExpr(n.Then) && isBoolExpr(n.Else)
+	case *sharedExpr:
+		return isBoolExpr(n.X)
+	case *chainExpr:
+		return true
+	}
+	return false
+}
+
+// shareable reports whether e reads data without side effects: it is built
+// only from variables, member and index access, operators and literals, and
+// reads at least one variable. Member access may turn out to call a getter
+// (`user.FullName`), which only the data can tell; sharedExpr then declines to
+// share the value, so every occurrence calls it.
+func shareable(e Expr) bool {
+	ok, reads := true, false
+	walk(e, func(n Expr) {
+		switch n.(type) {
+		case *VariableExpr:
+			reads = true
+		case *LiteralExpr, *MemberAccessExpr, *IndexExpr, *UnaryExpr, *InfixExpr, *TernaryExpr, *ListExpr:
+		default:
+			ok = false
+		}
+	})
+	return ok && reads
+}
+
+// share wraps the repeated shareable sub-expressions of e in sharedExprs. A
+// sub-expression is shared when it occurs more often than the shared
+// expression enclosing it (whose count is inside), so `a.b` inside two
+// occurrences of `a.b.c` is left alone unless it also occurs elsewhere.
+func (o *optimizer) share(e Expr, inside int) Expr {
+	key, n := "", 0
+	switch e.(type) {
+	case *MemberAccessExpr, *IndexExpr, *UnaryExpr, *InfixExpr, *TernaryExpr:
+		if shareable(e) {
+			key = e.String()
+			n = o.counts[key]
+		}
+	}
+	shared := n >= 2 && n > inside
+	if shared {
+		inside = n
+	}
+	o.children(e, func(c Expr) Expr { return o.share(c, inside) })
+	if !shared {
+		return e
+	}
+	slot, ok := o.slots[key]
+	if !ok {
+		slot = len(o.slots)
+		o.slots[key] = slot
+	}
+	s := &sharedExpr{slot: slot, X: e}
+	o.inherit(e, s)
+	return s
+}
+
+// sharedExpr is one occurrence of a sub-expression that occurs several times
+// in a Program. Every occurrence keeps its own subtree (so an error still
+// points at the occurrence that failed) but they share a memo slot: the first
+// to evaluate successfully without calling a getter stores its value, and the
+// others reuse it.
+type sharedExpr struct {
+	slot int
+	X    Expr
+}
+
+// memoSlot is the per-evaluation value of a shared sub-expression. getters is
+// the getter count of the Context when the bytecode began evaluating it.
+type memoSlot struct {
+	v       any
+	ok      bool
+	getters uint64
+}
+
+func (e *sharedExpr) Eval(ctx Context) (any, error) {
+	if ctx.memo == nil {
+		return e.X.Eval(ctx)
+	}
+	if m := ctx.memo[e.slot]; m.ok {
+		return m.v, nil
+	}
+	getters := *ctx.getters
+	v, err := e.X.Eval(ctx)
+	if err == nil && *ctx.getters == getters {
+		ctx.memo[e.slot] = memoSlot{v: v, ok: true}
+	}
+	return v, err
+}
+
+func (e *sharedExpr) String() string { return e.X.String() }
+
+// memoBuf is the pooled memo of one evaluation.
+type memoBuf struct {
+	slots   []memoSlot
+	getters uint64
+}
+
+var memoPool = sync.Pool{New: func() any { return new(memoBuf) }}
@@ -0,0 +1,457 @@
+package okra
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestOptimizerRewrites(t *testing.T) {
+	cases := []struct{ src, want string }{
+		{"true && a > 1", "(a > 1)"},
+		{"a > 1 || false", "(a > 1)"},
+		{"false && a", "false"},
+		{"!!(a > 1)", "(a > 1)"},
+		{"!(a == 1)", "(a != 1)"},
+		{"a > 1 ? false : true", "(!(a > 1))"},
+		{"a > 1 && a > 1", "(a > 1)"},
+		{"false == (a > 1)", "(!(a > 1))"},
+		{"s == 'x' || 'y' == s || s in ['z']", "(s in ['x', 'y', 'z'])"},
+		{"a > 0 || s == 'x' || s == 'y'", "((a > 0) || (s in ['x', 'y']))"},
+		{"s != 'x' && s != 'y'", "(s not in ['x', 'y'])"},
+		// Rewrites that would drop a bool check, or substring `in`, don't fire.
+		{"true && a", "(true && a)"},
+		{"!!a", "(!(!a))"},
+		{"a == true", "(a == true)"},
+		{"t || s == 'x' || s == 'y'", "((t || (s == 'x')) || (s == 'y'))"},
+		{"s == 'x' || s in 'xyz'", "((s == 'x') || (s in 'xyz'))"},
+		{"f() == 1 || f() == 2", "((f() == 1) || (f() == 2))"},
+	}
+	for _, c := range cases {
+		prog, err := NewEngine().Compile(c.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := prog.String(); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.src, got, c.want)
+		}
+	}
+
+	e := NewEngine()
+	e.SetOptimizations(OptAll &^ OptSimplify &^ OptFold)
+	prog, _ := e.Compile("true && 1 + 1 > a")
+	if got := prog.String(); got != "(true && ((1 + 1) > a))" {
+		t.Fatalf("passes disabled: %s", got)
+	}
+}
+
+// optDiff evaluates a rule compiled with every pass and with folding alone,
+// returning a description of any difference in value, error, or error
+// position. An error's quoted sub-expression may differ: it shows the
+// optimized form.
+func optDiff(plain, opt *Engine, src string) string {
+	pp, err := plain.Compile(src)
+	if err != nil {
+		return ""
+	}
+	op, err := opt.Compile(src)
+	if err != nil {
+		return fmt.Sprintf("optimized compile failed: %v", err)
+	}
+	pv, perr := pp.Eval(vmData())
+	ov, oerr := op.Eval(vmData())
+	cause := func(err error) (string, int, int) {
+		var oe *Error
+		if errors.As(err, &oe) {
+			return oe.Err.Error(), oe.Line, oe.Column
+		}
+		return fmt.Sprint(err), 0, 0
+	}
+	pc, pl, pcol := cause(perr)
+	oc, ol, ocol := cause(oerr)
+	if pc != oc || pl != ol || pcol != ocol {
+		return fmt.Sprintf("error %v at %d:%d, optimized (%s) %v at %d:%d", perr, pl, pcol, op, oerr, ol, ocol)
+	}
+	if perr == nil && !reflect.DeepEqual(pv, ov) {
+		return fmt.Sprintf("%#v, optimized (%s) %#v", pv, op, ov)
+	}
+	return ""
+}
+
+func TestOptimizerPreservesResults(t *testing.T) {
+	exprs := append([]string{
+		"t && a > 1 || false", "!!(a > b)", "!(s == 'okra') ? 1 : 2", "(a > b) == false",
+		"s == 'x' || s == 'okra' || s == 'z'", "s != 'x' && s != 'okra'", "a == 1 || a == 7.0",
+		"user.Age > 18 && user.Age < 65 && user.Age != 40", "user.Nmae == 'x' || user.Nmae == 'y'",
+		"user.Next.Name == 'x' || user.Next.Name == 'y'", "user.Tags[0] + user.Tags[0]",
+		"t ? user.Age : user.Age + 1", "any(orders, price > 50) && any(orders, price > 50)",
+		"m.inner.z == 'deep' && len(m.inner.z) == 4", "xs[a - 6] + xs[a - 6] * xs[a - 6]",
+		"0 % !!!t",
+	}, vmExprs...)
+	for _, strict := range []bool{true, false} {
+		plain, opt := vmEngine(t), vmEngine(t)
+		plain.SetOptimizations(OptFold)
+		plain.SetStrict(strict)
+		opt.SetStrict(strict)
+		for _, src := range exprs {
+			if msg := optDiff(plain, opt, src); msg != "" {
+				t.Errorf("strict=%v %s: %s", strict, src, msg)
+			}
+		}
+	}
+}
+
+func FuzzOptimizerPreservesResults(f *testing.F) {
+	for _, s := range vmExprs {
+		f.Add(s)
+	}
+	plain, opt := vmEngine(f), vmEngine(f)
+	plain.SetOptimizations(OptFold)
+	lenientPlain, lenientOpt := vmEngine(f), vmEngine(f)
+	lenientPlain.SetOptimizations(OptFold)
+	lenientPlain.SetStrict(false)
+	lenientOpt.SetStrict(false)
+	f.Fuzz(func(t *testing.T, src string) {
+		if msg := optDiff(plain, opt, src); msg != "" {
+			t.Fatalf("%s: %s", src, msg)
+		}
+		if msg := optDiff(lenientPlain, lenientOpt, src); msg != "" {
+			t.Fatalf("lenient %s: %s", src, msg)
+		}
+	})
+}
+
+type cseUser struct {
+	Level int
+	reads *int
+}
+
+func (u cseUser) Score() int { *u.reads++; return 42 }
+
+func TestCSE(t *testing.T) {
+	var reads int
+	data := map[string]any{"u": cseUser{Level: 3, reads: &reads}, "ok": true}
+	// A getter's calls are observable: it is called at every occurrence,
+	// shared or not.
+	cases := []struct {
+		src   string
+		reads int
+	}{
+		{"u.Score > 1 && u.Score < 100 && u.Score != 7", 3},
+		{"ok ? u.Score : u.Score + 1", 1},
+		{"!ok && u.Score > 1 || u.Score > 2", 1},
+		{"u.Score + u.Score * (ok ? u.Score : 0)", 3},
+		{"u.Level + u.Score > 1 && u.Level + u.Score < 100", 2},
+	}
+	for _, c := range cases {
+		for _, passes := range []Optimization{OptAll, OptAll &^ OptCSE} {
+			e := NewEngine()
+			e.SetOptimizations(passes)
+			prog, err := e.Compile(c.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range []*Program{prog, treeWalk(prog)} {
+				reads = 0
+				if _, err := p.Eval(data); err != nil {
+					t.Fatal(err)
+				}
+				if reads != c.reads {
+					t.Errorf("%s (passes %b): %d reads, want %d", c.src, passes, reads, c.reads)
+				}
+			}
+		}
+	}
+
+	// Anything else is read once and its value reused, unless it read a
+	// getter meanwhile.
+	for src, want := range map[string]bool{
+		"u.Level > 1 && u.Level < 100":                      true,
+		"ok ? u.Level : u.Level + 1":                        true,
+		"u.Score > 1 && u.Score < 100":                      false,
+		"u.Level + u.Score > 1 == !(u.Level + u.Score > 1)": false,
+	} {
+		prog, err := NewEngine().Compile(src)
+		if err != nil || prog.slots != 1 {
+			t.Fatalf("%s: %d slots, %v", src, prog.slots, err)
+		}
+		for _, p := range []*Program{prog, treeWalk(prog)} {
+			var getters uint64
+			ctx := p.context(data)
+			ctx.memo, ctx.getters = make([]memoSlot, 1), &getters
+			if _, err := p.eval(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if ctx.memo[0].ok != want {
+				t.Errorf("%s: shared %v, want %v", src, ctx.memo[0].ok, want)
+			}
+		}
+	}
+
+	// Macro arguments are evaluated against other data; they are never shared.
+	e := vmEngine(t)
+	prog, _ := e.Compile("any(orders, price > 50) && price > 50")
+	if prog.slots != 0 {
+		t.Fatalf("shared a macro argument: %d slots", prog.slots)
+	}
+	_, err := prog.Eval(map[string]any{"orders": []map[string]any{{"price": int64(60)}}, "price": int64(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPureFold(t *testing.T) {
+	e := NewEngine()
+	calls := 0
+	sq := func(args []any) (any, error) {
+		calls++
+		n, ok := args[0].(int64)
+		if !ok {
+			return nil, fmt.Errorf("sq: want int64, got %T", args[0])
+		}
+		return n * n, nil
+	}
+	if err := e.RegisterFunc("sq", sq, Pure()); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.RegisterFunc("impure", sq); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct{ src, want string }{
+		{"lower('ABC') + upper('x')", "'abcX'"},
+		{"len('abc') * 2 + sq(1 + 2)", "15"},
+		{"date('2026-01-01') < date('2027-01-01')", "true"},
+		{"date('2026-01-01T10:00:00+02:00')", "date('2026-01-01T10:00:00+02:00')"},
+		{"contains(lower(s), lower('X'))", "contains(lower(s), 'x')"},
+		{"now() > 0", "(now() > 0)"},
+		{"impure(3)", "impure(3)"},
+		{"sq('a')", "sq('a')"}, // fails: left to fail at Eval
+	}
+	for _, c := range cases {
+		prog, err := e.Compile(c.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := prog.String(); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.src, got, c.want)
+		}
+	}
+	// A folded time literal's String() compiles back to the same instant.
+	prog, _ := e.Compile("date('2026-01-01T10:00:00.5+02:00')")
+	again, err := e.Compile(prog.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1, _ := prog.Eval(nil)
+	v2, _ := again.Eval(nil)
+	if !valuesEqual(v1, v2) {
+		t.Fatalf("%s: %v != %v", prog, v1, v2)
+	}
+
+	calls = 0
+	prog, _ = e.Compile("sq(4) + impure(2)")
+	if calls != 1 {
+		t.Fatalf("compile made %d calls, want 1 (the pure one)", calls)
+	}
+	for range 3 {
+		if v, err := prog.Eval(nil); v != int64(20) || err != nil {
+			t.Fatalf("%v, %v", v, err)
+		}
+	}
+	if calls != 4 {
+		t.Fatalf("%d calls after 3 evals, want only the impure ones", calls)
+	}
+	if _, err := e.Eval("sq('a')", nil); err == nil || err.Error() != "sq('a'): sq: want int64, got string" {
+		t.Fatalf("unfolded error = %v", err)
+	}
+
+	// A macro of the same name wins, re-registering without Pure makes the
+	// function impure again, and disabling folding disables it for calls too.
+	for _, c := range []struct {
+		name, src string
+		change    func()
+	}{
+		{"macro", "sq(2)", func() { _ = e.RegisterMacro("sq", func(Context, []Expr) (any, error) { return int64(0), nil }) }},
+		{"reregister", "lower(2)", func() { _ = e.RegisterFunc("lower", sq) }},
+		{"no fold", "upper('a')", func() { e.SetOptimizations(OptAll &^ OptFold) }},
+	} {
+		c.change()
+		if prog, _ := e.Compile(c.src); prog.String() != c.src {
+			t.Errorf("%s: %s folded to %s", c.name, c.src, prog)
+		}
+	}
+}
+
+func TestRegisterAtomic(t *testing.T) {
+	e := NewEngine()
+	pure := func([]any) (any, error) { return int64(1), nil }
+	impure := func([]any) (any, error) { return int64(2), nil }
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 500 {
+			e.RegisterFunc("f", pure, Pure())
+			e.RegisterFunc("f", impure)
+		}
+	}()
+	// Concurrent registrations of other names are all kept.
+	go func() {
+		defer wg.Done()
+		for i := range 500 {
+			e.RegisterMacro(fmt.Sprintf("m%d", i), func(Context, []Expr) (any, error) { return nil, nil })
+		}
+	}()
+	for range 500 {
+		// An impure f is never folded with the purity of the pure one.
+		prog, err := e.Compile("f()")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prog.String() == "2" {
+			t.Fatal("folded the impure function")
+		}
+	}
+	wg.Wait()
+	if n := len(e.loadCallables().macros); n != 500 {
+		t.Fatalf("%d macros registered, want 500", n)
+	}
+}
+
+func TestReorder(t *testing.T) {
+	reorderEngine := func(passes Optimization) *Engine {
+		e := vmEngine(t)
+		_ = e.RegisterFunc("slow", func([]any) (any, error) { return true, nil }, WithCost(50), Pure())
+		e.SetOptimizations(passes)
+		return e
+	}
+	e := reorderEngine(OptAll | OptReorder)
+	e.SetStrict(false)
+	cases := []struct{ src, want string }{
+		{"slow(s) && a == 1", "((a == 1) && slow(s))"},
+		{"a == 1 && (slow(s) && t)", "((t && (a == 1)) && slow(s))"},
+		{"!(slow(s) || t) && a == 1", "((a == 1) && (!(slow(s) || t)))"},
+		{"slow(s) && s in ['x', 'y'] && a != b", "(((a != b) && (s in ['x', 'y'])) && slow(s))"},
+		// Already in order, with an operand that may have side effects, or
+		// with every operand able to fail: a comparison, a member access, a
+		// call, a strict lookup, or a variable that may not hold a bool.
+		{"a == 1 && slow(s)", "((a == 1) && slow(s))"},
+		{"user.Greet('x') == '' && a == 1", "((user.Greet('x') == '') && (a == 1))"},
+		{"any(orders, price > 50) && a == 1", "(any(orders, (price > 50)) && (a == 1))"},
+		{"slow(s) && a > 1", "(slow(s) && (a > 1))"},
+		{"slow(s) || user.Age > 1 && t", "(slow(s) || ((user.Age > 1) && t))"},
+	}
+	for _, c := range cases {
+		prog, err := e.Compile(c.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := prog.String(); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.src, got, c.want)
+		}
+	}
+	if prog, _ := reorderEngine(OptAll | OptReorder).Compile("slow(s) && a == 1"); prog.String() != "(slow(s) && (a == 1))" {
+		t.Errorf("reordered a strict lookup: %s", prog)
+	}
+
+	// Against the written order: the same value and the same error, whichever
+	// operand decides or fails first.
+	exprs := append([]string{
+		"slow(s) && user.Nmae > 1", "user.Nmae > 1 && a < 0", "user.Next == nil_ || user.Next.Name == 'x'",
+		"user.Next.Name == 'x' && t && 1 > 0 && slow(s)", "s + 1 == 'x' || a > 1 || slow(s)",
+		"a && slow(s)", "slow(s) && 5", "(slow(s) && a) ? 1 : 2", "(slow(s) || f > 3) == (t && slow(s))",
+		"s + 1 == 'x' && a == 0", "slow(s) && nope == 1", "user.Nmae == 1 || t", "t || s > 1 || nope",
+		"slow(s) && (a == 0 || s - 1 == 0) && n == 1", "s > 1 && t && a == 0 && slow(s)",
+		"(a == 7 ? s : n) && !t", "(a == 7 ? s : n) || t", "s && a == 0", "a == 7 || s",
+	}, vmExprs...)
+	for _, strict := range []bool{true, false} {
+		plain, opt := reorderEngine(OptAll), reorderEngine(OptAll|OptReorder)
+		plain.SetStrict(strict)
+		opt.SetStrict(strict)
+		for _, src := range exprs {
+			pp, err := plain.Compile(src)
+			if err != nil {
+				continue
+			}
+			op, _ := opt.Compile(src)
+			if msg := vmCheck(op, vmData()); msg != "" {
+				t.Errorf("strict=%v %s: %s", strict, src, msg)
+			}
+			pv, perr := pp.Eval(vmData())
+			ov, oerr := op.Eval(vmData())
+			switch {
+			case fmt.Sprint(oerr) != fmt.Sprint(perr):
+				t.Errorf("strict=%v %s: error %v, reordered (%s) %v", strict, src, perr, op, oerr)
+			case perr == nil && !reflect.DeepEqual(pv, ov):
+				t.Errorf("strict=%v %s: %#v, reordered (%s) %#v", strict, src, pv, op, ov)
+			}
+		}
+	}
+
+	// In a Registry a variable may name a rule that fails.
+	for _, passes := range []Optimization{OptAll, OptAll | OptReorder} {
+		re := reorderEngine(passes)
+		re.SetStrict(false)
+		reg := NewRegistry(re)
+		if err := reg.Define("bad", "s + 1 == 'x'"); err != nil {
+			t.Fatal(err)
+		}
+		if err := reg.Define("r", "bad in [true, 1] && a == 0"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reg.Eval("r", vmData()); err == nil {
+			t.Errorf("passes %b: the failing rule was skipped", passes)
+		}
+	}
+
+	prog, _ := e.Compile("slow(s) && a > 1")
+	if _, err := GenerateGo(genConfig(), GenFunc{Name: "F", Program: prog}); err == nil {
+		t.Error("GenerateGo accepted a reordered chain")
+	}
+}
+
+func TestReorderSelectivity(t *testing.T) {
+	e := NewEngine()
+	e.SetStrict(false)
+	e.SetOptimizations(OptAll | OptSelectivity)
+	prog, err := e.Compile("a != 0 && b == 1 || c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prog.String(); got != "(c || ((a != 0) && (b == 1)))" {
+		t.Fatalf("initial order %s", got)
+	}
+	// b == 1 almost never holds, a != 0 always: b moves first. c is
+	// never true, so it moves behind the && chain.
+	for _, p := range []*Program{prog, treeWalk(prog)} {
+		for i := range 3 * rerankEvery {
+			data := map[string]any{"a": int64(20), "b": int64(i % 50), "c": false}
+			if _, err := p.Eval(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if got := prog.String(); got != "(((b == 1) && (a != 0)) || c)" {
+		t.Fatalf("adapted order %s", got)
+	}
+
+	// a == 1 always holds and moves first, but a c that does not hold a
+	// bool still fails the chain, as it does written.
+	prog, err = e.Compile("c || a == 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*Program{prog, treeWalk(prog)} {
+		for i := range 3 * rerankEvery {
+			data := map[string]any{"a": int64(1), "c": false}
+			if i%50 == 0 {
+				data["c"] = "str"
+			}
+			if _, err := p.Eval(data); (err != nil) != (i%50 == 0) {
+				t.Fatalf("%s, c = %v: %v", prog, data["c"], err)
+			}
+		}
+	}
+}
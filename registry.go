@@ -0,0 +1,274 @@
+package okra
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry is a collection of named rules that refer to each other by name:
+//
+//	reg := okra.NewRegistry(engine)
+//	_ = reg.Define("isVip", "customer.Tier in ['gold', 'vip']")
+//	_ = reg.Define("isFraud", "order.Amount > 10000 && customer.AgeDays < 7")
+//	_ = reg.Define("approve", "isVip && !isFraud")
+//	ok, err := reg.Eval("approve", data)
+//
+// A rule's dependencies are the identifiers of its Vars that name other rules
+// of the registry; in a rule, such an identifier is the value of that rule,
+// ahead of any data field of the same name. Define rejects a rule that would
+// make the dependencies cyclic, so rules may be defined in any order. Within
+// one evaluation every rule is evaluated at most once, when first needed, and
+// its value (or error) reused.
+//
+// As for Vars, identifiers in macro arguments count as dependencies, even
+// where the macro re-roots them. A Registry is safe for concurrent use; Define
+// and Remove do not disturb evaluations in flight.
+type Registry struct {
+	engine *Engine
+	mu     sync.Mutex // serializes Define and Remove
+	defs   atomic.Pointer[registryDefs]
+}
+
+// registryDefs is one version of a Registry's rules.
+type registryDefs struct {
+	rules map[string]*namedRule
+	// order lists the rules in topological order, every rule after its
+	// dependencies, otherwise in the order defined.
+	order []string
+}
+
+type namedRule struct {
+	name string
+	prog *Program
+	seq  int      // definition order
+	deps []string // sorted
+	slot int      // in order
+}
+
+// NewRegistry returns an empty Registry whose rules are compiled with e.
+func NewRegistry(e *Engine) *Registry {
+	r := &Registry{engine: e}
+	r.defs.Store(&registryDefs{rules: map[string]*namedRule{}})
+	return r
+}
+
+// Define compiles src and adds it to the registry as name, which must be an
+// identifier not yet defined. It fails with ErrCycle, naming the cycle, when
+// the rule would depend on itself, directly or through other rules.
+func (r *Registry) Define(name, src string) error {
+	if e, err := ParseExpr(name); err != nil || !isIdent(e, name) {
+		return fmt.Errorf("okra: rule name %q is not an identifier", name)
+	}
+	prog, err := r.engine.Compile(src)
+	if err != nil {
+		return fmt.Errorf("okra: rule %q: %w", name, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.defs.Load()
+	if _, ok := old.rules[name]; ok {
+		return fmt.Errorf("okra: duplicate rule %q", name)
+	}
+	rules := maps.Clone(old.rules)
+	rules[name] = &namedRule{name: name, prog: prog, seq: len(old.rules)}
+	defs, err := link(rules)
+	if err != nil {
+		return fmt.Errorf("okra: rule %q: %w", name, err)
+	}
+	r.defs.Store(defs)
+	return nil
+}
+
+// Remove removes the named rule, reporting whether it was defined. Rules that
+// referred to it read the data field of that name from then on.
+func (r *Registry) Remove(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.defs.Load()
+	if _, ok := old.rules[name]; !ok {
+		return false
+	}
+	rules := maps.Clone(old.rules)
+	delete(rules, name)
+	defs, _ := link(rules) // removing a rule cannot close a cycle
+	r.defs.Store(defs)
+	return true
+}
+
+// Names returns the names of the rules in topological order: every rule after
+// the rules it depends on.
+func (r *Registry) Names() []string { return slices.Clone(r.defs.Load().order) }
+
+// Deps returns the names of the rules the named rule refers to, sorted, or nil
+// when it is not defined.
+func (r *Registry) Deps(name string) []string {
+	if nr, ok := r.defs.Load().rules[name]; ok {
+		return slices.Clone(nr.deps)
+	}
+	return nil
+}
+
+func isIdent(e Expr, name string) bool {
+	v, ok := e.(*VariableExpr)
+	return ok && v.Name == name
+}
+
+// link resolves the dependencies of rules, which are fresh copies apart from
+// their Programs, and orders them, failing on a cycle.
+func link(rules map[string]*namedRule) (*registryDefs, error) {
+	defs := &registryDefs{rules: map[string]*namedRule{}}
+	byDef := make([]*namedRule, 0, len(rules))
+	for name, nr := range rules {
+		cp := &namedRule{name: name, prog: nr.prog, seq: nr.seq}
+		for _, v := range nr.prog.Vars() {
+			if _, ok := rules[v]; ok {
+				cp.deps = append(cp.deps, v)
+			}
+		}
+		defs.rules[name] = cp
+		byDef = append(byDef, cp)
+	}
+	slices.SortFunc(byDef, func(a, b *namedRule) int { return a.seq - b.seq })
+	for i, nr := range byDef {
+		nr.seq = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var path []string
+	var visit func(nr *namedRule) error
+	visit = func(nr *namedRule) error {
+		switch state[nr.name] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := append(path[slices.Index(path, nr.name):], nr.name)
+			return fmt.Errorf("%w %s", ErrCycle, strings.Join(cycle, " -> "))
+		}
+		state[nr.name] = visiting
+		path = append(path, nr.name)
+		for _, d := range nr.deps {
+			if err := visit(defs.rules[d]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[nr.name] = visited
+		nr.slot = len(defs.order)
+		defs.order = append(defs.order, nr.name)
+		return nil
+	}
+	for _, nr := range byDef {
+		if err := visit(nr); err != nil {
+			return nil, err
+		}
+	}
+	return defs, nil
+}
+
+// Eval evaluates the named rule against data, evaluating the rules it depends
+// on as they are reached. An error names the rule it comes from, outermost
+// first (`okra: rule "approve": rule "isFraud": …`), and wraps the Program's, so
+// errors.As still finds the *Error.
+func (r *Registry) Eval(name string, data any) (any, error) {
+	return r.scope(data, nil).eval(name)
+}
+
+// EvalContext is Eval with the cancellation of Program.EvalContext applied
+// across the rules evaluated, as for RuleSet.EvalContext.
+func (r *Registry) EvalContext(ctx context.Context, name string, data any) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.scope(data, ctx).eval(name)
+}
+
+// EvalAll evaluates every rule against data, in topological order, and returns
+// their values by name. The first error stops the evaluation; EvalAll then
+// returns the values of the rules evaluated before it along with the error.
+func (r *Registry) EvalAll(data any) (map[string]any, error) {
+	s := r.scope(data, nil)
+	out := make(map[string]any, len(s.defs.order))
+	for _, name := range s.defs.order {
+		v, err := s.eval(name)
+		if err != nil {
+			return out, err
+		}
+		out[name] = v
+	}
+	return out, nil
+}
+
+func (r *Registry) scope(data any, ctx context.Context) *ruleScope {
+	defs := r.defs.Load()
+	s := &ruleScope{
+		defs: defs,
+		done: make([]bool, len(defs.order)),
+		vals: make([]any, len(defs.order)),
+		errs: make([]error, len(defs.order)),
+	}
+	var steps uint64
+	s.contextOf = func(p *Program) Context {
+		c := p.context(data)
+		c.rules = s
+		if ctx != nil {
+			c.ctx, c.steps = ctx, &steps
+		}
+		return c
+	}
+	return s
+}
+
+// ruleScope is the state of one evaluation of a Registry: the value of each
+// rule evaluated so far.
+type ruleScope struct {
+	defs      *registryDefs
+	contextOf func(*Program) Context
+	done      []bool
+	vals      []any
+	errs      []error
+}
+
+func (s *ruleScope) eval(name string) (any, error) {
+	nr, ok := s.defs.rules[name]
+	if !ok {
+		return nil, fmt.Errorf("okra: no rule %q", name)
+	}
+	v, err := s.value(nr)
+	if err != nil {
+		err = setError(s.contextOf(nr.prog), err, fmt.Sprintf("okra: rule %q", name))
+	}
+	return v, err
+}
+
+// get returns the value of the named rule as referenced from another rule,
+// evaluating it on first use, and reports whether there is such a rule.
+func (s *ruleScope) get(name string) (any, bool, error) {
+	nr, ok := s.defs.rules[name]
+	if !ok {
+		return nil, false, nil
+	}
+	v, err := s.value(nr)
+	if err != nil {
+		err = setError(s.contextOf(nr.prog), err, fmt.Sprintf("rule %q", name))
+	}
+	return v, true, err
+}
+
+// value returns the value of nr, evaluating it on first use.
+func (s *ruleScope) value(nr *namedRule) (any, error) {
+	if !s.done[nr.slot] {
+		v, err := nr.prog.run(s.contextOf(nr.prog))
+		s.done[nr.slot], s.vals[nr.slot], s.errs[nr.slot] = true, v, err
+	}
+	return s.vals[nr.slot], s.errs[nr.slot]
+}
@@ -0,0 +1,126 @@
+package okra
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func registry(t *testing.T, e *Engine, defs ...[2]string) *Registry {
+	t.Helper()
+	reg := NewRegistry(e)
+	for _, d := range defs {
+		if err := reg.Define(d[0], d[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return reg
+}
+
+func TestRegistry(t *testing.T) {
+	e := NewEngine()
+	calls := map[string]int{}
+	_ = e.RegisterFunc("count", func(args []any) (any, error) {
+		calls[args[0].(string)]++
+		return true, nil
+	})
+	// Defined before the rules it refers to, which it reads as rules once they
+	// exist.
+	reg := registry(t, e,
+		[2]string{"approve", "isVip && !isFraud && (isVip || tier == 'x')"},
+		[2]string{"isVip", "count('vip') && tier in ['gold', 'vip']"},
+		[2]string{"isFraud", "count('fraud') && amount > limit"},
+		[2]string{"limit", "isVip ? 10000 : 1000"},
+		[2]string{"tier", "'gold'"}, // shadows the data field
+	)
+	if got := reg.Names(); !reflect.DeepEqual(got, []string{"tier", "isVip", "limit", "isFraud", "approve"}) {
+		t.Fatalf("order %v", got)
+	}
+	if got := reg.Deps("approve"); !reflect.DeepEqual(got, []string{"isFraud", "isVip", "tier"}) {
+		t.Fatalf("deps %v", got)
+	}
+	if reg.Deps("nope") != nil {
+		t.Fatal("deps of an undefined rule")
+	}
+
+	data := map[string]any{"tier": "bronze", "amount": int64(5000)}
+	for _, mode := range []string{"vm", "tree"} {
+		if mode == "tree" {
+			for _, nr := range reg.defs.Load().rules {
+				nr.prog = treeWalk(nr.prog)
+			}
+		}
+		clear(calls)
+		if v, err := reg.Eval("approve", data); err != nil || v != true {
+			t.Fatalf("%s: approve = %v, %v", mode, v, err)
+		}
+		if calls["vip"] != 1 || calls["fraud"] != 1 {
+			t.Fatalf("%s: rules evaluated %v times, want once each", mode, calls)
+		}
+		if v, err := reg.EvalContext(context.Background(), "limit", data); err != nil || v != int64(10000) {
+			t.Fatalf("%s: limit = %v, %v", mode, v, err)
+		}
+		all, err := reg.EvalAll(data)
+		want := map[string]any{"approve": true, "isVip": true, "isFraud": false, "limit": int64(10000), "tier": "gold"}
+		if err != nil || !reflect.DeepEqual(all, want) {
+			t.Fatalf("%s: EvalAll = %v, %v", mode, all, err)
+		}
+	}
+
+	// Without the rule, the identifier is the data field again.
+	if !reg.Remove("tier") || reg.Remove("tier") {
+		t.Fatal("Remove")
+	}
+	if v, err := reg.Eval("isVip", data); err != nil || v != false {
+		t.Fatalf("after Remove: %v, %v", v, err)
+	}
+	if got := reg.Deps("approve"); !reflect.DeepEqual(got, []string{"isFraud", "isVip"}) {
+		t.Fatalf("deps after Remove %v", got)
+	}
+}
+
+func TestRegistryCycles(t *testing.T) {
+	reg := registry(t, NewEngine(), [2]string{"a", "b > 1"}, [2]string{"b", "c + 1"})
+	cases := []struct{ name, src, err string }{
+		{"self", "self + 1", `okra: rule "self": dependency cycle self -> self`},
+		{"c", "a ? 1 : 2", `okra: rule "c": dependency cycle a -> b -> c -> a`},
+	}
+	for _, c := range cases {
+		err := reg.Define(c.name, c.src)
+		if !errors.Is(err, ErrCycle) || err.Error() != c.err {
+			t.Errorf("%s: %v, want %q", c.name, err, c.err)
+		}
+	}
+	if got := reg.Names(); !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Fatalf("a rejected rule was kept: %v", got)
+	}
+}
+
+func TestRegistryErrors(t *testing.T) {
+	reg := registry(t, NewEngine(),
+		[2]string{"ratio", "total / count"},
+		[2]string{"high", "ratio > 2"},
+	)
+	_, err := reg.Eval("high", map[string]any{"total": int64(4), "count": int64(0)})
+	var oe *Error
+	if !errors.Is(err, ErrDivByZero) || !errors.As(err, &oe) || oe.Source != "total / count" ||
+		!strings.HasPrefix(err.Error(), `okra: rule "high": rule "ratio": `) {
+		t.Fatalf("nested error: %v", err)
+	}
+	if _, err := reg.Eval("nope", nil); err == nil || err.Error() != `okra: no rule "nope"` {
+		t.Fatalf("undefined rule: %v", err)
+	}
+	for _, d := range [][2]string{{"high", "true"}, {"a.b", "true"}, {"true", "true"}, {"", "1"}, {"x", "1 +"}} {
+		if err := reg.Define(d[0], d[1]); err == nil {
+			t.Errorf("Define(%q, %q) succeeded", d[0], d[1])
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := reg.EvalContext(ctx, "high", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled: %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package okra
+
+import (
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// reorder wraps each `&&` / `||` chain of e whose operands are free of side
+// effects in a chainExpr that evaluates them cheapest first (OptReorder) or in
+// the order observed to decide the chain soonest (OptSelectivity). It runs
+// last, over the otherwise fully optimized AST, and like the other passes
+// leaves macro arguments alone.
+func (o *optimizer) reorder(e Expr) Expr {
+	n, ok := e.(*InfixExpr)
+	if !ok || n.Op != "&&" && n.Op != "||" {
+		o.children(e, o.reorder)
+		return e
+	}
+	// Flatten the chain whatever its grouping: a && (b && c) decides like
+	// (a && b) && c. The operands are reordered first, in place, so the chain
+	// as written (n) and the reordered one share them.
+	var ops []Expr
+	var flatten func(x Expr) Expr
+	flatten = func(x Expr) Expr {
+		if m, ok := x.(*InfixExpr); ok && m.Op == n.Op {
+			m.Left = flatten(m.Left)
+			m.Right = flatten(m.Right)
+			return m
+		}
+		x = o.reorder(x)
+		ops = append(ops, x)
+		return x
+	}
+	flatten(n)
+	fallible := make([]bool, len(ops))
+	all := true
+	for i, op := range ops {
+		if !o.sideEffectFree(op) {
+			return n
+		}
+		fallible[i] = !isBoolExpr(op) || !o.infallible(op)
+		all = all && fallible[i]
+	}
+	if all {
+		// Every operand skipped would have to be evaluated anyway.
+		return n
+	}
+
+	c := &chainExpr{Op: n.Op, Ops: ops, Written: n, cost: make([]int64, len(ops)), fallible: fallible}
+	var scratch []NodeCost
+	for i, op := range ops {
+		c.cost[i] = max(o.prog.cost(op, &scratch), 1)
+		scratch = scratch[:0]
+	}
+	order := make([]int, len(ops))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(i, j int) int { return cmpInt64(c.cost[i], c.cost[j]) })
+	if o.passes&OptSelectivity != 0 {
+		c.stats = &chainStats{evals: make([]atomic.Uint64, len(ops)), hits: make([]atomic.Uint64, len(ops))}
+	} else if slices.IsSorted(order) {
+		return n // already cheapest first
+	}
+	c.order.Store(&order)
+	o.inherit(n, c)
+	return c
+}
+
+// sideEffectFree reports whether evaluating e twice, or not at all, is
+// unobservable: it reads data and calls only pure functions, never explicit
+// methods or macros. Member access may call a getter, which is assumed free
+// of side effects here: reordering may call it where the chain as written
+// would already have decided.
+func (o *optimizer) sideEffectFree(e Expr) bool {
+	ok := true
+	walk(e, func(n Expr) {
+		switch n := n.(type) {
+		case *LiteralExpr, *VariableExpr, *MemberAccessExpr, *IndexExpr, *UnaryExpr,
+			*InfixExpr, *TernaryExpr, *ListExpr, *sharedExpr, *chainExpr:
+		case *CallExpr:
+			if _, pure := o.pure[n.key()]; !pure {
+				ok = false
+			}
+		default:
+			ok = false
+		}
+	})
+	return ok
+}
+
+// infallible reports whether e cannot fail, whatever the data: it is built
+// from literals, lenient variable lookups, equality, membership in a literal
+// list, and the logic of operands that are bools. Member access and calls
+// may always fail (a getter returns an error, a function rejects its
+// arguments), as may a strict lookup. A chain operand must also be a bool:
+// a lenient variable cannot fail to evaluate, but the chain rejects a value
+// that is not a bool.
+func (o *optimizer) infallible(e Expr) bool {
+	bools := func(xs ...Expr) bool {
+		for _, x := range xs {
+			if !isBoolExpr(x) || !o.infallible(x) {
+				return false
+			}
+		}
+		return true
+	}
+	switch n := e.(type) {
+	case *LiteralExpr:
+		return true
+	case *VariableExpr:
+		return !o.prog.strict
+	case *ListExpr:
+		return !slices.ContainsFunc(n.Elems, func(x Expr) bool { return !o.infallible(x) })
+	case *UnaryExpr:
+		return n.Op == "!" && bools(n.Right)
+	case *InfixExpr:
+		switch n.Op {
+		case "==", "!=":
+			return o.infallible(n.Left) && o.infallible(n.Right)
+		case "in", "not in":
+			if lit, ok := n.Right.(*LiteralExpr); ok {
+				switch lit.Value.(type) {
+				case []any, *valueSet:
+					return o.infallible(n.Left)
+				}
+			}
+		case "&&", "||":
+			return bools(n.Left, n.Right)
+		}
+	case *TernaryExpr:
+		return bools(n.Cond) && o.infallible(n.Then) && o.infallible(n.Else)
+	case *sharedExpr:
+		return o.infallible(n.X)
+	case *chainExpr:
+		return bools(n.Ops...)
+	}
+	return false
+}
+
+func cmpInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// chainExpr is a `&&` (or `||`) chain evaluated in an order of its own
+// choosing. Evaluating the operands in another order changes nothing as long
+// as each yields a bool: the chain is false (true) as soon as one is. When one
+// fails instead, the chain is evaluated again as written, so an evaluation
+// that fails reports exactly the error it reports without reordering, and a
+// guard like `x != nil && x.a > 1` still protects what it guards. Conversely,
+// once an operand decides the chain, the operands written before it that were
+// skipped and may fail are evaluated in source order, and the chain is
+// evaluated as written if one does: only operands that cannot fail are ever
+// left out.
+type chainExpr struct {
+	Op  string
+	Ops []Expr
+	// Written is the chain as written, over the same operand nodes.
+	Written  Expr
+	cost     []int64 // static cost of each operand
+	fallible []bool  // whether each operand may fail
+	order    atomic.Pointer[[]int]
+	stats    *chainStats // nil without OptSelectivity
+}
+
+// chainStats counts, per operand, how often it was evaluated and how often it
+// decided the chain (was false in `&&`, true in `||`). Every rerankEvery
+// evaluations of the chain, the order is recomputed from them.
+type chainStats struct {
+	runs        atomic.Uint64
+	evals, hits []atomic.Uint64
+}
+
+const rerankEvery = 1024
+
+func (e *chainExpr) Eval(ctx Context) (any, error) {
+	decisive := e.Op == "||"
+	order := *e.order.Load()
+	for k, i := range order {
+		v, err := e.Ops[i].Eval(ctx)
+		b, ok := v.(bool)
+		if err != nil || !ok {
+			if ctx.cancelled() {
+				return nil, err
+			}
+			return e.Written.Eval(ctx)
+		}
+		if !e.observe(i, b == decisive) {
+			continue
+		}
+		for j := range i {
+			if !e.unsettled(ctx, order[:k], j) {
+				continue
+			}
+			v, err := e.Ops[j].Eval(ctx)
+			if c, ok := v.(bool); err != nil || !ok {
+				if ctx.cancelled() {
+					return nil, err
+				}
+				return e.Written.Eval(ctx)
+			} else if c == decisive {
+				break
+			}
+		}
+		return b, nil
+	}
+	e.finish()
+	return !decisive, nil
+}
+
+// unsettled reports whether operand j, written before the one that decided
+// the chain after those in done, must be evaluated before the decision
+// stands: it was skipped and may fail. In a Registry any variable may name a
+// rule, which may fail.
+func (e *chainExpr) unsettled(ctx Context, done []int, j int) bool {
+	return (e.fallible[j] || ctx.rules != nil) && !slices.Contains(done, j)
+}
+
+// observe records that operand i was evaluated, and whether it decided the
+// chain, which it returns.
+func (e *chainExpr) observe(i int, decided bool) bool {
+	if s := e.stats; s != nil {
+		s.evals[i].Add(1)
+		if decided {
+			s.hits[i].Add(1)
+		}
+	}
+	if decided {
+		e.finish()
+	}
+	return decided
+}
+
+// finish ends one evaluation of the chain, reranking its operands every
+// rerankEvery evaluations under OptSelectivity.
+func (e *chainExpr) finish() {
+	if s := e.stats; s != nil && s.runs.Add(1)%rerankEvery == 0 {
+		e.rerank()
+	}
+}
+
+// rerank orders the operands by expected cost per decision: cost / p, where p
+// is the smoothed observed probability that the operand decides the chain.
+// Evaluating in ascending order of that ratio minimizes the expected cost of
+// a chain of independent tests.
+func (e *chainExpr) rerank() {
+	s := e.stats
+	rank := make([]float64, len(e.Ops))
+	for i := range rank {
+		p := (float64(s.hits[i].Load()) + 1) / (float64(s.evals[i].Load()) + 2)
+		rank[i] = float64(e.cost[i]) / p
+	}
+	order := slices.Clone(*e.order.Load())
+	slices.SortStableFunc(order, func(i, j int) int {
+		switch {
+		case rank[i] < rank[j]:
+			return -1
+		case rank[i] > rank[j]:
+			return 1
+		}
+		return 0
+	})
+	e.order.Store(&order)
+}
+
+// String renders the chain in its current evaluation order.
+func (e *chainExpr) String() string {
+	var sb strings.Builder
+	order := *e.order.Load()
+	sb.WriteString(strings.Repeat("(", len(order)-1))
+	for k, i := range order {
+		if k > 0 {
+			sb.WriteString(" " + e.Op + " ")
+		}
+		sb.WriteString(e.Ops[i].String())
+		if k > 0 {
+			sb.WriteByte(')')
+		}
+	}
+	return sb.String()
+}
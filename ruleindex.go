@@ -0,0 +1,274 @@
+package okra
+
+import "fmt"
+
+// ruleIndex is the shared-condition index of one version of a RuleSet's rules.
+// Most conditions in a large set start with a test of a data field against
+// constants — `country == 'DE' && …`, `tier in ['gold', 'vip'] && …` — and many
+// rules test the same field against the same constants. The index extracts
+// those leading tests (predicates), keeps one copy of each distinct predicate
+// and of each distinct access path they read, and evaluates each at most once
+// per input. A rule runs only when none of its indexed predicates is false.
+//
+// Skipping a rule is unobservable: a predicate is indexed only when every
+// conjunct before it is indexed too, so when the first of them that does not
+// hold is false, the condition as written is false there without having
+// evaluated anything but those predicates. A path that fails to evaluate (a
+// missing field under strict mode, a panicking getter) decides nothing: the
+// rule runs and reports the failure itself.
+type ruleIndex struct {
+	rules *[]Rule // the version indexed
+	paths []indexPath
+	preds []indexPred
+	// guards holds, per rule, its indexed predicates in evaluation order.
+	guards [][]int
+}
+
+// indexPath is an access path (`country`, `user.Address.City`, `tags[0]`)
+// evaluated in the context of prog, the first rule that reads it.
+type indexPath struct {
+	expr Expr
+	prog *Program
+}
+
+// indexPred is `path in set`; `path == constant` is a set of one.
+type indexPred struct {
+	path int
+	set  *valueSet
+}
+
+// pathKey identifies the paths whose values are the same for every rule.
+// Reading a path depends on strict mode and, through getters, on the method
+// filter, which cannot be compared: a path read under a filter is shared only
+// by the conditions of one Program.
+type pathKey struct {
+	src      string
+	strict   bool
+	filtered *Program
+}
+
+type predKey struct {
+	path int
+	set  string
+}
+
+// IndexStats describes the shared-condition index of a RuleSet.
+type IndexStats struct {
+	// Rules is the number of rules; Indexed, those with at least one indexed
+	// predicate.
+	Rules, Indexed int
+	// Paths and Predicates count the distinct access paths and predicates,
+	// each evaluated at most once per input.
+	Paths, Predicates int
+}
+
+// IndexStats reports how the set's rules are indexed.
+func (rs *RuleSet) IndexStats() IndexStats {
+	ix := rs.index(rs.rules.Load())
+	s := IndexStats{Rules: len(ix.guards), Paths: len(ix.paths), Predicates: len(ix.preds)}
+	for _, g := range ix.guards {
+		if len(g) > 0 {
+			s.Indexed++
+		}
+	}
+	return s
+}
+
+// index returns the index of rules, building it on first use. Concurrent
+// evaluations may build it twice; either copy will do.
+func (rs *RuleSet) index(rules *[]Rule) *ruleIndex {
+	if ix := rs.idx.Load(); ix != nil && ix.rules == rules {
+		return ix
+	}
+	ix := buildIndex(rules)
+	rs.idx.Store(ix)
+	return ix
+}
+
+func buildIndex(rules *[]Rule) *ruleIndex {
+	ix := &ruleIndex{rules: rules, guards: make([][]int, len(*rules))}
+	paths := map[pathKey]int{}
+	preds := map[predKey]int{}
+	for i, r := range *rules {
+		for _, c := range conjuncts(r.When.ast, nil) {
+			path, set, ok := indexable(c)
+			if !ok {
+				break
+			}
+			pk := pathKey{src: path.String(), strict: r.When.strict}
+			if r.When.methodFilter != nil {
+				pk.filtered = r.When
+			}
+			p, ok := paths[pk]
+			if !ok {
+				p = len(ix.paths)
+				paths[pk] = p
+				ix.paths = append(ix.paths, indexPath{path, r.When})
+			}
+			k := predKey{p, renderLiteral(set.list)}
+			id, ok := preds[k]
+			if !ok {
+				id = len(ix.preds)
+				preds[k] = id
+				ix.preds = append(ix.preds, indexPred{p, set})
+			}
+			ix.guards[i] = append(ix.guards[i], id)
+		}
+	}
+	return ix
+}
+
+// conjuncts appends the operands of the `&&` chain e to out, in evaluation
+// order whatever the grouping.
+func conjuncts(e Expr, out []Expr) []Expr {
+	if n, ok := e.(*InfixExpr); ok && n.Op == "&&" {
+		return conjuncts(n.Right, conjuncts(n.Left, out))
+	}
+	return append(out, e)
+}
+
+// indexable reports whether e is `path == constant`, `constant == path` or
+// `path in [constants]`, with scalar constants, and returns the path and the
+// constants.
+func indexable(e Expr) (Expr, *valueSet, bool) {
+	n, ok := e.(*InfixExpr)
+	if !ok {
+		return nil, nil, false
+	}
+	path, other := n.Left, n.Right
+	switch n.Op {
+	case "==":
+		if _, ok := path.(*LiteralExpr); ok {
+			path, other = other, path
+		}
+	case "in":
+	default:
+		return nil, nil, false
+	}
+	path, ok = accessPath(path)
+	lit, isLit := other.(*LiteralExpr)
+	if !ok || !isLit {
+		return nil, nil, false
+	}
+	var set *valueSet
+	switch v := lit.Value.(type) {
+	case *valueSet:
+		set = v
+	case []any:
+		set, ok = newValueSet(v)
+	default:
+		if n.Op == "==" {
+			set, ok = newValueSet([]any{v})
+		} else {
+			ok = false
+		}
+	}
+	return path, set, ok
+}
+
+// accessPath returns e, unwrapped of OptCSE's sharing, if it only reads data:
+// a variable followed by member accesses and constant indexes.
+func accessPath(e Expr) (Expr, bool) {
+	if s, ok := e.(*sharedExpr); ok {
+		e = s.X
+	}
+	for x := e; ; {
+		switch n := x.(type) {
+		case *VariableExpr:
+			return e, true
+		case *MemberAccessExpr:
+			x = n.Left
+		case *IndexExpr:
+			if _, ok := n.Index.(*LiteralExpr); !ok {
+				return nil, false
+			}
+			x = n.Left
+		default:
+			return nil, false
+		}
+	}
+}
+
+// indexState is the per-input state of an index: which paths and predicates
+// were evaluated, and what they yielded.
+type indexState struct {
+	ix        *ruleIndex
+	contextOf func(*Program) Context
+	values    []any
+	paths     []evalState
+	preds     []evalState
+}
+
+type evalState uint8
+
+const (
+	unevaluated evalState = iota
+	holds                 // for a path: it was read
+	fails
+	unknown // the path failed to evaluate
+)
+
+func (ix *ruleIndex) state(contextOf func(*Program) Context) *indexState {
+	return &indexState{
+		ix:        ix,
+		contextOf: contextOf,
+		values:    make([]any, len(ix.paths)),
+		paths:     make([]evalState, len(ix.paths)),
+		preds:     make([]evalState, len(ix.preds)),
+	}
+}
+
+// admits reports whether rule i must run: none of its indexed predicates is
+// known to be false, up to the first that cannot be decided.
+func (s *indexState) admits(i int) bool {
+	for _, id := range s.ix.guards[i] {
+		switch s.pred(id) {
+		case fails:
+			return false
+		case unknown:
+			return true
+		}
+	}
+	return true
+}
+
+func (s *indexState) pred(id int) evalState {
+	if st := s.preds[id]; st != unevaluated {
+		return st
+	}
+	p := s.ix.preds[id]
+	st := unknown
+	if s.path(p.path) == holds {
+		st = fails
+		if p.set.has(s.values[p.path]) {
+			st = holds
+		}
+	}
+	s.preds[id] = st
+	return st
+}
+
+func (s *indexState) path(i int) evalState {
+	if st := s.paths[i]; st != unevaluated {
+		return st
+	}
+	p := s.ix.paths[i]
+	v, err := readPath(p.expr, s.contextOf(p.prog))
+	st := holds
+	if err != nil {
+		st = unknown
+	}
+	s.values[i], s.paths[i] = v, st
+	return st
+}
+
+// readPath evaluates an access path, recovering the panics of getters as
+// Program.run does.
+func readPath(e Expr, c Context) (v any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return e.Eval(c)
+}
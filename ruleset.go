@@ -0,0 +1,213 @@
+package okra
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Rule is one named rule of a RuleSet: when its condition holds, it fires and
+// yields the value of its result.
+type Rule struct {
+	Name string
+	// Priority orders the rules under PriorityOrder, highest first.
+	Priority int
+	// When is the condition; it must evaluate to a bool.
+	When *Program
+	// Then is the result, evaluated only when the rule fires. Optional: a rule
+	// without one fires with a nil Result.
+	Then *Program
+}
+
+// Strategy selects how a RuleSet evaluates its rules.
+type Strategy int
+
+const (
+	// FirstMatch evaluates the rules in the order they were added and stops
+	// at the first that fires.
+	FirstMatch Strategy = iota
+	// AllMatches evaluates every rule, in the order they were added, and
+	// reports each that fires.
+	AllMatches
+	// PriorityOrder evaluates the rules from the highest Priority down (ties
+	// in the order they were added) and stops at the first that fires.
+	PriorityOrder
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case FirstMatch:
+		return "first-match"
+	case AllMatches:
+		return "all-matches"
+	case PriorityOrder:
+		return "priority-order"
+	}
+	return "unknown"
+}
+
+// Fired is a rule whose condition held.
+type Fired struct {
+	Name     string
+	Priority int
+	// Result is the value of the rule's Then, or nil when it has none.
+	Result any
+}
+
+// RuleSet is a collection of named rules evaluated together under one
+// Strategy, replacing the hand-written loops over maps of Programs:
+//
+//	rs := okra.NewRuleSet(okra.PriorityOrder)
+//	_ = rs.Add(okra.Rule{Name: "vip", Priority: 10, When: vip, Then: vipDiscount})
+//	_ = rs.Add(okra.Rule{Name: "default", When: always, Then: noDiscount})
+//	fired, err := rs.Eval(order)
+//
+// Every rule keeps the configuration its Programs were compiled with, so one
+// set may mix Programs of several Engines. A RuleSet is safe for concurrent
+// use; Add and Remove do not disturb evaluations in flight, which see the set
+// as it was when they started.
+//
+// Conditions that start with tests of data fields against constants, like
+// `country == 'DE' && …` or `tier in ['gold', 'vip'] && …`, are indexed: each
+// distinct test is evaluated at most once per input, and only the rules whose
+// tests pass run (see IndexStats). The index is built on the first evaluation
+// after a change, and never changes a result.
+type RuleSet struct {
+	strategy Strategy
+	mu       sync.Mutex // serializes Add and Remove
+	rules    atomic.Pointer[[]Rule]
+	idx      atomic.Pointer[ruleIndex] // of some version of rules, see index
+}
+
+// NewRuleSet returns an empty RuleSet with the given strategy.
+func NewRuleSet(strategy Strategy) *RuleSet {
+	rs := &RuleSet{strategy: strategy}
+	rs.rules.Store(&[]Rule{})
+	return rs
+}
+
+// Strategy returns the set's strategy.
+func (rs *RuleSet) Strategy() Strategy { return rs.strategy }
+
+// Add adds r to the set. The name must be non-empty and unique within the set,
+// and When non-nil.
+func (rs *RuleSet) Add(r Rule) error {
+	if r.Name == "" {
+		return errors.New("okra: rule has no name")
+	}
+	if r.When == nil {
+		return fmt.Errorf("okra: rule %q has no condition", r.Name)
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	old := *rs.rules.Load()
+	if slices.ContainsFunc(old, func(o Rule) bool { return o.Name == r.Name }) {
+		return fmt.Errorf("okra: duplicate rule %q", r.Name)
+	}
+	rules := append(slices.Clip(old), r)
+	if rs.strategy == PriorityOrder {
+		slices.SortStableFunc(rules, func(a, b Rule) int { return cmp.Compare(b.Priority, a.Priority) })
+	}
+	rs.rules.Store(&rules)
+	return nil
+}
+
+// Remove removes the named rule, reporting whether it was in the set.
+func (rs *RuleSet) Remove(name string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	old := *rs.rules.Load()
+	i := slices.IndexFunc(old, func(r Rule) bool { return r.Name == name })
+	if i < 0 {
+		return false
+	}
+	rules := slices.Delete(slices.Clone(old), i, i+1)
+	rs.rules.Store(&rules)
+	return true
+}
+
+// Rules returns the set's rules in evaluation order.
+func (rs *RuleSet) Rules() []Rule { return slices.Clone(*rs.rules.Load()) }
+
+// Eval evaluates the set against data and returns the rules that fired, in
+// evaluation order: at most one under FirstMatch and PriorityOrder. A rule
+// that fails — its condition or result errors, or the condition is not a
+// bool — stops the evaluation, and Eval returns the rules fired before it
+// along with the error. The error names the rule and wraps an *Error, the
+// Program's or, for a condition that is not a bool, one of KindEval
+// positioned at the condition, so errors.As still finds it.
+func (rs *RuleSet) Eval(data any) ([]Fired, error) {
+	return rs.eval(func(p *Program) Context { return p.context(data) })
+}
+
+// EvalContext is Eval with the cancellation of Program.EvalContext applied to
+// the whole set: its rules share one step counter, so a set of many cheap
+// rules is polled as often as one long rule, and evaluation stops with
+// ctx.Err() once ctx is done.
+func (rs *RuleSet) EvalContext(ctx context.Context, data any) ([]Fired, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var steps uint64
+	return rs.eval(func(p *Program) Context {
+		c := p.context(data)
+		c.ctx, c.steps = ctx, &steps
+		return c
+	})
+}
+
+func (rs *RuleSet) eval(contextOf func(*Program) Context) ([]Fired, error) {
+	rules := rs.rules.Load()
+	return rs.run(*rules, rs.index(rules), contextOf)
+}
+
+// run evaluates rules, skipping those ix rules out when it is non-nil.
+func (rs *RuleSet) run(rules []Rule, ix *ruleIndex, contextOf func(*Program) Context) ([]Fired, error) {
+	var st *indexState
+	if ix != nil && len(ix.preds) > 0 {
+		st = ix.state(contextOf)
+	}
+	var fired []Fired
+	for i, r := range rules {
+		if st != nil && !st.admits(i) {
+			continue
+		}
+		c := contextOf(r.When)
+		v, err := r.When.run(c)
+		if err != nil {
+			return fired, setError(c, err, fmt.Sprintf("okra: rule %q: condition", r.Name))
+		}
+		ok, isBool := v.(bool)
+		if !isBool {
+			return fired, fmt.Errorf("okra: rule %q: condition: %w", r.Name, r.When.notBool(v))
+		}
+		if !ok {
+			continue
+		}
+		f := Fired{Name: r.Name, Priority: r.Priority}
+		if r.Then != nil {
+			c := contextOf(r.Then)
+			if f.Result, err = r.Then.run(c); err != nil {
+				return fired, setError(c, err, fmt.Sprintf("okra: rule %q: result", r.Name))
+			}
+		}
+		fired = append(fired, f)
+		if rs.strategy != AllMatches {
+			break
+		}
+	}
+	return fired, nil
+}
+
+// setError attributes err to the part of a rule set or table named by where,
+// except the cancellation of the whole evaluation, which is returned as is.
+func setError(c Context, err error, where string) error {
+	if c.cancelled() && errors.Is(err, c.ctx.Err()) {
+		return err
+	}
+	return fmt.Errorf("%s: %w", where, err)
+}
@@ -0,0 +1,224 @@
+package okra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func ruleSet(t *testing.T, s Strategy, rules ...[3]string) *RuleSet {
+	t.Helper()
+	e := NewEngine()
+	rs := NewRuleSet(s)
+	for i, r := range rules {
+		when, err := e.Compile(r[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var then *Program
+		if r[2] != "" {
+			if then, err = e.Compile(r[2]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rs.Add(Rule{Name: r[0], Priority: i % 3, When: when, Then: then}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rs
+}
+
+func TestRuleSetStrategies(t *testing.T) {
+	rules := [][3]string{
+		{"small", "amount < 100", "'small'"}, // priority 0
+		{"vip", "vip", "amount * 8 / 10"},    // priority 1
+		{"big", "amount > 50", ""},           // priority 2
+		{"never", "false", "'never'"},        // priority 0
+	}
+	data := map[string]any{"amount": int64(80), "vip": true}
+	cases := []struct {
+		s    Strategy
+		want []Fired
+	}{
+		{FirstMatch, []Fired{{"small", 0, "small"}}},
+		{AllMatches, []Fired{{"small", 0, "small"}, {"vip", 1, int64(64)}, {"big", 2, nil}}},
+		{PriorityOrder, []Fired{{"big", 2, nil}}},
+	}
+	for _, c := range cases {
+		rs := ruleSet(t, c.s, rules...)
+		got, err := rs.Eval(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: got %v, want %v", c.s, got, c.want)
+		}
+		if got, err := rs.EvalContext(context.Background(), data); err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: EvalContext got %v, %v", c.s, got, err)
+		}
+	}
+
+	rs := ruleSet(t, PriorityOrder, rules...)
+	if !rs.Remove("big") || rs.Remove("big") {
+		t.Fatal("Remove")
+	}
+	if got, _ := rs.Eval(data); len(got) != 1 || got[0].Name != "vip" {
+		t.Fatalf("after Remove: %v", got)
+	}
+	var names []string
+	for _, r := range rs.Rules() {
+		names = append(names, r.Name)
+	}
+	if strings.Join(names, ",") != "vip,small,never" {
+		t.Fatalf("order %v", names)
+	}
+	if got, err := rs.Eval(map[string]any{"amount": int64(500), "vip": false}); err != nil || got != nil {
+		t.Fatalf("no match: %v, %v", got, err)
+	}
+}
+
+func TestRuleSetErrors(t *testing.T) {
+	rs := ruleSet(t, AllMatches,
+		[3]string{"ok", "true", ""},
+		[3]string{"typo", "amout > 1", ""},
+	)
+	fired, err := rs.Eval(map[string]any{"amount": int64(1)})
+	var oe *Error
+	if len(fired) != 1 || err == nil || !errors.As(err, &oe) || !errors.Is(err, ErrUnknownField) ||
+		!strings.HasPrefix(err.Error(), `okra: rule "typo": condition: amout`) {
+		t.Fatalf("fired %v, err %v", fired, err)
+	}
+
+	rs = ruleSet(t, FirstMatch, [3]string{"n", "1", ""})
+	_, err = rs.Eval(nil)
+	if err == nil || err.Error() != `okra: rule "n": condition: 1: yielded int64, want bool` ||
+		!errors.As(err, &oe) || oe.Kind != KindEval || oe.Source != "1" || oe.End != 1 {
+		t.Fatalf("non-bool condition: %v", err)
+	}
+	rs = ruleSet(t, FirstMatch, [3]string{"div", "true", "1 / x"})
+	if _, err := rs.Eval(map[string]any{"x": int64(0)}); !errors.Is(err, ErrDivByZero) || !strings.Contains(err.Error(), "result") {
+		t.Fatalf("result error: %v", err)
+	}
+
+	when, _ := NewEngine().Compile("true")
+	for _, r := range []Rule{{When: when}, {Name: "x"}, {Name: "div", When: when}} {
+		if err := rs.Add(r); err == nil {
+			t.Errorf("Add(%+v) succeeded", r)
+		}
+	}
+}
+
+func TestRuleSetCancellation(t *testing.T) {
+	// Many cheap rules share one step counter, so cancellation is noticed
+	// even though no single rule takes 1024 steps.
+	var rules [][3]string
+	for i := range 2000 {
+		rules = append(rules, [3]string{fmt.Sprint("r", i), "a > 1 && a < 0", ""})
+	}
+	rs := ruleSet(t, AllMatches, rules...)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := rs.EvalContext(ctx, map[string]any{"a": int64(5)}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v", err)
+	}
+	steps := 0
+	ctx, cancel = context.WithCancel(context.Background())
+	e := NewEngine()
+	_ = e.RegisterFunc("tick", func([]any) (any, error) {
+		if steps++; steps == 10 {
+			cancel()
+		}
+		return false, nil
+	})
+	rs = NewRuleSet(AllMatches)
+	for _, r := range rules {
+		p, _ := e.Compile("tick()")
+		_ = rs.Add(Rule{Name: r[0], When: p})
+	}
+	_, err := rs.EvalContext(ctx, nil)
+	if !errors.Is(err, context.Canceled) || strings.Contains(err.Error(), "rule") || steps >= 2000 {
+		t.Fatalf("err = %v after %d rules", err, steps)
+	}
+}
+
+func TestRuleSetIndex(t *testing.T) {
+	e := NewEngine()
+	calls := 0
+	tick := func([]any) (any, error) { calls++; return true, nil }
+	_ = e.RegisterFunc("tick", tick)
+	lenient := NewEngine()
+	lenient.SetStrict(false)
+	_ = lenient.RegisterFunc("tick", tick)
+	var rules []Rule
+	add := func(e *Engine, when string) {
+		p, err := e.Compile(when)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, Rule{Name: fmt.Sprint(len(rules), ": ", when), When: p})
+	}
+	countries := []string{"'DE'", "'FR'", "'US'", "1", "2.0"}
+	for i := range 300 {
+		c := countries[i%len(countries)]
+		switch i % 6 {
+		case 0:
+			add(e, "country == "+c+" && tick()")
+		case 1:
+			add(e, c+" == country && tier in ['gold', 'vip'] && tick()")
+		case 2:
+			add(e, "tier in ['gold', 1] && user.Age > 17 && country == "+c)
+		case 3:
+			add(lenient, "user.Address.City == 'Paris' && tick()")
+		case 4:
+			add(e, "user.Address.City == 'Paris' && tick()") // fails when missing
+		case 5:
+			add(e, "country != "+c+" || tick()")
+		}
+	}
+	inputs := []map[string]any{
+		{"country": "DE", "tier": "gold", "user": map[string]any{"Age": int64(30)}},
+		{"country": int64(1), "tier": int64(1), "user": map[string]any{"Age": int64(3)}},
+		{"country": 2.0, "tier": "vip", "user": map[string]any{"Address": map[string]any{"City": "Paris"}}},
+		{"country": nil, "tier": []any{"gold"}},
+	}
+	for _, s := range []Strategy{FirstMatch, AllMatches} {
+		rs := NewRuleSet(s)
+		for _, r := range rules {
+			if err := rs.Add(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, data := range inputs {
+			calls = 0
+			contextOf := func(p *Program) Context { return p.context(data) }
+			want, wantErr := rs.run(rs.Rules(), nil, contextOf)
+			wantCalls := calls
+			calls = 0
+			got, err := rs.Eval(data)
+			if !reflect.DeepEqual(got, want) || fmt.Sprint(err) != fmt.Sprint(wantErr) {
+				t.Errorf("%v %v: got %v, %v; want %v, %v", s, data, got, err, want, wantErr)
+			}
+			if calls > wantCalls {
+				t.Errorf("%v %v: %d calls, unindexed %d", s, data, calls, wantCalls)
+			}
+		}
+	}
+
+	rs := NewRuleSet(AllMatches)
+	for _, r := range rules {
+		_ = rs.Add(r)
+	}
+	want := IndexStats{Rules: 300, Indexed: 250, Paths: 4, Predicates: 9}
+	if got := rs.IndexStats(); got != want {
+		t.Fatalf("stats %+v, want %+v", got, want)
+	}
+	// Of the rules testing country, only those for 2.0 run: 10 of case 0, 10
+	// of case 1 and, through ||, 10 of case 5; every rule of cases 3 and 4 runs.
+	calls = 0
+	if _, err := rs.Eval(inputs[2]); err != nil || calls != 130 {
+		t.Fatalf("%d calls, err %v", calls, err)
+	}
+}
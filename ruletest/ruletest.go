@@ -0,0 +1,482 @@
+// Package ruletest runs test cases for okra rules written as JSON fixture
+// files, so rule authors can ship tests with their rules without writing Go.
+//
+// A fixture file, named something.test.json, tests one rule:
+//
+//	{
+//	  "rule": "approve",
+//	  "cases": [
+//	    {"name": "small order", "input": {"amount": 50, "country": "NL"}, "want": true},
+//	    {"name": "no amount", "input": {"country": "NL"}, "error": "ErrUnknownField"}
+//	  ]
+//	}
+//
+// The rule is either "expr", an expression compiled by the Runner's Engine, or
+// "rule", the name of a rule loaded as okra.OpenStore loads a directory: by
+// default the directory of the fixture file. When both are absent, the rule is
+// named after the file (approve.test.json tests approve).
+//
+// A case passes when its rule, evaluated against "input", equals "want", or,
+// when "error" is set, fails with that error: either the name of one of okra's
+// sentinel errors (ErrDivByZero, ErrUnknownField, …), matched with errors.Is,
+// or text the error message must contain. JSON numbers without a fraction or
+// exponent are int64 in the input, others float64, as okra reads literals;
+// results are compared as JSON values, numbers by value.
+package ruletest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/coolbit/okra"
+)
+
+// Suffix ends the names of fixture files.
+const Suffix = ".test.json"
+
+// Fixture is the test cases of one rule.
+type Fixture struct {
+	// File is the path the fixture was read from, if any.
+	File string
+	// Rule names the rule under test; Expr, when set, is the rule itself.
+	Rule  string
+	Expr  string
+	Cases []Case
+}
+
+// Case is one test case: the rule evaluated against Input must yield Want or,
+// when Error is set, fail with that error.
+type Case struct {
+	Name  string
+	Input any
+	Want  any
+	// Error is the name of an okra sentinel error, like "ErrDivByZero", or
+	// text the error message must contain.
+	Error string
+}
+
+// sentinels are the errors a case's Error may name: every exported okra
+// sentinel, as TestSentinelsComplete checks.
+var sentinels = map[string]error{
+	"ErrDivByZero":     okra.ErrDivByZero,
+	"ErrModByZero":     okra.ErrModByZero,
+	"ErrFloatModulo":   okra.ErrFloatModulo,
+	"ErrNegativeShift": okra.ErrNegativeShift,
+	"ErrNotFound":      okra.ErrNotFound,
+	"ErrIntOverflow":   okra.ErrIntOverflow,
+	"ErrUnknownField":  okra.ErrUnknownField,
+	"ErrMethodDenied":  okra.ErrMethodDenied,
+	"ErrCycle":         okra.ErrCycle,
+	"ErrCostExceeded":  okra.ErrCostExceeded,
+}
+
+// Parse reads a fixture from JSON. file, which may be empty, names the rule
+// when the fixture does not.
+func Parse(file string, data []byte) (*Fixture, error) {
+	var raw struct {
+		Rule  string `json:"rule"`
+		Expr  string `json:"expr"`
+		Cases []struct {
+			Name  string          `json:"name"`
+			Input json.RawMessage `json:"input"`
+			Want  json.RawMessage `json:"want"`
+			Error string          `json:"error"`
+		} `json:"cases"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	f := &Fixture{File: file, Rule: raw.Rule, Expr: raw.Expr}
+	if f.Rule == "" && f.Expr == "" {
+		f.Rule = strings.TrimSuffix(filepath.Base(file), Suffix)
+		if f.Rule == "" || f.Rule == "." {
+			return nil, errors.New(`no "rule" or "expr"`)
+		}
+	}
+	if len(raw.Cases) == 0 {
+		return nil, errors.New("no cases")
+	}
+	for i, rc := range raw.Cases {
+		c := Case{Name: rc.Name, Error: rc.Error}
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("#%d", i+1)
+		}
+		switch {
+		case rc.Want == nil && rc.Error == "":
+			return nil, fmt.Errorf(`case %q: no "want" or "error"`, c.Name)
+		case rc.Want != nil && rc.Error != "":
+			return nil, fmt.Errorf(`case %q: both "want" and "error"`, c.Name)
+		case isSentinelName(rc.Error) && sentinels[rc.Error] == nil:
+			return nil, fmt.Errorf("case %q: unknown error %s", c.Name, rc.Error)
+		}
+		var err error
+		if c.Input, err = decode(rc.Input); err != nil {
+			return nil, fmt.Errorf("case %q: input: %w", c.Name, err)
+		}
+		if c.Want, err = decode(rc.Want); err != nil {
+			return nil, fmt.Errorf("case %q: want: %w", c.Name, err)
+		}
+		f.Cases = append(f.Cases, c)
+	}
+	return f, nil
+}
+
+// isSentinelName reports whether s looks like the name of a sentinel error,
+// so a misspelt one is an error rather than text no message contains.
+func isSentinelName(s string) bool {
+	return strings.HasPrefix(s, "Err") && len(s) > 3 && !strings.ContainsAny(s, " :")
+}
+
+// Load reads the fixture file path.
+func Load(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := Parse(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Find returns the fixture files among paths: each path that is a file, and
+// the files named *.test.json under each that is a directory, sorted.
+func Find(paths ...string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(path, Suffix) {
+				files = append(files, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+// decode reads a JSON value with numbers as okra reads them: int64 when
+// written without a fraction or exponent, float64 otherwise. An absent value
+// is nil.
+func decode(raw json.RawMessage) (any, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return numbers(v)
+}
+
+func numbers(v any) (any, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case []any:
+		for i, e := range v {
+			var err error
+			if v[i], err = numbers(e); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]any:
+		for k, e := range v {
+			var err error
+			if v[k], err = numbers(e); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// Runner runs fixtures.
+type Runner struct {
+	// Engine compiles the rules; nil means okra.NewEngine().
+	Engine *okra.Engine
+	// Rules resolves the Rule of fixtures. When nil, a fixture's rule is
+	// loaded from the directory of its file, with okra.OpenStore.
+	Rules map[string]*okra.Program
+
+	stores map[string]storeResult
+}
+
+type storeResult struct {
+	store *okra.Store
+	err   error
+}
+
+// Result is the outcome of one case, or of a whole fixture that could not
+// run (Case is then empty and Err says why).
+type Result struct {
+	File string
+	Rule string
+	Case string
+	Pass bool
+	// Diff explains a failure, one line each.
+	Diff []string
+	// Err is the error that kept the fixture from running.
+	Err error
+}
+
+// Report is the outcome of a run.
+type Report struct {
+	Results        []Result
+	Passed, Failed int
+}
+
+// OK reports whether every case passed.
+func (r *Report) OK() bool { return r.Failed == 0 }
+
+// RunFiles loads and runs the fixture files found in paths (see Find). A file
+// that does not load fails on its own, without stopping the run.
+func (r *Runner) RunFiles(paths ...string) (*Report, error) {
+	files, err := Find(paths...)
+	if err != nil {
+		return nil, err
+	}
+	rep := &Report{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		var f *Fixture
+		if err == nil {
+			f, err = Parse(file, data)
+		}
+		if err != nil {
+			rep.add(Result{File: file, Err: err})
+			continue
+		}
+		r.run(rep, f)
+	}
+	return rep, nil
+}
+
+// Run runs fixtures.
+func (r *Runner) Run(fixtures ...*Fixture) *Report {
+	rep := &Report{}
+	for _, f := range fixtures {
+		r.run(rep, f)
+	}
+	return rep
+}
+
+func (rep *Report) add(res Result) {
+	rep.Results = append(rep.Results, res)
+	if res.Pass {
+		rep.Passed++
+	} else {
+		rep.Failed++
+	}
+}
+
+func (r *Runner) run(rep *Report, f *Fixture) {
+	rule := f.Rule
+	if f.Expr != "" {
+		rule = f.Expr
+	}
+	prog, err := r.program(f)
+	if err != nil {
+		rep.add(Result{File: f.File, Rule: rule, Err: err})
+		return
+	}
+	for _, c := range f.Cases {
+		got, err := prog.Eval(c.Input)
+		res := Result{File: f.File, Rule: rule, Case: c.Name, Diff: check(c, got, err)}
+		res.Pass = len(res.Diff) == 0
+		rep.add(res)
+	}
+}
+
+// program returns the rule of f.
+func (r *Runner) program(f *Fixture) (*okra.Program, error) {
+	e := r.Engine
+	if e == nil {
+		e = okra.NewEngine()
+	}
+	if f.Expr != "" {
+		return e.Compile(f.Expr)
+	}
+	if r.Rules != nil {
+		if p, ok := r.Rules[f.Rule]; ok {
+			return p, nil
+		}
+		return nil, fmt.Errorf("no rule %q", f.Rule)
+	}
+	dir := filepath.Dir(f.File)
+	sr, ok := r.stores[dir]
+	if !ok {
+		sr.store, sr.err = okra.OpenStore(e, dir)
+		if r.stores == nil {
+			r.stores = map[string]storeResult{}
+		}
+		r.stores[dir] = sr
+	}
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	if p, ok := sr.store.Get(f.Rule); ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("no rule %q in %s", f.Rule, dir)
+}
+
+// check compares the outcome of a case with its expectation, returning the
+// differences.
+func check(c Case, got any, err error) []string {
+	if c.Error != "" {
+		if err == nil {
+			return []string{fmt.Sprintf("want error %s, got %s", c.Error, render(got))}
+		}
+		if s, ok := sentinels[c.Error]; ok && errors.Is(err, s) ||
+			!ok && strings.Contains(err.Error(), c.Error) {
+			return nil
+		}
+		return []string{fmt.Sprintf("want error %s, got error: %v", c.Error, err)}
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("want %s, got error: %v", render(c.Want), err)}
+	}
+	// Results are compared as JSON, which is also how fixtures write them.
+	b, err := json.Marshal(got)
+	if err != nil {
+		return []string{fmt.Sprintf("want %s, got %#v, which is not JSON: %v", render(c.Want), got, err)}
+	}
+	v, err := decode(b)
+	if err != nil {
+		return []string{fmt.Sprintf("want %s, got %#v: %v", render(c.Want), got, err)}
+	}
+	var diff []string
+	compare(&diff, "$", c.Want, v)
+	return diff
+}
+
+// compare appends to diff a line for each difference between want and got,
+// JSON values, at path.
+func compare(diff *[]string, path string, want, got any) {
+	switch w := want.(type) {
+	case map[string]any:
+		if g, ok := got.(map[string]any); ok {
+			keys := slices.Collect(maps.Keys(w))
+			for k := range g {
+				if _, ok := w[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			slices.Sort(keys)
+			for _, k := range keys {
+				kp := path + "." + k
+				wv, inW := w[k]
+				gv, inG := g[k]
+				switch {
+				case !inG:
+					*diff = append(*diff, fmt.Sprintf("%s: want %s, missing", kp, render(wv)))
+				case !inW:
+					*diff = append(*diff, fmt.Sprintf("%s: unexpected %s", kp, render(gv)))
+				default:
+					compare(diff, kp, wv, gv)
+				}
+			}
+			return
+		}
+	case []any:
+		if g, ok := got.([]any); ok && len(g) == len(w) {
+			for i := range w {
+				compare(diff, fmt.Sprintf("%s[%d]", path, i), w[i], g[i])
+			}
+			return
+		}
+	default:
+		if equalScalar(want, got) {
+			return
+		}
+	}
+	*diff = append(*diff, fmt.Sprintf("%s: want %s, got %s", path, render(want), render(got)))
+}
+
+// equalScalar compares JSON scalars, numbers by value.
+func equalScalar(a, b any) bool {
+	switch a := a.(type) {
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return a == b
+		case float64:
+			return float64(a) == b
+		}
+		return false
+	case float64:
+		switch b := b.(type) {
+		case int64:
+			return a == float64(b)
+		case float64:
+			return a == b
+		}
+		return false
+	case map[string]any, []any:
+		return false
+	}
+	return a == b
+}
+
+func render(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%#v", v)
+	}
+	return string(b)
+}
+
+// Write prints the report: every failure with its differences, every pass
+// too when verbose, and a summary line.
+func (r *Report) Write(w io.Writer, verbose bool) error {
+	var b strings.Builder
+	for _, res := range r.Results {
+		switch {
+		case res.Err != nil:
+			fmt.Fprintf(&b, "FAIL %s: %v\n", res.File, res.Err)
+		case !res.Pass:
+			fmt.Fprintf(&b, "FAIL %s: %s: %s\n", res.File, res.Rule, res.Case)
+			for _, d := range res.Diff {
+				fmt.Fprintf(&b, "    %s\n", d)
+			}
+		case verbose:
+			fmt.Fprintf(&b, "ok   %s: %s: %s\n", res.File, res.Rule, res.Case)
+		}
+	}
+	status := "ok"
+	if !r.OK() {
+		status = "FAIL"
+	}
+	fmt.Fprintf(&b, "%s: %d passed, %d failed\n", status, r.Passed, r.Failed)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,188 @@
+package ruletest
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coolbit/okra"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse("rules/approve.test.json", []byte(`{"cases": [
+		{"name": "n", "input": {"a": 1, "b": [2.5, 1e3, {"c": 7}]}, "want": {"x": 1}},
+		{"input": null, "want": null},
+		{"error": "ErrDivByZero"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Fixture{File: "rules/approve.test.json", Rule: "approve", Cases: []Case{
+		{Name: "n", Input: map[string]any{"a": int64(1), "b": []any{2.5, 1000.0, map[string]any{"c": int64(7)}}}, Want: map[string]any{"x": int64(1)}},
+		{Name: "#2"},
+		{Name: "#3", Error: "ErrDivByZero"},
+	}}
+	if !reflect.DeepEqual(f, want) {
+		t.Fatalf("got %#v", f)
+	}
+
+	for src, msg := range map[string]string{
+		`{"cases": [{"input": 1}]}`:                      `case "#1": no "want" or "error"`,
+		`{"cases": [{"want": 1, "error": "x"}]}`:         `case "#1": both "want" and "error"`,
+		`{"cases": [{"name": "z", "error": "ErrNope"}]}`: `case "z": unknown error ErrNope`,
+		`{"cases": []}`:                                  "no cases",
+		`{"rule": "a", "cases": [], "extra": 1}`:         `unknown field "extra"`,
+	} {
+		if _, err := Parse("x.test.json", []byte(src)); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: %v, want %q", src, err, msg)
+		}
+	}
+	for name := range sentinels {
+		if _, err := Parse("x.test.json", []byte(`{"cases": [{"error": "`+name+`"}]}`)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := Parse("", []byte(`{"cases": [{"want": 1}]}`)); err == nil {
+		t.Error("a fixture without a file or rule parsed")
+	}
+}
+
+// Every sentinel error okra exports can be named in a fixture.
+func TestSentinelsComplete(t *testing.T) {
+	files, err := filepath.Glob("../*.go")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("okra sources: %v", err)
+	}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range f.Decls {
+			g, ok := d.(*ast.GenDecl)
+			if !ok || g.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range g.Specs {
+				for _, id := range spec.(*ast.ValueSpec).Names {
+					if _, ok := sentinels[id.Name]; isSentinelName(id.Name) && id.IsExported() && !ok {
+						t.Errorf("okra.%s (%s) cannot be named", id.Name, fset.Position(id.Pos()))
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"approve.okra": "amount < 100 && country in ['NL', 'BE']",
+		"approve.test.json": `{"cases": [
+			{"name": "small", "input": {"amount": 50, "country": "NL"}, "want": true},
+			{"name": "large", "input": {"amount": 500, "country": "NL"}, "want": true},
+			{"name": "no amount", "input": {"country": "NL"}, "error": "ErrUnknownField"}
+		]}`,
+		"pricing.rules": "# offers\ndiscount: offer(tier == 'gold' ? 10 : 0, [tier], 0.5)\n",
+		"discount.test.json": `{"rule": "discount", "cases": [
+			{"name": "gold", "input": {"tier": "gold"}, "want": {"pct": 10.0, "tags": ["gold"], "rate": 0.5}},
+			{"name": "silver", "input": {"tier": "silver"}, "want": {"pct": 5, "tags": ["gold"], "extra": 1}}
+		]}`,
+		"sub/inline.test.json": `{"expr": "a / b", "cases": [
+			{"name": "div", "input": {"a": 6, "b": 3}, "want": 2},
+			{"name": "zero", "input": {"a": 1, "b": 0}, "error": "ErrDivByZero"},
+			{"name": "text", "input": {"a": 1, "b": 0}, "error": "division"},
+			{"name": "no error", "input": {"a": 1, "b": 1}, "error": "ErrDivByZero"}
+		]}`,
+		"sub/missing.test.json": `{"rule": "nope", "cases": [{"want": 1}]}`,
+		"sub/broken.test.json":  `{"cases": `,
+	})
+	e := okra.NewEngine()
+	e.SetStrict(true)
+	_ = e.RegisterFunc("offer", func(args []any) (any, error) {
+		return map[string]any{"pct": args[0], "tags": args[1], "rate": args[2]}, nil
+	})
+	rep, err := (&Runner{Engine: e}).RunFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Passed != 6 || rep.Failed != 5 || rep.OK() {
+		t.Fatalf("passed %d, failed %d", rep.Passed, rep.Failed)
+	}
+	var out strings.Builder
+	if err := rep.Write(&out, false); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.ReplaceAll(out.String(), dir+string(filepath.Separator), "")
+	for _, want := range []string{
+		"FAIL approve.test.json: approve: large\n    $: want true, got false\n",
+		"FAIL discount.test.json: discount: silver\n" +
+			"    $.extra: want 1, missing\n" +
+			"    $.pct: want 5, got 0\n" +
+			"    $.rate: unexpected 0.5\n" +
+			`    $.tags[0]: want "gold", got "silver"` + "\n",
+		"FAIL sub/broken.test.json: unexpected EOF\n",
+		"FAIL sub/inline.test.json: a / b: no error\n    want error ErrDivByZero, got 1\n",
+		`FAIL sub/missing.test.json: no rule "nope" in sub` + "\n",
+		"FAIL: 6 passed, 5 failed\n",
+	} {
+		want = strings.ReplaceAll(want, "/", string(filepath.Separator))
+		if !strings.Contains(got, want) {
+			t.Errorf("report lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "ok ") {
+		t.Errorf("passes printed without verbose:\n%s", got)
+	}
+	out.Reset()
+	_ = rep.Write(&out, true)
+	if !strings.Contains(out.String(), "ok   ") {
+		t.Errorf("verbose report lacks passes:\n%s", out.String())
+	}
+}
+
+func TestRunRules(t *testing.T) {
+	e := okra.NewEngine()
+	p, err := e.Compile("x * 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Runner{Engine: e, Rules: map[string]*okra.Program{"double": p}}
+	rep := r.Run(
+		&Fixture{Rule: "double", Cases: []Case{{Name: "a", Input: map[string]any{"x": int64(2)}, Want: int64(4)}}},
+		&Fixture{Rule: "triple", Cases: []Case{{Name: "a", Want: int64(3)}}},
+		&Fixture{Expr: "now()", Cases: []Case{{Name: "a", Want: nil}}},
+	)
+	if rep.Passed != 1 || rep.Failed != 2 {
+		t.Fatalf("%+v", rep)
+	}
+	if res := rep.Results[1]; res.Err == nil || res.Err.Error() != `no rule "triple"` {
+		t.Fatalf("unknown rule: %+v", res)
+	}
+	if res := rep.Results[2]; len(res.Diff) != 1 || !strings.HasPrefix(res.Diff[0], "$: want null, got ") {
+		t.Fatalf("time result: %+v", res)
+	}
+}
@@ -0,0 +1,103 @@
+package okra
+
+// valueSet is a literal list of scalars (strings, bools, int64s, float64s)
+// prepared for `in`: Compile replaces the list literal on the right of `in` /
+// `not in` with one, so membership is a hash lookup instead of a scan. has
+// implements exactly the valuesEqual scan over the list, and the set renders
+// as the list it came from. The scan boxes each element through reflection, so
+// even a two-element set is several times faster.
+type valueSet struct {
+	list  []any
+	strs  map[string]struct{}
+	bools [2]bool // [false, true] present
+	ints  map[int64]struct{}
+	// floats holds the float64 elements; intFloats the int64 elements
+	// converted to float64, which is how they compare with a float needle.
+	floats, intFloats map[float64]struct{}
+}
+
+// newValueSet indexes list, reporting false if it holds anything but scalars.
+func newValueSet(list []any) (*valueSet, bool) {
+	s := &valueSet{
+		list:      list,
+		strs:      map[string]struct{}{},
+		ints:      map[int64]struct{}{},
+		floats:    map[float64]struct{}{},
+		intFloats: map[float64]struct{}{},
+	}
+	for _, el := range list {
+		switch v := el.(type) {
+		case string:
+			s.strs[v] = struct{}{}
+		case bool:
+			if v {
+				s.bools[1] = true
+			} else {
+				s.bools[0] = true
+			}
+		case int64:
+			s.ints[v] = struct{}{}
+			s.intFloats[float64(v)] = struct{}{}
+		case float64:
+			s.floats[v] = struct{}{}
+		default:
+			return nil, false
+		}
+	}
+	return s, true
+}
+
+// has reports whether valuesEqual(needle, el) holds for some element. A
+// string or bool only equals its own type; int64 pairs compare exactly; every
+// other numeric pair compares as float64 (NaN equals nothing); any other
+// needle equals no scalar.
+func (s *valueSet) has(needle any) bool {
+	switch n := needle.(type) {
+	case string:
+		_, ok := s.strs[n]
+		return ok
+	case bool:
+		if n {
+			return s.bools[1]
+		}
+		return s.bools[0]
+	case int64:
+		_, ok := s.ints[n]
+		if !ok {
+			_, ok = s.floats[float64(n)]
+		}
+		return ok
+	}
+	f, ok := toNumber(needle)
+	if !ok {
+		return false
+	}
+	if _, ok := s.floats[f]; ok {
+		return true
+	}
+	_, ok = s.intFloats[f]
+	return ok
+}
+
+// indexLists turns every literal list on the right of `in` / `not in` in e
+// into a valueSet, outside macro arguments (which macros see as written).
+func (o *optimizer) indexLists(e Expr) {
+	o.visit(e, func(n Expr) {
+		in, ok := n.(*InfixExpr)
+		if !ok || in.Op != "in" && in.Op != "not in" {
+			return
+		}
+		lit, ok := in.Right.(*LiteralExpr)
+		if !ok {
+			return
+		}
+		list, ok := lit.Value.([]any)
+		if !ok {
+			return
+		}
+		if set, ok := newValueSet(list); ok {
+			in.Right = &LiteralExpr{set}
+			o.inherit(lit, in.Right)
+		}
+	})
+}
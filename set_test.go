@@ -0,0 +1,99 @@
+package okra
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+type setName string
+type setFlag bool
+type setLevel int
+
+func TestValueSetMatchesScan(t *testing.T) {
+	lists := [][]any{
+		{"a", "b", "c", "d", "e", "f", "g", "h"},
+		{int64(1), int64(2), 3.5, -0.0, "1", true, int64(1) << 53, int64(math.MaxInt64)},
+		{1.0, 2.0, 0.1, math.Inf(1), false, "", int64(-7), int64(9007199254740993)},
+	}
+	big := uint64(math.MaxUint64)
+	needles := []any{
+		"a", "h", "z", "1", "", setName("a"), true, false, setFlag(true),
+		int64(1), int64(2), int64(3), int64(0), int64(9007199254740992), int64(9007199254740993),
+		int64(math.MaxInt64), int64(-7), 1.0, 3.5, 0.0, math.Copysign(0, -1), math.NaN(), math.Inf(1),
+		float32(3.5), 0.1, int(1), int8(-7), uint(2), setLevel(2), big, uint64(1),
+		nil, time.Unix(1, 0), []any{"a"}, []int64{1}, &struct{}{}, map[string]any{},
+	}
+	for _, list := range lists {
+		set, ok := newValueSet(list)
+		if !ok {
+			t.Fatalf("not indexed: %v", list)
+		}
+		for _, n := range needles {
+			want := false
+			for _, el := range list {
+				if valuesEqual(n, el) {
+					want = true
+				}
+			}
+			if got := set.has(n); got != want {
+				t.Errorf("%#v in %v: set %v, scan %v", n, list, got, want)
+			}
+		}
+	}
+	if _, ok := newValueSet([]any{"a", []any{"b"}}); ok {
+		t.Fatal("indexed a nested list")
+	}
+}
+
+func TestInLiteralListSet(t *testing.T) {
+	items := make([]string, 20)
+	for i := range items {
+		items[i] = fmt.Sprintf("'u%d'", i)
+	}
+	src := "x in [" + strings.Join(items, ", ") + ", 1.0] && x not in ['u3', 'u4', 'u5', 'u6', 'u7', 'u8', 'u9', 2]"
+	prog, err := NewEngine().Compile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := prog.ast.(*InfixExpr).Left.(*InfixExpr)
+	if _, ok := in.Right.(*LiteralExpr).Value.(*valueSet); !ok {
+		t.Fatalf("literal list not indexed: %T", in.Right.(*LiteralExpr).Value)
+	}
+	// String() and Cost are those of the list; only the scan is gone.
+	want := "((x in [" + strings.Join(items, ", ") + ", 1]) && (x not in ['u3', 'u4', 'u5', 'u6', 'u7', 'u8', 'u9', 2]))"
+	if got := prog.String(); got != want {
+		t.Fatalf("String() = %s", got)
+	}
+	if got := prog.Cost().Total; got != 1+(1+21+1+1)+(1+8+1+1) { // &&, then each in: node, elements, x, list
+		t.Fatalf("cost = %d", got)
+	}
+	for x, want := range map[any]bool{"u0": true, "u19": true, "u3": false, "u20": false, int64(1): true, 1: true, 2: false, nil: false} {
+		for _, p := range []*Program{prog, treeWalk(prog)} {
+			if v, err := p.Eval(map[string]any{"x": x}); v != want || err != nil {
+				t.Errorf("x=%#v: %v, %v", x, v, err)
+			}
+		}
+	}
+
+	// The set charges the steps of a scan that misses: one per element.
+	var steps uint64
+	ctx := Context{ctx: context.Background(), steps: &steps}
+	if _, err := evalIn(ctx, "u0", in.Right.(*LiteralExpr).Value); err != nil || steps != 21 {
+		t.Errorf("set lookup took %d steps, want 21 (%v)", steps, err)
+	}
+
+	// Macro arguments are left as written.
+	e := vmEngine(t)
+	prog, _ = e.Compile("any(xs, x in [1, 2, 3])")
+	walk(prog.ast, func(e Expr) {
+		if lit, ok := e.(*LiteralExpr); ok {
+			if _, ok := lit.Value.(*valueSet); ok {
+				t.Fatalf("indexed %s", lit)
+			}
+		}
+	})
+}
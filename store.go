@@ -0,0 +1,243 @@
+package okra
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store is a set of named rules loaded from a directory and compiled with an
+// Engine, reloaded when the files change:
+//
+//	store, err := okra.OpenStore(engine, "rules")
+//	go store.Watch(ctx, 5*time.Second, func(err error) { log.Print(err) })
+//	ok, err := store.Eval("approve", order)
+//
+// Two kinds of file hold rules; any other file is ignored, as are names
+// starting with "." or "_":
+//
+//   - name.okra holds one rule, name, whose expression is the whole file (it
+//     may span lines);
+//   - anything.rules holds one rule per `name: expression` line; blank lines
+//     and lines starting with # are skipped.
+//
+// A load replaces every rule at once, and only when every file reads and
+// every rule compiles: otherwise the Store keeps serving the last good
+// version and reports why (see Err). A Store is safe for concurrent use.
+type Store struct {
+	engine *Engine
+	dir    string
+	snap   atomic.Pointer[storeSnapshot]
+
+	mu      sync.Mutex // serializes loads, guards the fields below
+	stamps  []fileStamp
+	scanned bool // stamps are those of the last load, not of a failed scan
+	lastErr error
+}
+
+// storeSnapshot is one loaded version of a Store.
+type storeSnapshot struct {
+	rules   map[string]*Program
+	version uint64
+}
+
+// fileStamp is what a poll compares to notice a change: the set of rule
+// files, their sizes and modification times.
+type fileStamp struct {
+	name string
+	size int64
+	mod  time.Time
+}
+
+// OpenStore loads the rules of dir, failing unless all of them compile.
+func OpenStore(e *Engine, dir string) (*Store, error) {
+	s := &Store{engine: e, dir: dir}
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the named rule of the current version.
+func (s *Store) Get(name string) (*Program, bool) {
+	p, ok := s.snap.Load().rules[name]
+	return p, ok
+}
+
+// Eval evaluates the named rule of the current version against data.
+func (s *Store) Eval(name string, data any) (any, error) {
+	p, ok := s.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("okra: no rule %q", name)
+	}
+	return p.Eval(data)
+}
+
+// Rules returns the rules of the current version by name. Rules evaluated
+// together should come from one call, so they come from one version.
+func (s *Store) Rules() map[string]*Program { return maps.Clone(s.snap.Load().rules) }
+
+// Names returns the names of the current rules, sorted.
+func (s *Store) Names() []string {
+	return slices.Sorted(maps.Keys(s.snap.Load().rules))
+}
+
+// Version counts the versions loaded, starting at 1 for OpenStore's.
+func (s *Store) Version() uint64 { return s.snap.Load().version }
+
+// Err returns the error of the last load, or nil if it succeeded. While it is
+// non-nil, the Store serves the version before it.
+func (s *Store) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastErr
+}
+
+// Reload loads the directory now, whether or not it changed, and reports
+// whether it swapped in a new version. On error the current version stays.
+func (s *Store) Reload() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stamps, err := s.scan()
+	if err != nil {
+		return false, err
+	}
+	return s.load(stamps)
+}
+
+// Watch polls the directory every interval until ctx is done, reloading it
+// when a rule file appears, disappears, or changes size or modification time.
+// After each such reload it calls report, if non-nil, with the load's error
+// (nil when the new version is in place). A failed load is not retried until
+// the files change again.
+func (s *Store) Watch(ctx context.Context, interval time.Duration, report func(error)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if changed, err := s.poll(); changed && report != nil {
+			report(err)
+		}
+	}
+}
+
+// poll reloads the directory if it changed since the last load, reporting
+// whether it did.
+func (s *Store) poll() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failed := !s.scanned
+	stamps, err := s.scan()
+	if err != nil {
+		return !failed, err
+	}
+	if !failed && slices.EqualFunc(stamps, s.stamps, fileStamp.same) {
+		return false, nil
+	}
+	_, err = s.load(stamps)
+	return true, err
+}
+
+func (a fileStamp) same(b fileStamp) bool {
+	return a.name == b.name && a.size == b.size && a.mod.Equal(b.mod)
+}
+
+// scan lists the rule files of the directory. A failure is the load's.
+func (s *Store) scan() ([]fileStamp, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		s.scanned, s.lastErr = false, fmt.Errorf("okra: store: %w", err)
+		return nil, s.lastErr
+	}
+	var stamps []fileStamp
+	for _, ent := range entries {
+		name := ent.Name()
+		ext := filepath.Ext(name)
+		if ent.IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || ext != ".okra" && ext != ".rules" {
+			continue
+		}
+		info, err := ent.Info()
+		if err != nil {
+			s.scanned, s.lastErr = false, fmt.Errorf("okra: store: %w", err)
+			return nil, s.lastErr
+		}
+		stamps = append(stamps, fileStamp{name, info.Size(), info.ModTime()})
+	}
+	return stamps, nil
+}
+
+// load reads and compiles the files of stamps and swaps them in if all of
+// them compile. Every failure is reported, joined.
+func (s *Store) load(stamps []fileStamp) (bool, error) {
+	s.stamps, s.scanned = stamps, true
+	rules := map[string]*Program{}
+	from := map[string]string{} // file of each rule
+	var errs []error
+	add := func(file string, line int, name, src string) {
+		where := file
+		if line > 0 {
+			where = fmt.Sprintf("%s:%d", file, line)
+		}
+		if f, ok := from[name]; ok {
+			errs = append(errs, fmt.Errorf("okra: store: %s: rule %q already defined in %s", where, name, f))
+			return
+		}
+		p, err := s.engine.Compile(src)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("okra: store: %s: rule %q: %w", where, name, err))
+			return
+		}
+		rules[name], from[name] = p, where
+	}
+	for _, st := range stamps {
+		data, err := os.ReadFile(filepath.Join(s.dir, st.name))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("okra: store: %w", err))
+			continue
+		}
+		if strings.HasSuffix(st.name, ".okra") {
+			add(st.name, 0, strings.TrimSuffix(st.name, ".okra"), string(data))
+			continue
+		}
+		sc := bufio.NewScanner(strings.NewReader(string(data)))
+		for n := 1; sc.Scan(); n++ {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			name, src, ok := strings.Cut(line, ":")
+			if name = strings.TrimSpace(name); !ok || name == "" {
+				errs = append(errs, fmt.Errorf("okra: store: %s:%d: want `name: expression`", st.name, n))
+				continue
+			}
+			add(st.name, n, name, strings.TrimSpace(src))
+		}
+		if err := sc.Err(); err != nil {
+			errs = append(errs, fmt.Errorf("okra: store: %s: %w", st.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		s.lastErr = errors.Join(errs...)
+		return false, s.lastErr
+	}
+	var version uint64 = 1
+	if old := s.snap.Load(); old != nil {
+		version = old.version + 1
+	}
+	s.snap.Store(&storeSnapshot{rules: rules, version: version})
+	s.lastErr = nil
+	return true, nil
+}
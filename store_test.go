@@ -0,0 +1,187 @@
+package okra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeRule replaces a rule file at once, as a deployment should, moving its
+// modification time forward so a poll sees the change even within the file
+// system's mtime granularity.
+func writeRule(t *testing.T, dir, name, content string) {
+	t.Helper()
+	tmp := filepath.Join(dir, ".tmp")
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bump := time.Now().Add(time.Duration(len(content)+1) * time.Hour)
+	if err := os.Chtimes(tmp, bump, bump); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	writeRule(t, dir, "approve.okra", "amount < 100 &&\n  country in ['NL', 'BE']\n")
+	writeRule(t, dir, "limits.rules", "# limits\nsmall: amount < 10\n\nlarge: amount >= 1000\n")
+	writeRule(t, dir, "notes.txt", "not a rule")
+	writeRule(t, dir, "_draft.okra", "1 +")
+	writeRule(t, dir, ".hidden.rules", "x: 1 +")
+
+	s, err := OpenStore(NewEngine(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Names(); !reflect.DeepEqual(got, []string{"approve", "large", "small"}) {
+		t.Fatalf("names %v", got)
+	}
+	data := map[string]any{"amount": int64(5), "country": "NL"}
+	if v, err := s.Eval("approve", data); err != nil || v != true {
+		t.Fatalf("approve = %v, %v", v, err)
+	}
+	if v, err := s.Eval("large", data); err != nil || v != false {
+		t.Fatalf("large = %v, %v", v, err)
+	}
+	if _, err := s.Eval("nope", data); err == nil || err.Error() != `okra: no rule "nope"` {
+		t.Fatalf("undefined rule: %v", err)
+	}
+	if s.Version() != 1 || s.Err() != nil {
+		t.Fatalf("version %d, err %v", s.Version(), s.Err())
+	}
+
+	// Unchanged files are not reloaded.
+	if changed, err := s.poll(); changed || err != nil {
+		t.Fatalf("poll unchanged: %v, %v", changed, err)
+	}
+
+	// A change is swapped in whole.
+	writeRule(t, dir, "approve.okra", "amount < 2")
+	writeRule(t, dir, "limits.rules", "small: amount < 3")
+	if changed, err := s.poll(); !changed || err != nil {
+		t.Fatalf("poll changed: %v, %v", changed, err)
+	}
+	if v, _ := s.Eval("approve", data); v != false || s.Version() != 2 {
+		t.Fatalf("after reload: approve = %v, version %d", v, s.Version())
+	}
+	if _, ok := s.Get("large"); ok {
+		t.Fatal("a removed rule is still served")
+	}
+
+	// A broken rule keeps the last good version, until it is fixed.
+	rules := s.Rules()
+	writeRule(t, dir, "approve.okra", "amount <")
+	writeRule(t, dir, "limits.rules", "small: amount < 4\nsmall: true\nbad line")
+	changed, err := s.poll()
+	if !changed || err == nil || s.Err() != err {
+		t.Fatalf("broken: %v, %v", changed, err)
+	}
+	for _, want := range []string{
+		`okra: store: approve.okra: rule "approve": `,
+		`okra: store: limits.rules:2: rule "small" already defined in limits.rules:1`,
+		"okra: store: limits.rules:3: want `name: expression`",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("load error %q lacks %q", err, want)
+		}
+	}
+	if s.Version() != 2 || !reflect.DeepEqual(s.Rules(), rules) {
+		t.Fatal("a failed load replaced the rules")
+	}
+	if changed, err := s.poll(); changed || err != nil {
+		t.Fatalf("poll after failure: %v, %v", changed, err)
+	}
+	if s.Err() == nil {
+		t.Fatal("the load error was forgotten")
+	}
+	writeRule(t, dir, "approve.okra", "amount < 6")
+	writeRule(t, dir, "limits.rules", "")
+	if changed, err := s.poll(); !changed || err != nil || s.Err() != nil {
+		t.Fatalf("poll fixed: %v, %v", changed, err)
+	}
+	if v, _ := s.Eval("approve", data); v != true || s.Version() != 3 {
+		t.Fatalf("after fix: approve = %v, version %d", v, s.Version())
+	}
+
+	// Reload loads even when nothing changed.
+	if changed, err := s.Reload(); !changed || err != nil || s.Version() != 4 {
+		t.Fatalf("Reload: %v, %v, version %d", changed, err, s.Version())
+	}
+}
+
+func TestStoreErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeRule(t, dir, "a.rules", "x: 1\n")
+	writeRule(t, dir, "x.okra", "2")
+	if _, err := OpenStore(NewEngine(), dir); err == nil || !strings.Contains(err.Error(), `rule "x" already defined in a.rules:1`) {
+		t.Fatalf("duplicate across files: %v", err)
+	}
+	if _, err := OpenStore(NewEngine(), filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("missing directory")
+	}
+
+	// A directory that disappears keeps its rules and is reloaded once it
+	// comes back, even empty.
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenStore(NewEngine(), sub)
+	if err != nil || s.Version() != 1 || len(s.Names()) != 0 {
+		t.Fatalf("empty directory: %v", err)
+	}
+	if err := os.Remove(sub); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := s.poll(); !changed || err == nil || s.Version() != 1 {
+		t.Fatalf("directory removed: %v, %v", changed, err)
+	}
+	if changed, err := s.poll(); changed || err == nil {
+		t.Fatalf("directory still missing: %v, %v", changed, err)
+	}
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := s.poll(); !changed || err != nil || s.Err() != nil || s.Version() != 2 {
+		t.Fatalf("directory back: %v, %v", changed, err)
+	}
+}
+
+func TestStoreWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeRule(t, dir, "flag.okra", "1")
+	s, err := OpenStore(NewEngine(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	reports := make(chan error, 10)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.Watch(ctx, time.Millisecond, func(err error) { reports <- err })
+	}()
+
+	writeRule(t, dir, "flag.okra", "1 +")
+	if err := <-reports; err == nil {
+		t.Fatal("broken rule reported no error")
+	}
+	writeRule(t, dir, "flag.okra", "42")
+	if err := <-reports; err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Eval("flag", nil); err != nil || v != int64(42) {
+		t.Fatalf("flag = %v, %v", v, err)
+	}
+	cancel()
+	wg.Wait()
+}
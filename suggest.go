@@ -0,0 +1,181 @@
+package okra
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxSuggestions caps how many "did you mean" candidates an error carries.
+const maxSuggestions = 3
+
+// maxSuggestScan bounds how many candidate names (map keys, mostly) are
+// examined for a suggestion, so a miss against a huge map stays cheap. Beyond
+// it there is no suggestion at all: examining some of the names would make the
+// suggestion depend on which, and map iteration order is random.
+const maxSuggestScan = 1024
+
+// hintError decorates a lookup failure with "did you mean" suggestions. It is
+// transparent to errors.Is; opErr lifts the suggestions into Error.Suggestions.
+type hintError struct {
+	err         error
+	suggestions []string
+}
+
+func (h *hintError) Error() string {
+	quoted := make([]string, len(h.suggestions))
+	for i, s := range h.suggestions {
+		quoted[i] = strconv.Quote(s)
+	}
+	alts := quoted[0]
+	if n := len(quoted); n > 1 {
+		alts = strings.Join(quoted[:n-1], ", ") + " or " + quoted[n-1]
+	}
+	return h.err.Error() + " (did you mean " + alts + "?)"
+}
+
+func (h *hintError) Unwrap() error { return h.err }
+
+// withSuggestions attaches the candidates close to name to err, if any.
+func withSuggestions(err error, name string, candidates []string) error {
+	if err == nil {
+		return nil
+	}
+	if s := suggest(name, candidates); len(s) > 0 {
+		return &hintError{err: err, suggestions: s}
+	}
+	return err
+}
+
+// suggest returns up to maxSuggestions candidates within a small edit distance
+// of name, closest first. Comparison is case-insensitive, so `user.name` still
+// suggests `Name`; the threshold grows with the name's length (one edit per
+// three characters, at least one).
+func suggest(name string, candidates []string) []string {
+	if name == "" {
+		return nil
+	}
+	target := []rune(strings.ToLower(name))
+	limit := max(1, len(target)/3)
+	type scored struct {
+		name string
+		dist int
+	}
+	if len(candidates) > maxSuggestScan {
+		return nil
+	}
+	var found []scored
+	seen := map[string]bool{name: true} // never suggest the failing name itself
+	for _, c := range candidates {
+		if c == "" || seen[c] {
+			continue
+		}
+		seen[c] = true
+		if d := editDistance(target, []rune(strings.ToLower(c))); d <= limit {
+			found = append(found, scored{c, d})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].dist != found[j].dist {
+			return found[i].dist < found[j].dist
+		}
+		return found[i].name < found[j].name
+	})
+	var out []string
+	for i := 0; i < len(found) && i < maxSuggestions; i++ {
+		out = append(out, found[i].name)
+	}
+	return out
+}
+
+// editDistance is the optimal-string-alignment distance between a and b:
+// insertions, deletions, substitutions, and transpositions of adjacent
+// characters (the most common typo, `Naem` for `Name`) each cost one.
+func editDistance(a, b []rune) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(b)]
+}
+
+// structCandidates lists the names a member access on a struct could have
+// meant: fields (by name and tag) and the methods the filter permits.
+func structCandidates(ctx Context, meta structMeta) []string {
+	out := make([]string, 0, len(meta.fields)+len(meta.methods))
+	for name := range meta.fields {
+		out = append(out, name)
+	}
+	for name := range meta.methods {
+		if ctx.methodAllowed(name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// mapKeyCandidates lists the string keys of a map, or none when it has more
+// than maxSuggestScan.
+func mapKeyCandidates(rv reflect.Value) []string {
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String || rv.Len() > maxSuggestScan {
+		return nil
+	}
+	out := make([]string, 0, rv.Len())
+	it := rv.MapRange()
+	for it.Next() {
+		out = append(out, it.Key().String())
+	}
+	return out
+}
+
+// callCandidates lists what a bare call could have meant: registered
+// functions and macros, and the methods of the root data object.
+func callCandidates(ctx Context) []string {
+	var out []string
+	for name := range ctx.Fns {
+		out = append(out, name)
+	}
+	for name := range ctx.Macros {
+		out = append(out, name)
+	}
+	return append(out, methodCandidates(ctx, ctx.Data)...)
+}
+
+// methodCandidates lists the exported methods of obj (including those of its
+// pointer type) that the method filter permits.
+func methodCandidates(ctx Context, obj any) []string {
+	if obj == nil {
+		return nil
+	}
+	t := reflect.TypeOf(obj)
+	var out []string
+	add := func(t reflect.Type) {
+		for i := 0; i < t.NumMethod(); i++ {
+			if name := t.Method(i).Name; ctx.methodAllowed(name) {
+				out = append(out, name)
+			}
+		}
+	}
+	add(t)
+	if t.Kind() != reflect.Pointer && t.Kind() != reflect.Interface {
+		add(reflect.PointerTo(t))
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package okra
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type suggestUser struct {
+	Name    string
+	Email   string `json:"email"`
+	Country string
+}
+
+func (suggestUser) FullName() string { return "" }
+func (suggestUser) Secret() string   { return "" }
+
+func TestDidYouMean(t *testing.T) {
+	e := NewEngine()
+	e.SetMethodFilter(func(name string) bool { return name != "Secret" })
+	if err := e.RegisterMacro("anyOf", func(ctx Context, args []Expr) (any, error) { return false, nil }); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]any{
+		"user":   suggestUser{},
+		"limits": map[string]any{"daily": int64(1), "monthly": int64(2)},
+		"tiers":  map[string]int{"gold": 1, "silver": 2},
+	}
+	cases := []struct {
+		src  string
+		want []string
+		is   error
+	}{
+		{"user.Naem", []string{"Name"}, ErrUnknownField},            // transposition
+		{"user.name", []string{"Name"}, ErrUnknownField},            // case only
+		{"user.emial", []string{"Email", "email"}, ErrUnknownField}, // field and json tag
+		{"user.FulName()", []string{"FullName"}, ErrNotFound},       // method
+		{"user.Secrte", nil, ErrUnknownField},                       // filtered methods are never suggested
+		{"limits.dialy", []string{"daily"}, ErrUnknownField},        // map[string]any key
+		{"tiers['glod']", []string{"gold"}, ErrUnknownField},        // typed map, index form
+		{"usr.Name", []string{"user"}, ErrUnknownField},             // root variable
+		{"startwith(user.Name, 'a')", []string{"startswith"}, ErrNotFound},
+		{"anyof2(1)", []string{"anyof"}, ErrNotFound}, // macros are candidates too
+		{"user.Xyzzy", nil, ErrUnknownField},          // nothing close: no suggestion
+	}
+	for _, c := range cases {
+		_, err := e.Eval(c.src, data)
+		if !errors.Is(err, c.is) {
+			t.Fatalf("%s: expected %v, got %v", c.src, c.is, err)
+		}
+		var oe *Error
+		if !errors.As(err, &oe) {
+			t.Fatalf("%s: expected *Error, got %v", c.src, err)
+		}
+		if !reflect.DeepEqual(oe.Suggestions, c.want) {
+			t.Fatalf("%s: Suggestions = %q, want %q", c.src, oe.Suggestions, c.want)
+		}
+		if hinted := strings.Contains(err.Error(), "did you mean"); hinted != (c.want != nil) {
+			t.Fatalf("%s: message %q", c.src, err.Error())
+		}
+	}
+
+	// The message lists the alternatives.
+	_, err := e.Eval("user.Countyr", data)
+	if !strings.HasSuffix(err.Error(), `(did you mean "Country"?)`) {
+		t.Fatalf("message = %q", err.Error())
+	}
+
+	// Lenient mode has no error, hence nothing to suggest.
+	e.SetStrict(false)
+	if v, err := e.Eval("user.Naem", data); err != nil || v != nil {
+		t.Fatalf("lenient: got %v, %v", v, err)
+	}
+}
+
+func TestSuggestRanking(t *testing.T) {
+	got := suggest("stat", []string{"state", "status", "start", "stats", "total", "st"})
+	want := []string{"start", "state", "stats"} // distance 1, alphabetical; "status" is 2 away
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("suggest = %q, want %q", got, want)
+	}
+	for _, c := range []struct {
+		a, b string
+		d    int
+	}{{"Naem", "Name", 1}, {"", "abc", 3}, {"kitten", "sitting", 3}, {"ab", "ba", 1}, {"名前", "名前", 0}} {
+		if d := editDistance([]rune(c.a), []rune(c.b)); d != c.d {
+			t.Fatalf("editDistance(%q, %q) = %d, want %d", c.a, c.b, d, c.d)
+		}
+	}
+}
+
+func TestSuggestLargeMap(t *testing.T) {
+	// Up to maxSuggestScan keys, every key is a candidate; beyond, none is, so
+	// the outcome never depends on map iteration order.
+	e := NewEngine()
+	for _, n := range []int{maxSuggestScan, maxSuggestScan + 1} {
+		m := map[string]any{"daily": int64(1)}
+		for i := len(m); i < n; i++ {
+			m[fmt.Sprintf("key%05d", i)] = int64(i)
+		}
+		var want []string
+		if n <= maxSuggestScan {
+			want = []string{"daily"}
+		}
+		for range 20 {
+			_, err := e.Eval("m.dialy", map[string]any{"m": m})
+			var oe *Error
+			if !errors.As(err, &oe) || !reflect.DeepEqual(oe.Suggestions, want) {
+				t.Fatalf("%d keys: %v, want suggestions %q", n, err, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package okra
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// HitPolicy decides what a decision Table yields when several rows match.
+type HitPolicy int
+
+const (
+	// HitUnique expects at most one matching row; two are an error.
+	HitUnique HitPolicy = iota
+	// HitFirst yields the first matching row, in table order.
+	HitFirst
+	// HitCollect yields every matching row, in table order.
+	HitCollect
+)
+
+func (h HitPolicy) String() string {
+	switch h {
+	case HitUnique:
+		return "unique"
+	case HitFirst:
+		return "first"
+	case HitCollect:
+		return "collect"
+	}
+	return "unknown"
+}
+
+// outputPrefix marks an output column in a table's header.
+const outputPrefix = "out:"
+
+// Table is a decision table: rows of conditions on a fixed list of input
+// expressions, each with the outputs it yields when all of its conditions
+// hold. It is loaded from CSV (see Engine.LoadTable) and every cell is
+// compiled with the Engine, so a table is evaluated like any other rule.
+type Table struct {
+	inputs, outputs []string
+	policy          HitPolicy
+	rows            []tableRow
+}
+
+type tableRow struct {
+	line  int // in the CSV, for errors
+	cells []tableCell
+	outs  []*Program // nil for an empty cell
+}
+
+// tableCell is one input cell: the condition `(input) op operand`, or no
+// condition at all for an empty cell or "-".
+type tableCell struct {
+	op, operand string
+	when        *Program
+}
+
+// tableInput is the input of column col in a cell's condition. Within a
+// table evaluation its value is computed once, by the first cell to need it,
+// and shared by the column's other cells; elsewhere it is just X.
+type tableInput struct {
+	col int
+	X   Expr
+}
+
+// tableScope is the state of one evaluation of a Table: the column inputs
+// computed so far.
+type tableScope struct {
+	done []bool
+	vals []any
+}
+
+func (e *tableInput) Eval(ctx Context) (any, error) {
+	s := ctx.table
+	if s == nil {
+		return e.X.Eval(ctx)
+	}
+	if s.done[e.col] {
+		return s.vals[e.col], nil
+	}
+	v, err := e.X.Eval(ctx)
+	if err == nil {
+		s.done[e.col], s.vals[e.col] = true, v
+	}
+	return v, err
+}
+
+func (e *tableInput) String() string { return e.X.String() }
+
+// markInput wraps the input of column col, which spans in within the source
+// of a cell's condition, in a tableInput. The input is parenthesized at the
+// head of the condition, so it is the first node on the leftmost path down
+// from the root that lies within its span.
+func markInput(e Expr, spans map[Expr]span, in span, col int) Expr {
+	if sp, ok := spans[e]; ok && sp.start >= in.start && sp.end <= in.end {
+		x := &tableInput{col: col, X: e}
+		spans[x] = sp
+		return x
+	}
+	switch n := e.(type) {
+	case *InfixExpr:
+		n.Left = markInput(n.Left, spans, in, col)
+	case *TernaryExpr:
+		n.Cond = markInput(n.Cond, spans, in, col)
+	case *MemberAccessExpr:
+		n.Left = markInput(n.Left, spans, in, col)
+	case *IndexExpr:
+		n.Left = markInput(n.Left, spans, in, col)
+	case *MethodCallExpr:
+		n.Left = markInput(n.Left, spans, in, col)
+	}
+	return e
+}
+
+// Decision is a row of a Table that applied, with its outputs by name (nil
+// for an empty output cell).
+type Decision struct {
+	// Row is the row's 1-based number among the table's rows (the header and
+	// comment lines not counted).
+	Row     int
+	Outputs map[string]any
+}
+
+// LoadTable reads a decision table from CSV and compiles it with the Engine.
+//
+// The header names the columns: first the inputs, each an expression
+// (`customer.Age`, `len(order.Items)`), then the outputs, each a name prefixed
+// with "out:" (`out:discount`). Every further line is a row. An input cell is
+// a condition fragment applied to its column's input — `>= 18`, `< 5.5`,
+// `!= 'x'`, `in ['a', 'b']`, `not in [1, 2]` — or a bare value meaning
+// equality (`'gold'`, `true`); an empty cell or "-" matches anything. Strings
+// need their quotes, as in any expression. An output cell is an expression
+// (`0.1`, `'gold'`, `amount * 0.9`), evaluated against the same data when its
+// row applies. Lines starting with # are comments.
+//
+// Errors name the CSV line and column; an expression that does not compile
+// wraps the *Error of Compile, positioned in the cell's full condition
+// `(input) fragment`.
+func (e *Engine) LoadTable(r io.Reader, policy HitPolicy) (*Table, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("okra: table header: %w", err)
+	}
+	t := &Table{policy: policy}
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		if name, ok := strings.CutPrefix(h, outputPrefix); ok {
+			name = strings.TrimSpace(name)
+			if name == "" || slices.Contains(t.outputs, name) {
+				return nil, fmt.Errorf("okra: table header: output column %d: missing or duplicate name %q", i+1, name)
+			}
+			t.outputs = append(t.outputs, name)
+			continue
+		}
+		if h == "" || len(t.outputs) > 0 {
+			return nil, fmt.Errorf("okra: table header: column %d: want an input expression before the %q outputs", i+1, outputPrefix)
+		}
+		t.inputs = append(t.inputs, h)
+	}
+	if len(t.inputs) == 0 || len(t.outputs) == 0 {
+		return nil, errors.New("okra: table header: need at least one input and one output column")
+	}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("okra: table: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		row, err := e.tableRow(t, rec, line)
+		if err != nil {
+			return nil, err
+		}
+		t.rows = append(t.rows, row)
+	}
+	return t, nil
+}
+
+func (e *Engine) tableRow(t *Table, rec []string, line int) (tableRow, error) {
+	row := tableRow{line: line}
+	for i, in := range t.inputs {
+		c := tableCell{}
+		cell := strings.TrimSpace(rec[i])
+		if cell != "" && cell != "-" {
+			c.op, c.operand = splitCell(cell)
+			src := "(" + in + ") " + c.op + " " + c.operand
+			var err error
+			c.when, err = e.compileWith(src, func(ast Expr, spans map[Expr]span) Expr {
+				return markInput(ast, spans, span{1, 1 + len(in)}, i)
+			})
+			if err != nil {
+				return row, fmt.Errorf("okra: table line %d, column %q: %w", line, in, err)
+			}
+		}
+		row.cells = append(row.cells, c)
+	}
+	for i, name := range t.outputs {
+		var p *Program
+		if cell := strings.TrimSpace(rec[len(t.inputs)+i]); cell != "" {
+			var err error
+			if p, err = e.Compile(cell); err != nil {
+				return row, fmt.Errorf("okra: table line %d, column %q: %w", line, outputPrefix+name, err)
+			}
+		}
+		row.outs = append(row.outs, p)
+	}
+	return row, nil
+}
+
+// splitCell splits a condition fragment into its operator and operand; a bare
+// value is an equality.
+func splitCell(cell string) (op, operand string) {
+	for _, op := range []string{"not in", "in"} {
+		if rest, ok := strings.CutPrefix(cell, op); ok && rest != "" && (rest[0] == ' ' || rest[0] == '[') {
+			return op, strings.TrimSpace(rest)
+		}
+	}
+	for _, op := range []string{"==", "!=", ">=", "<=", ">", "<"} {
+		if rest, ok := strings.CutPrefix(cell, op); ok {
+			return op, strings.TrimSpace(rest)
+		}
+	}
+	return "==", cell
+}
+
+// Inputs returns the table's input expressions, in column order.
+func (t *Table) Inputs() []string { return slices.Clone(t.inputs) }
+
+// Outputs returns the table's output names, in column order.
+func (t *Table) Outputs() []string { return slices.Clone(t.outputs) }
+
+// Policy returns the table's hit policy.
+func (t *Table) Policy() HitPolicy { return t.policy }
+
+// Len returns the number of rows.
+func (t *Table) Len() int { return len(t.rows) }
+
+// Eval evaluates the table against data and returns the rows that apply
+// under its hit policy, in table order: at most one under HitUnique and
+// HitFirst, none when no row matches. A condition that fails or is not a bool,
+// or an output that fails, is an error naming the row and column. Each
+// column's input is evaluated once, by the first cell that needs it.
+func (t *Table) Eval(data any) ([]Decision, error) {
+	return t.eval(func(p *Program) Context { return p.context(data) })
+}
+
+// EvalContext is Eval with the cancellation of Program.EvalContext applied to
+// the whole table, as for RuleSet.EvalContext.
+func (t *Table) EvalContext(ctx context.Context, data any) ([]Decision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var steps uint64
+	return t.eval(func(p *Program) Context {
+		c := p.context(data)
+		c.ctx, c.steps = ctx, &steps
+		return c
+	})
+}
+
+func (t *Table) eval(contextOf func(*Program) Context) ([]Decision, error) {
+	scope := &tableScope{done: make([]bool, len(t.inputs)), vals: make([]any, len(t.inputs))}
+	cellContext := func(p *Program) Context {
+		c := contextOf(p)
+		c.table = scope
+		return c
+	}
+	var hits []int
+	for i, row := range t.rows {
+		ok, err := t.matches(i, row, cellContext)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if t.policy == HitUnique && len(hits) == 1 {
+			return nil, fmt.Errorf("okra: table rows %d and %d both match (hit policy unique)", hits[0]+1, i+1)
+		}
+		hits = append(hits, i)
+		if t.policy == HitFirst {
+			break
+		}
+	}
+	var out []Decision
+	for _, i := range hits {
+		d := Decision{Row: i + 1, Outputs: make(map[string]any, len(t.outputs))}
+		for j, p := range t.rows[i].outs {
+			var v any
+			if p != nil {
+				c := contextOf(p)
+				var err error
+				if v, err = p.run(c); err != nil {
+					return nil, setError(c, err, fmt.Sprintf("okra: table row %d, column %q", i+1, outputPrefix+t.outputs[j]))
+				}
+			}
+			d.Outputs[t.outputs[j]] = v
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// matches reports whether every condition of row i holds.
+func (t *Table) matches(i int, row tableRow, contextOf func(*Program) Context) (bool, error) {
+	for j, cell := range row.cells {
+		if cell.when == nil {
+			continue
+		}
+		c := contextOf(cell.when)
+		v, err := cell.when.run(c)
+		if err != nil {
+			return false, setError(c, err, fmt.Sprintf("okra: table row %d, column %q", i+1, t.inputs[j]))
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return false, fmt.Errorf("okra: table row %d, column %q: %w", i+1, t.inputs[j], cell.when.notBool(v))
+		}
+		if !b {
+			return false, nil
+		}
+	}
+	return true, nil
+}
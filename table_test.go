@@ -0,0 +1,174 @@
+package okra
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func loadTable(t *testing.T, policy HitPolicy, csv string) *Table {
+	t.Helper()
+	tb, err := NewEngine().LoadTable(strings.NewReader(csv), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tb
+}
+
+const discounts = `# customer discounts
+age,       tier,                out:discount, out:note
+< 18,      -,                   0,            'minor'
+>= 18,     "in ['gold', 'vip']", amount / 10,
+>= 65,     -,                   5,            'senior'
+>= 18,     not in ['gold'],     0,
+`
+
+func TestTableEval(t *testing.T) {
+	tb := loadTable(t, HitCollect, discounts)
+	if got := tb.Inputs(); !reflect.DeepEqual(got, []string{"age", "tier"}) {
+		t.Fatalf("inputs %v", got)
+	}
+	if got := tb.Outputs(); !reflect.DeepEqual(got, []string{"discount", "note"}) {
+		t.Fatalf("outputs %v", got)
+	}
+	if tb.Len() != 4 || tb.Policy() != HitCollect {
+		t.Fatalf("len %d, policy %v", tb.Len(), tb.Policy())
+	}
+
+	senior := map[string]any{"age": int64(70), "tier": "vip", "amount": int64(200)}
+	cases := []struct {
+		policy HitPolicy
+		data   map[string]any
+		want   []Decision
+		err    string
+	}{
+		{HitCollect, senior, []Decision{
+			{2, map[string]any{"discount": int64(20), "note": nil}},
+			{3, map[string]any{"discount": int64(5), "note": "senior"}},
+			{4, map[string]any{"discount": int64(0), "note": nil}},
+		}, ""},
+		{HitFirst, senior, []Decision{{2, map[string]any{"discount": int64(20), "note": nil}}}, ""},
+		{HitUnique, senior, nil, "okra: table rows 2 and 3 both match (hit policy unique)"},
+		{HitUnique, map[string]any{"age": int64(12), "tier": "gold"}, []Decision{{1, map[string]any{"discount": int64(0), "note": "minor"}}}, ""},
+		{HitUnique, map[string]any{"age": int64(30), "tier": "gold"}, nil, `okra: table row 2, column "out:discount": amount`},
+		{HitFirst, map[string]any{"age": "old", "tier": "gold"}, nil, `okra: table row 1, column "age": (age < 18)`},
+	}
+	for _, c := range cases {
+		tb := loadTable(t, c.policy, discounts)
+		got, err := tb.Eval(c.data)
+		if c.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), c.err) {
+				t.Errorf("%v %v: err %v, want %q", c.policy, c.data, err, c.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v %v: got %v, %v, want %v", c.policy, c.data, got, err, c.want)
+		}
+		if got, err := tb.EvalContext(context.Background(), c.data); err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v %v: EvalContext got %v, %v", c.policy, c.data, got, err)
+		}
+	}
+
+	got, err := loadTable(t, HitFirst, "x,out:y\n1,1\n").Eval(map[string]any{"x": int64(2)})
+	if got != nil || err != nil {
+		t.Fatalf("no match: %v, %v", got, err)
+	}
+	_, err = loadTable(t, HitFirst, "x,out:y\n== 2 ? 1 : 0,1\n").Eval(map[string]any{"x": int64(2)})
+	var oe *Error
+	if err == nil || err.Error() != `okra: table row 1, column "x": ((x == 2) ? 1 : 0): yielded int64, want bool` ||
+		!errors.As(err, &oe) || oe.Kind != KindEval || oe.Source != "(x) == 2 ? 1 : 0" {
+		t.Fatalf("non-bool cell: %v", err)
+	}
+
+	// A column's input is evaluated once per evaluation, not once per cell.
+	e := NewEngine()
+	calls := 0
+	_ = e.RegisterFunc("score", func(args []any) (any, error) { calls++; return args[0], nil })
+	tb2, err := e.LoadTable(strings.NewReader("score(n),out:y\n< 0,1\n< 5,2\n> 20,3\n-,4\n>= 10,5\n"), HitCollect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = tb2.Eval(map[string]any{"n": int64(12)})
+	if err != nil || len(got) != 2 || calls != 1 {
+		t.Fatalf("input evaluated %d times: %v, %v", calls, got, err)
+	}
+	if cond := tb2.rows[0].cells[0].when; cond.String() != "(score(n) < 0)" {
+		t.Fatalf("cell condition %s", cond)
+	}
+	if v, err := tb2.rows[0].cells[0].when.Eval(map[string]any{"n": int64(-1)}); v != true || err != nil || calls != 2 {
+		t.Fatalf("cell outside the table: %v, %v", v, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := tb.EvalContext(ctx, senior); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled: %v", err)
+	}
+}
+
+func TestTableLoadErrors(t *testing.T) {
+	cases := []struct{ csv, err string }{
+		{"", "okra: table header: EOF"},
+		{"a,b\n", "need at least one input and one output"},
+		{"out:y\n", "need at least one input and one output"},
+		{"a,out:y,b\n", "column 3: want an input expression"},
+		{"a,out:y,out:y\n", `missing or duplicate name "y"`},
+		{"a,out:y\n1\n", "wrong number of fields"},
+		{"a,out:y\n\n>= (,1\n", `okra: table line 3, column "a": `},
+		{"a,out:y\n1,amout +\n", `okra: table line 2, column "out:y": `},
+	}
+	for _, c := range cases {
+		_, err := NewEngine().LoadTable(strings.NewReader(c.csv), HitUnique)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: err %v, want %q", c.csv, err, c.err)
+		}
+	}
+	_, err := NewEngine().LoadTable(strings.NewReader("a,out:y\n>= (,1\n"), HitUnique)
+	var oe *Error
+	if !errors.As(err, &oe) || oe.Source != "(a) >= (" {
+		t.Fatalf("not an *Error of the cell's condition: %#v", err)
+	}
+}
+
+func TestTableCheck(t *testing.T) {
+	cases := []struct {
+		name, csv string
+		want      []string
+	}{
+		{"complete", "age,out:x\n< 18,1\n>= 18,2\n", nil},
+		{"integer gap", "age,out:x\n< 18,1\n> 18,2\n", []string{"gap: no row matches age == 18"}},
+		{"float gap", "age,out:x\n< 18,1\n> 18.5,2\n", []string{
+			"gap: no row matches age == 18",
+			"gap: no row matches age > 18, age < 18.5",
+			"gap: no row matches age == 18.5",
+		}},
+		{"overlap", "age,out:x\n<= 18,1\n>= 18,2\n", []string{"overlap: rows 1 and 2 overlap for age == 18"}},
+		{"strings", "tier,vip,out:x\n'gold',true,1\n\"in ['gold','silver']\",false,2\n\"not in ['gold','silver']\",-,3\n", []string{
+			"gap: no row matches tier == 'silver', vip == true",
+		}},
+		{"catch-all", "tier,out:x\n'a',1\n-,2\n", []string{"overlap: rows 1 and 2 overlap for tier == 'a'"}},
+		{"any", "tier,out:x\n-,1\n-,2\n", []string{"overlap: rows 1 and 2 overlap"}},
+		{"empty", "tier,out:x\n", []string{"gap: no row matches"}},
+		{"folded", "n,out:x\n< -1,1\n>= 2 - 3,2\n", nil},
+		{"mixed", "n,out:x\n1,1\n'a',2\n", []string{`unchecked: row 2, column "n": column mixes numbers and strings; the table cannot be checked`}},
+		{"dynamic", "n,out:x\n> m,1\n", []string{`unchecked: row 1, column "n": operand m is not a constant; the table cannot be checked`}},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, is := range loadTable(t, HitUnique, c.csv).Check() {
+			got = append(got, is.Kind.String()+": "+is.String())
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	issues := loadTable(t, HitUnique, discounts).Check()
+	if len(issues) == 0 || issues[0].Kind != TableOverlap || !reflect.DeepEqual(issues[0].Rows, []int{2, 3}) ||
+		issues[0].Example != "age == 65, tier == 'gold'" {
+		t.Fatalf("discounts: %+v", issues)
+	}
+}
@@ -0,0 +1,381 @@
+package okra
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// TableIssueKind classifies a TableIssue.
+type TableIssueKind int
+
+const (
+	// TableOverlap is a pair of rows that some input matches both of. Under
+	// HitUnique that input is an error; under HitFirst the later row is
+	// shadowed for it.
+	TableOverlap TableIssueKind = iota
+	// TableGap is a set of inputs that no row matches.
+	TableGap
+	// TableUnchecked reports that the table could not be checked: a column
+	// mixes value types, or a condition's operand is not a constant.
+	TableUnchecked
+)
+
+func (k TableIssueKind) String() string {
+	switch k {
+	case TableOverlap:
+		return "overlap"
+	case TableGap:
+		return "gap"
+	case TableUnchecked:
+		return "unchecked"
+	}
+	return "unknown"
+}
+
+// TableIssue is a problem found by Table.Check.
+type TableIssue struct {
+	Kind TableIssueKind
+	// Rows are the overlapping rows, or the row whose cell could not be
+	// checked; empty for a gap.
+	Rows []int
+	// Example describes inputs exhibiting the issue, as one condition per
+	// input column that constrains them (`age < 18, region == 'EU'`); empty
+	// when any input does.
+	Example string
+	Message string
+}
+
+func (i TableIssue) String() string { return i.Message }
+
+// maxTableIssues caps the overlaps and the gaps Check reports, each.
+const maxTableIssues = 20
+
+// checkBudget caps the cells visited looking for gaps.
+const checkBudget = 1 << 20
+
+// Check analyzes the table statically and reports the pairs of rows that
+// overlap and the inputs that no row covers, up to 20 of each.
+//
+// The analysis needs every condition's operand to be a constant (which
+// includes folded expressions like `-1` or `60 * 60`), and the constants of
+// one column to be all numbers, all strings or all bools, only numbers being
+// compared with < and the like; otherwise Check reports a single
+// TableUnchecked issue. It treats the input columns as independent, so inputs
+// that cannot occur together — `a` and `a * 2` as two columns — may still be
+// reported. Numbers are integers when every
+// constant of their column is, so `< 18` and `>= 18` leave no gap at 17.5.
+func (t *Table) Check() []TableIssue {
+	cols := make([]*checkColumn, len(t.inputs))
+	for j := range t.inputs {
+		col, issue := t.checkColumn(j)
+		if issue != nil {
+			return []TableIssue{*issue}
+		}
+		cols[j] = col
+	}
+	issues := t.overlaps(cols)
+	return append(issues, t.gaps(cols)...)
+}
+
+// checkColumn is an input column partitioned into atoms: classes of values
+// that each cell of the column matches entirely or not at all.
+type checkColumn struct {
+	input string
+	atoms []atom
+	// match[i][a] reports whether row i's cell matches atom a.
+	match [][]bool
+}
+
+type atom struct {
+	rep   any      // a value of the class
+	conds []string // conditions describing the class; none for any value
+}
+
+// cellValue is the constant of a cell: a scalar, or the list of an
+// `in` / `not in` cell.
+type cellValue struct {
+	op     string
+	scalar any
+	list   []any
+}
+
+// checkColumn partitions the values of column j.
+func (t *Table) checkColumn(j int) (*checkColumn, *TableIssue) {
+	col := &checkColumn{input: t.inputs[j]}
+	unchecked := func(i int, format string, args ...any) *TableIssue {
+		msg := fmt.Sprintf("row %d, column %q: ", i+1, col.input) + fmt.Sprintf(format, args...) + "; the table cannot be checked"
+		return &TableIssue{Kind: TableUnchecked, Rows: []int{i + 1}, Message: msg}
+	}
+	values := make([]*cellValue, len(t.rows))
+	kind := ""
+	for i, row := range t.rows {
+		cell := row.cells[j]
+		if cell.when == nil {
+			continue
+		}
+		e, err := ParseExpr(cell.operand)
+		if err != nil {
+			return nil, unchecked(i, "%v", err)
+		}
+		lit, ok := foldConstants(e).(*LiteralExpr)
+		if !ok {
+			return nil, unchecked(i, "operand %s is not a constant", cell.operand)
+		}
+		v := &cellValue{op: cell.op}
+		var scalars []any
+		if cell.op == "in" || cell.op == "not in" {
+			if v.list, ok = lit.Value.([]any); !ok {
+				return nil, unchecked(i, "operand %s is not a list", cell.operand)
+			}
+			scalars = v.list
+		} else {
+			v.scalar = lit.Value
+			scalars = []any{lit.Value}
+		}
+		for _, s := range scalars {
+			k := checkKind(s)
+			switch {
+			case k == "":
+				return nil, unchecked(i, "constant %s is not a number, string or bool", renderLiteral(s))
+			case kind != "" && k != kind:
+				return nil, unchecked(i, "column mixes %ss and %ss", kind, k)
+			case k != "number" && cell.op != "==" && cell.op != "!=" && cell.op != "in" && cell.op != "not in":
+				return nil, unchecked(i, "%s is not an ordering of %ss", cell.op, k)
+			}
+			kind = k
+		}
+		values[i] = v
+	}
+
+	switch kind {
+	case "":
+		col.atoms = []atom{{}}
+	case "number":
+		col.atoms = numberAtoms(values)
+	case "string":
+		col.atoms = stringAtoms(values)
+	case "bool":
+		col.atoms = []atom{{true, []string{"== true"}}, {false, []string{"== false"}}}
+	}
+	col.match = make([][]bool, len(t.rows))
+	for i, v := range values {
+		col.match[i] = make([]bool, len(col.atoms))
+		for a, at := range col.atoms {
+			col.match[i][a] = v == nil || v.matches(at.rep)
+		}
+	}
+	return col, nil
+}
+
+func checkKind(v any) string {
+	switch v.(type) {
+	case int64, float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	}
+	return ""
+}
+
+// matches evaluates `x op v` with the semantics of the language.
+func (v *cellValue) matches(x any) bool {
+	switch v.op {
+	case "==":
+		return valuesEqual(x, v.scalar)
+	case "!=":
+		return !valuesEqual(x, v.scalar)
+	case "in", "not in":
+		in := slices.ContainsFunc(v.list, func(y any) bool { return valuesEqual(x, y) })
+		return in == (v.op == "in")
+	}
+	ok, err := compare(x, v.scalar, v.op)
+	return ok && err == nil
+}
+
+// numberAtoms splits the number line at the column's constants: each constant
+// is an atom, and so is each open interval around them that holds a value.
+func numberAtoms(values []*cellValue) []atom {
+	ints := true
+	var points []float64
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		for _, s := range append([]any{v.scalar}, v.list...) {
+			switch n := s.(type) {
+			case int64:
+				points = append(points, float64(n))
+			case float64:
+				points = append(points, n)
+				ints = false
+			}
+		}
+	}
+	slices.Sort(points)
+	points = slices.Compact(points)
+	num := func(f float64) any {
+		if ints {
+			return int64(f)
+		}
+		return f
+	}
+	str := func(f float64) string { return renderLiteral(num(f)) }
+
+	first, last := points[0], points[len(points)-1]
+	atoms := []atom{{num(first - 1), []string{"< " + str(first)}}}
+	if !ints {
+		atoms[0].rep = first - math.Max(1, math.Abs(first))
+	}
+	for k, p := range points {
+		atoms = append(atoms, atom{num(p), []string{"== " + str(p)}})
+		if k == len(points)-1 {
+			break
+		}
+		next := points[k+1]
+		switch {
+		case !ints:
+			atoms = append(atoms, atom{p + (next-p)/2, []string{"> " + str(p), "< " + str(next)}})
+		case next-p == 2:
+			atoms = append(atoms, atom{num(p + 1), []string{"== " + str(p+1)}})
+		case next-p > 2:
+			atoms = append(atoms, atom{num(p + 1), []string{"> " + str(p), "< " + str(next)}})
+		}
+	}
+	over := atom{num(last + 1), []string{"> " + str(last)}}
+	if !ints {
+		over.rep = last + math.Max(1, math.Abs(last))
+	}
+	return append(atoms, over)
+}
+
+// stringAtoms makes an atom of each of the column's constants and one of every
+// other string.
+func stringAtoms(values []*cellValue) []atom {
+	var strs []string
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		for _, s := range append([]any{v.scalar}, v.list...) {
+			if s, ok := s.(string); ok {
+				strs = append(strs, s)
+			}
+		}
+	}
+	slices.Sort(strs)
+	strs = slices.Compact(strs)
+	atoms := make([]atom, 0, len(strs)+1)
+	lits := make([]any, len(strs))
+	other := "\x00"
+	for k, s := range strs {
+		atoms = append(atoms, atom{s, []string{"== " + renderLiteral(s)}})
+		lits[k] = s
+		for slices.Contains(strs, other) {
+			other += "\x00"
+		}
+	}
+	cond := "not in " + renderLiteral(lits)
+	if len(strs) == 1 {
+		cond = "!= " + renderLiteral(strs[0])
+	}
+	return append(atoms, atom{other, []string{cond}})
+}
+
+// describe renders one atom per column as an example input.
+func describe(cols []*checkColumn, atoms []int) string {
+	var parts []string
+	for j, a := range atoms {
+		for _, c := range cols[j].atoms[a].conds {
+			parts = append(parts, cols[j].input+" "+c)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// overlaps reports the pairs of rows sharing an atom in every column.
+func (t *Table) overlaps(cols []*checkColumn) []TableIssue {
+	var issues []TableIssue
+	atoms := make([]int, len(cols))
+	for i := range t.rows {
+	pairs:
+		for k := i + 1; k < len(t.rows); k++ {
+			for j, col := range cols {
+				atoms[j] = -1
+				for a := range col.atoms {
+					if col.match[i][a] && col.match[k][a] {
+						atoms[j] = a
+						break
+					}
+				}
+				if atoms[j] < 0 {
+					continue pairs
+				}
+			}
+			ex := describe(cols, atoms)
+			msg := fmt.Sprintf("rows %d and %d overlap", i+1, k+1)
+			if ex != "" {
+				msg += " for " + ex
+			}
+			issues = append(issues, TableIssue{Kind: TableOverlap, Rows: []int{i + 1, k + 1}, Example: ex, Message: msg})
+			if len(issues) == maxTableIssues {
+				return issues
+			}
+		}
+	}
+	return issues
+}
+
+// gaps reports the combinations of atoms, one per column, that no row
+// matches. Columns are split in order, and a combination is reported as soon
+// as its prefix leaves no row, so one gap may cover many combinations.
+func (t *Table) gaps(cols []*checkColumn) []TableIssue {
+	var issues []TableIssue
+	budget := checkBudget
+	atoms := make([]int, len(cols))
+	var search func(j int, rows []int) bool
+	search = func(j int, rows []int) bool {
+		if j == len(cols) {
+			return true
+		}
+		for a := range cols[j].atoms {
+			if budget--; budget < 0 {
+				return false
+			}
+			atoms[j] = a
+			var sub []int
+			for _, i := range rows {
+				if cols[j].match[i][a] {
+					sub = append(sub, i)
+				}
+			}
+			if len(sub) > 0 {
+				if !search(j+1, sub) {
+					return false
+				}
+				continue
+			}
+			ex := describe(cols[:j+1], atoms[:j+1])
+			msg := "no row matches"
+			if ex != "" {
+				msg += " " + ex
+			}
+			issues = append(issues, TableIssue{Kind: TableGap, Example: ex, Message: msg})
+			if len(issues) == maxTableIssues {
+				return false
+			}
+		}
+		return true
+	}
+	all := make([]int, len(t.rows))
+	for i := range all {
+		all[i] = i
+	}
+	if len(cols) > 0 && !search(0, all) && budget < 0 {
+		issues = append(issues, TableIssue{Kind: TableUnchecked, Message: "the table is too large to check for every gap"})
+	}
+	return issues
+}
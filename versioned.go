@@ -0,0 +1,188 @@
+package okra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RuleVersion is one version of a VersionedRule.
+type RuleVersion struct {
+	// ID numbers the versions of a rule from 1, in the order added.
+	ID      int
+	Author  string
+	Created time.Time
+	Source  string
+	Program *Program
+}
+
+// VersionedRule is one rule with a history of versions, of which one at a
+// time is live:
+//
+//	rule := okra.NewVersionedRule(engine)
+//	_, err := rule.Publish("amount < 1000", "alice")
+//	_, err = rule.Publish("amount < 5000 && !flagged", "bob")
+//	ok, v, err := rule.Eval(payment) // v.ID == 2
+//	_, _ = rule.Rollback()           // v1 is live again
+//
+// Versions are kept for the life of the rule, so any of them can be promoted
+// again without recompiling. A VersionedRule is safe for concurrent use:
+// promotion and rollback are atomic, and each evaluation runs one version
+// from start to end and reports which.
+type VersionedRule struct {
+	engine *Engine
+	mu     sync.Mutex // serializes changes
+	state  atomic.Pointer[versionState]
+}
+
+// versionState is one state of a VersionedRule.
+type versionState struct {
+	versions []*RuleVersion
+	live     *RuleVersion // nil before the first promotion
+	// earlier lists the versions live before, most recent last, for Rollback.
+	earlier []*RuleVersion
+}
+
+// NewVersionedRule returns a rule without versions, compiled with e.
+func NewVersionedRule(e *Engine) *VersionedRule {
+	r := &VersionedRule{engine: e}
+	r.state.Store(&versionState{})
+	return r
+}
+
+// Add compiles src and adds it as the next version, without promoting it.
+func (r *VersionedRule) Add(src, author string) (RuleVersion, error) {
+	return r.add(src, author, false)
+}
+
+// Publish compiles src, adds it as the next version and promotes it, in one
+// step.
+func (r *VersionedRule) Publish(src, author string) (RuleVersion, error) {
+	return r.add(src, author, true)
+}
+
+func (r *VersionedRule) add(src, author string, promote bool) (RuleVersion, error) {
+	prog, err := r.engine.Compile(src)
+	if err != nil {
+		return RuleVersion{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.state.Load()
+	v := &RuleVersion{
+		ID:      len(old.versions) + 1,
+		Author:  author,
+		Created: time.Now(),
+		Source:  src,
+		Program: prog,
+	}
+	st := &versionState{versions: append(slices.Clip(old.versions), v), live: old.live, earlier: old.earlier}
+	if promote {
+		st.promote(v)
+	}
+	r.state.Store(st)
+	return *v, nil
+}
+
+// promote makes v live, remembering the version it replaces.
+func (st *versionState) promote(v *RuleVersion) {
+	if st.live == v {
+		return
+	}
+	if st.live != nil {
+		st.earlier = append(slices.Clip(st.earlier), st.live)
+	}
+	st.live = v
+}
+
+// Promote makes the version id live. Promoting the live version does nothing.
+func (r *VersionedRule) Promote(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.state.Load()
+	if id < 1 || id > len(old.versions) {
+		return fmt.Errorf("okra: no version %d", id)
+	}
+	st := *old
+	st.promote(old.versions[id-1])
+	r.state.Store(&st)
+	return nil
+}
+
+// Rollback makes the version live before the last promotion live again and
+// returns it. Repeated, it walks back through the promotions; it fails when
+// there is no earlier version.
+func (r *VersionedRule) Rollback() (RuleVersion, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.state.Load()
+	if len(old.earlier) == 0 {
+		return RuleVersion{}, errors.New("okra: no version to roll back to")
+	}
+	n := len(old.earlier) - 1
+	r.state.Store(&versionState{versions: old.versions, live: old.earlier[n], earlier: old.earlier[:n]})
+	return *old.earlier[n], nil
+}
+
+// Live returns the live version, if any has been promoted.
+func (r *VersionedRule) Live() (RuleVersion, bool) {
+	if v := r.state.Load().live; v != nil {
+		return *v, true
+	}
+	return RuleVersion{}, false
+}
+
+// Version returns the version id.
+func (r *VersionedRule) Version(id int) (RuleVersion, bool) {
+	vs := r.state.Load().versions
+	if id < 1 || id > len(vs) {
+		return RuleVersion{}, false
+	}
+	return *vs[id-1], true
+}
+
+// Versions returns every version, oldest first.
+func (r *VersionedRule) Versions() []RuleVersion {
+	vs := r.state.Load().versions
+	out := make([]RuleVersion, len(vs))
+	for i, v := range vs {
+		out[i] = *v
+	}
+	return out
+}
+
+// Eval evaluates the live version against data and returns the version it
+// evaluated along with the result, even on error. An error names the version
+// (`okra: version 3: …`) and wraps the Program's.
+func (r *VersionedRule) Eval(data any) (any, RuleVersion, error) {
+	return r.eval(nil, data)
+}
+
+// EvalContext is Eval with the cancellation of Program.EvalContext.
+func (r *VersionedRule) EvalContext(ctx context.Context, data any) (any, RuleVersion, error) {
+	return r.eval(ctx, data)
+}
+
+func (r *VersionedRule) eval(ctx context.Context, data any) (any, RuleVersion, error) {
+	v := r.state.Load().live
+	if v == nil {
+		return nil, RuleVersion{}, errors.New("okra: no version promoted")
+	}
+	c := v.Program.context(data)
+	if ctx != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, *v, err
+		}
+		var steps uint64
+		c.ctx, c.steps = ctx, &steps
+	}
+	res, err := v.Program.run(c)
+	if err != nil {
+		err = setError(c, err, fmt.Sprintf("okra: version %d", v.ID))
+	}
+	return res, *v, err
+}
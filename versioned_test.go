@@ -0,0 +1,136 @@
+package okra
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVersionedRule(t *testing.T) {
+	r := NewVersionedRule(NewEngine())
+	if _, _, err := r.Eval(nil); err == nil || err.Error() != "okra: no version promoted" {
+		t.Fatalf("no version: %v", err)
+	}
+	start := time.Now()
+	v1, err := r.Publish("amount < 1000", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.ID != 1 || v1.Author != "alice" || v1.Source != "amount < 1000" || v1.Created.Before(start) {
+		t.Fatalf("v1 = %+v", v1)
+	}
+	data := map[string]any{"amount": int64(2000)}
+	if res, v, err := r.Eval(data); err != nil || res != false || v.ID != 1 {
+		t.Fatalf("v1: %v, %d, %v", res, v.ID, err)
+	}
+
+	// Added but not promoted: v1 stays live.
+	v2, err := r.Add("amount < 5000", "bob")
+	if err != nil || v2.ID != 2 {
+		t.Fatalf("Add: %+v, %v", v2, err)
+	}
+	if live, _ := r.Live(); live.ID != 1 {
+		t.Fatalf("live %d after Add", live.ID)
+	}
+	if err := r.Promote(2); err != nil {
+		t.Fatal(err)
+	}
+	if res, v, err := r.Eval(data); err != nil || res != true || v.ID != 2 || v.Author != "bob" {
+		t.Fatalf("v2: %v, %+v, %v", res, v, err)
+	}
+	if _, err := r.Publish("amount <", "carol"); err == nil {
+		t.Fatal("a broken version was published")
+	}
+	if _, err := r.Publish("amount < 3000", "carol"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rollback walks back through the promotions, not the IDs.
+	if err := r.Promote(1); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []int{3, 2, 1} {
+		v, err := r.Rollback()
+		if err != nil || v.ID != want {
+			t.Fatalf("Rollback = %d, %v; want %d", v.ID, err, want)
+		}
+		if live, _ := r.Live(); live.ID != want {
+			t.Fatalf("live %d, want %d", live.ID, want)
+		}
+	}
+	if _, err := r.Rollback(); err == nil {
+		t.Fatal("rolled back past the first promotion")
+	}
+	if err := r.Promote(4); err == nil || err.Error() != "okra: no version 4" {
+		t.Fatalf("Promote(4): %v", err)
+	}
+	if vs := r.Versions(); len(vs) != 3 || vs[2].Author != "carol" {
+		t.Fatalf("versions %+v", vs)
+	}
+	if v, ok := r.Version(2); !ok || v.Source != "amount < 5000" {
+		t.Fatalf("Version(2) = %+v", v)
+	}
+	if _, ok := r.Version(0); ok {
+		t.Fatal("Version(0)")
+	}
+}
+
+func TestVersionedRuleErrors(t *testing.T) {
+	r := NewVersionedRule(NewEngine())
+	if _, err := r.Publish("a / b", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	_, v, err := r.Eval(map[string]any{"a": int64(1), "b": int64(0)})
+	var oe *Error
+	if !errors.Is(err, ErrDivByZero) || !errors.As(err, &oe) || !strings.HasPrefix(err.Error(), "okra: version 1: ") || v.ID != 1 {
+		t.Fatalf("error %v from version %d", err, v.ID)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, v, err := r.EvalContext(ctx, nil); !errors.Is(err, context.Canceled) || v.ID != 1 {
+		t.Fatalf("cancelled: %v", err)
+	}
+}
+
+func TestVersionedRuleConcurrent(t *testing.T) {
+	// Version i yields i, so every result must match the version reported.
+	r := NewVersionedRule(NewEngine())
+	for _, src := range []string{"1", "2", "3"} {
+		if _, err := r.Publish(src, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				res, v, err := r.Eval(nil)
+				if err != nil || res != int64(v.ID) {
+					t.Errorf("result %v from version %d: %v", res, v.ID, err)
+					return
+				}
+			}
+		}()
+	}
+	for i := range 1000 {
+		if err := r.Promote(i%3 + 1); err != nil {
+			t.Fatal(err)
+		}
+		if i%7 == 0 {
+			_, _ = r.Rollback()
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
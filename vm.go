@@ -0,0 +1,951 @@
+package okra
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// -----------------------------------------------------------------------------
+// Bytecode VM
+// -----------------------------------------------------------------------------
+//
+// Compile lowers the folded AST into a flat instruction list for a stack
+// machine. Evaluating it avoids an interface call and a Context copy per node,
+// and has typed fast paths for int64/float64/string/bool operands. Semantics
+// are those of the tree-walking Expr.Eval, exactly:
+//
+//   - Errors are annotated with the same AST node (via opErr), so messages
+//     and positions are identical.
+//   - EvalContext step accounting matches: a node's step is taken when the
+//     tree-walker would enter it, before any of its children run. Entries with
+//     nothing between them (a.b.c enters three nodes before reading a) are
+//     charged in one batch on the first instruction that follows them.
+//   - Anything the compiler does not recognize (a custom Expr implementation,
+//     a BadExpr) is evaluated by the tree-walker through opEval.
+//
+// Operands are values: int64 and float64 intermediates are held unboxed and
+// only converted to any where they leave the fast paths, and call arguments
+// are assembled in pooled buffers, so a typical comparison/logic rule over a
+// map[string]any evaluates without allocating.
+
+type opcode uint8
+
+const (
+	opConst      opcode = iota // push consts[a]
+	opVar                      // push the member s of the root data
+	opMember                   // replace top with its member s
+	opIndexNil                 // top is nil: miss, then (lenient) jump to a
+	opIndex                    // pop idx; replace obj with obj[idx]
+	opIndexK                   // replace obj with obj[consts[a]] (nil-checked)
+	opMethodPre                // checks on the receiver before a method's args; may jump to a
+	opMethodCall               // pop b args; replace receiver with receiver.s(args)
+	opMacro                    // push macros[a](ctx, node.Args)
+	opFunc                     // pop b args; push fns[a](args)
+	opBuiltin                  // opFunc for a built-in, with pooled args
+	opDataPre                  // resolve the data-method fallback s before its args
+	opDataCall                 // pop b args; push Data.s(args)
+	opUnary                    // replace top with node's unary operator applied
+	opAnd                      // top is false: jump to a, else pop
+	opOr                       // top is true: jump to a, else pop
+	opBool                     // top must be a bool (right operand of && / ||)
+	opBinary                   // pop r; replace l with l op r
+	opBinaryK                  // replace l with l op consts[a]
+	opJumpFalse                // pop a condition; jump to a when false
+	opJump                     // jump to a
+	opList                     // pop b elements; push them as []any
+	opMemo                     // memo slot b is set: push its value, jump to a
+	opMemoSet                  // store top in memo slot b
+	opChain                    // push the value of chains[a]
+	opEval                     // push node.Eval(ctx) (tree-walker fallback)
+)
+
+// binop identifies the operators with typed fast paths; binOther always goes
+// through InfixExpr.apply.
+type binop uint8
+
+const (
+	binOther binop = iota
+	binAdd
+	binSub
+	binMul
+	binDiv
+	binMod
+	binGt
+	binLt
+	binGe
+	binLe
+	binEq
+	binNe
+)
+
+var binops = map[string]binop{
+	"+": binAdd, "-": binSub, "*": binMul, "/": binDiv, "%": binMod,
+	">": binGt, "<": binLt, ">=": binGe, "<=": binLe, "==": binEq, "!=": binNe,
+}
+
+type instr struct {
+	op  opcode
+	bin binop
+	// pre is the number of node entries (EvalContext steps) charged before
+	// this instruction runs.
+	pre  uint32
+	a, b int32
+	s    string
+	// node is the AST node the instruction belongs to, for error annotation.
+	node Expr
+	// cache is the inline cache of an opVar/opMember.
+	cache *fieldCache
+}
+
+type bytecode struct {
+	code     []instr
+	consts   []any
+	fns      []CustomFunc
+	macros   []MacroFunc
+	chains   []*chainCode
+	maxStack int
+}
+
+// chainCode is a chainExpr lowered: each operand, and the chain as written,
+// compiled on its own, so that a failing operand can fall back to the latter.
+type chainCode struct {
+	node    *chainExpr
+	ops     []*bytecode
+	written *bytecode
+}
+
+// compileBytecode lowers ast, resolving calls against the Program's function
+// and macro snapshot the way CallExpr.Eval resolves them at run time.
+func compileBytecode(ast Expr, fns map[string]CustomFunc, macros map[string]MacroFunc) *bytecode {
+	c := &vmCompiler{bc: &bytecode{}, fns: fns, macros: macros}
+	c.expr(ast)
+	return c.bc
+}
+
+// sub compiles e as a separate program run on top of the current stack.
+func (c *vmCompiler) sub(e Expr) *bytecode {
+	bc := compileBytecode(e, c.fns, c.macros)
+	c.bc.maxStack = max(c.bc.maxStack, c.sp+bc.maxStack)
+	return bc
+}
+
+type vmCompiler struct {
+	bc      *bytecode
+	fns     map[string]CustomFunc
+	macros  map[string]MacroFunc
+	pending uint32 // node entries not yet charged to an instruction
+	sp      int
+}
+
+func (c *vmCompiler) emit(in instr) int {
+	in.pre, c.pending = c.pending, 0
+	c.bc.code = append(c.bc.code, in)
+	return len(c.bc.code) - 1
+}
+
+// patch points the jump at i to the next instruction to be emitted.
+func (c *vmCompiler) patch(i int) { c.bc.code[i].a = int32(len(c.bc.code)) }
+
+// grow records a stack effect of n.
+func (c *vmCompiler) grow(n int) {
+	c.sp += n
+	c.bc.maxStack = max(c.bc.maxStack, c.sp)
+}
+
+func (c *vmCompiler) constant(v any) int32 {
+	c.bc.consts = append(c.bc.consts, v)
+	return int32(len(c.bc.consts) - 1)
+}
+
+func (c *vmCompiler) args(args []Expr) {
+	for _, a := range args {
+		c.expr(a)
+	}
+}
+
+func (c *vmCompiler) expr(e Expr) {
+	switch n := e.(type) {
+	case *LiteralExpr:
+		c.emit(instr{op: opConst, a: c.constant(n.Value), node: n})
+		c.grow(1)
+		return
+	case *VariableExpr:
+		c.pending++
+		c.emit(instr{op: opVar, s: n.Name, node: n, cache: new(fieldCache)})
+		c.grow(1)
+		return
+	case *MemberAccessExpr:
+		c.pending++
+		c.expr(n.Left)
+		c.emit(instr{op: opMember, s: n.Key, node: n, cache: new(fieldCache)})
+		return
+	case *IndexExpr:
+		c.pending++
+		c.expr(n.Left)
+		if lit, ok := n.Index.(*LiteralExpr); ok {
+			c.emit(instr{op: opIndexK, a: c.constant(lit.Value), node: n})
+			return
+		}
+		j := c.emit(instr{op: opIndexNil, node: n})
+		c.expr(n.Index)
+		c.emit(instr{op: opIndex, node: n})
+		c.grow(-1)
+		c.patch(j)
+		return
+	case *MethodCallExpr:
+		c.pending++
+		c.expr(n.Left)
+		j := c.emit(instr{op: opMethodPre, s: n.Method, b: int32(len(n.Args)), node: n})
+		c.args(n.Args)
+		c.emit(instr{op: opMethodCall, s: n.Method, b: int32(len(n.Args)), node: n})
+		c.grow(-len(n.Args))
+		c.patch(j)
+		return
+	case *CallExpr:
+		c.pending++
+		name := n.key()
+		if m, ok := c.macros[name]; ok {
+			c.bc.macros = append(c.bc.macros, m)
+			c.emit(instr{op: opMacro, a: int32(len(c.bc.macros) - 1), node: n})
+			c.grow(1)
+			return
+		}
+		if fn, ok := c.fns[name]; ok {
+			// Take the index before compiling the arguments, which may add
+			// functions of their own: upper(trim(s)).
+			c.bc.fns = append(c.bc.fns, fn)
+			idx := int32(len(c.bc.fns) - 1)
+			c.args(n.Args)
+			op := opFunc
+			if builtinCode[reflect.ValueOf(fn).Pointer()] {
+				op = opBuiltin
+			}
+			c.emit(instr{op: op, a: idx, b: int32(len(n.Args)), node: n})
+			c.grow(1 - len(n.Args))
+			return
+		}
+		c.emit(instr{op: opDataPre, s: n.Name, node: n})
+		c.args(n.Args)
+		c.emit(instr{op: opDataCall, s: n.Name, b: int32(len(n.Args)), node: n})
+		c.grow(1 - len(n.Args))
+		return
+	case *UnaryExpr:
+		c.pending++
+		c.expr(n.Right)
+		c.emit(instr{op: opUnary, node: n})
+		return
+	case *InfixExpr:
+		c.pending++
+		c.expr(n.Left)
+		if n.Op == "&&" || n.Op == "||" {
+			op := opAnd
+			if n.Op == "||" {
+				op = opOr
+			}
+			j := c.emit(instr{op: op, node: n})
+			c.grow(-1)
+			c.expr(n.Right)
+			c.emit(instr{op: opBool, node: n})
+			c.patch(j)
+			return
+		}
+		if lit, ok := n.Right.(*LiteralExpr); ok {
+			c.emit(instr{op: opBinaryK, bin: binops[n.Op], a: c.constant(lit.Value), node: n})
+			return
+		}
+		c.expr(n.Right)
+		c.emit(instr{op: opBinary, bin: binops[n.Op], node: n})
+		c.grow(-1)
+		return
+	case *TernaryExpr:
+		c.pending++
+		c.expr(n.Cond)
+		j := c.emit(instr{op: opJumpFalse, node: n.Cond})
+		c.grow(-1)
+		c.expr(n.Then)
+		k := c.emit(instr{op: opJump, node: n})
+		c.grow(-1)
+		c.patch(j)
+		c.expr(n.Else)
+		c.patch(k)
+		return
+	case *ListExpr:
+		c.pending++
+		c.args(n.Elems)
+		c.emit(instr{op: opList, b: int32(len(n.Elems)), node: n})
+		c.grow(1 - len(n.Elems))
+		return
+	case *chainExpr:
+		// Like chainExpr.Eval, the chain takes no step of its own.
+		ch := &chainCode{node: n, written: c.sub(n.Written)}
+		for _, op := range n.Ops {
+			ch.ops = append(ch.ops, c.sub(op))
+		}
+		c.bc.chains = append(c.bc.chains, ch)
+		c.emit(instr{op: opChain, a: int32(len(c.bc.chains) - 1), node: n})
+		c.grow(1)
+		return
+	case *sharedExpr:
+		// Like sharedExpr.Eval, a shared node takes no step of its own.
+		j := c.emit(instr{op: opMemo, b: int32(n.slot), node: n})
+		c.expr(n.X)
+		c.emit(instr{op: opMemoSet, b: int32(n.slot), node: n})
+		c.patch(j)
+		return
+	}
+	c.emit(instr{op: opEval, node: e})
+	c.grow(1)
+}
+
+// vkind tags the representation of a value.
+type vkind uint8
+
+const (
+	vAny   vkind = iota // boxed in x
+	vInt                // int64 in n
+	vFloat              // float64 bits in n
+)
+
+// value is an operand of the machine: an int64 or float64 held unboxed, or
+// anything else boxed. It stands for exactly the Go value any() returns; the
+// unboxed forms only save the allocation of boxing arithmetic results.
+type value struct {
+	x any
+	n uint64
+	k vkind
+}
+
+func boxed(v any) value          { return value{x: v} }
+func intValue(i int64) value     { return value{n: uint64(i), k: vInt} }
+func floatValue(f float64) value { return value{n: math.Float64bits(f), k: vFloat} }
+
+// any returns v as the interpreter represents it.
+func (v value) any() any {
+	switch v.k {
+	case vInt:
+		return int64(v.n)
+	case vFloat:
+		return math.Float64frombits(v.n)
+	}
+	return v.x
+}
+
+// int reports v's value if it is an int64, boxed or not.
+func (v value) int() (int64, bool) {
+	switch v.k {
+	case vInt:
+		return int64(v.n), true
+	case vAny:
+		i, ok := v.x.(int64)
+		return i, ok
+	}
+	return 0, false
+}
+
+// float reports v's value if it is a float64, boxed or not.
+func (v value) float() (float64, bool) {
+	switch v.k {
+	case vFloat:
+		return math.Float64frombits(v.n), true
+	case vAny:
+		f, ok := v.x.(float64)
+		return f, ok
+	}
+	return 0, false
+}
+
+// number reports v's value as a float64 if it is an int64 or a float64.
+func (v value) number() (float64, bool) {
+	if i, ok := v.int(); ok {
+		return float64(i), true
+	}
+	return v.float()
+}
+
+// machine is the reusable evaluation state of one Eval.
+type machine struct{ stack []value }
+
+var machinePool = sync.Pool{New: func() any { return new(machine) }}
+
+// argPool holds the argument buffers of calls that are known not to keep
+// their args: built-in functions, and methods (called through reflection,
+// which copies them). A registered function may keep its args, so it is
+// passed a fresh slice.
+var argPool = sync.Pool{New: func() any { return new([]any) }}
+
+// builtinCode holds the code pointers of the built-in functions, to tell them
+// from registered ones of the same name.
+var builtinCode = func() map[uintptr]bool {
+	m := map[uintptr]bool{}
+	for _, fn := range defaultFuncs() {
+		m[reflect.ValueOf(fn).Pointer()] = true
+	}
+	return m
+}()
+
+// smallStack is the operand stack depth served from the goroutine stack
+// instead of the machine pool; it covers nearly every real rule.
+const smallStack = 16
+
+// run evaluates the bytecode against ctx.
+func (bc *bytecode) run(ctx Context) (any, error) {
+	if bc.maxStack <= smallStack {
+		var buf [smallStack]value
+		return bc.exec(ctx, buf[:0])
+	}
+	m := machinePool.Get().(*machine)
+	if cap(m.stack) < bc.maxStack {
+		m.stack = make([]value, 0, bc.maxStack)
+	}
+	v, err := bc.exec(ctx, m.stack[:0])
+	// Drop references to data before pooling the machine.
+	clear(m.stack[:bc.maxStack])
+	machinePool.Put(m)
+	return v, err
+}
+
+func (bc *bytecode) exec(ctx Context, s []value) (any, error) {
+	code := bc.code
+	for pc := 0; pc < len(code); pc++ {
+		in := &code[pc]
+		if in.pre != 0 && ctx.steps != nil {
+			if err := ctx.stepN(in.pre); err != nil {
+				return nil, err
+			}
+		}
+		top := len(s) - 1
+		switch in.op {
+		case opConst:
+			s = append(s, boxed(bc.consts[in.a]))
+
+		case opVar:
+			if ctx.rules != nil {
+				if v, ok, err := ctx.rules.get(in.s); ok {
+					if err != nil {
+						return nil, err
+					}
+					s = append(s, boxed(v))
+					continue
+				}
+			}
+			v, err := in.cache.member(ctx, ctx.Data, in.s)
+			if err != nil {
+				return nil, opErr(in.node, err)
+			}
+			s = append(s, boxed(v))
+
+		case opMember:
+			obj := s[top].any()
+			if obj == nil {
+				if _, err := ctx.miss("cannot access %q on nil", in.s); err != nil {
+					return nil, opErr(in.node, err)
+				}
+				continue
+			}
+			v, err := in.cache.member(ctx, obj, in.s)
+			if err != nil {
+				return nil, opErr(in.node, err)
+			}
+			s[top] = boxed(v)
+
+		case opIndexNil:
+			if s[top].any() == nil {
+				if _, err := ctx.miss("cannot index nil"); err != nil {
+					return nil, opErr(in.node, err)
+				}
+				pc = int(in.a) - 1
+			}
+
+		case opIndex:
+			v, err := indexValue(ctx, s[top-1].any(), s[top].any())
+			if err != nil {
+				return nil, opErr(in.node, err)
+			}
+			s = s[:top]
+			s[top-1] = boxed(v)
+
+		case opIndexK:
+			obj := s[top].any()
+			if obj == nil {
+				if _, err := ctx.miss("cannot index nil"); err != nil {
+					return nil, opErr(in.node, err)
+				}
+				continue
+			}
+			v, err := indexValue(ctx, obj, bc.consts[in.a])
+			if err != nil {
+				return nil, opErr(in.node, err)
+			}
+			s[top] = boxed(v)
+
+		case opMethodPre:
+			obj := s[top].any()
+			if obj == nil {
+				if _, err := ctx.miss("cannot call %q on nil", in.s); err != nil {
+					return nil, opErr(in.node, err)
+				}
+				pc = int(in.a) - 1
+				continue
+			}
+			if in.s == "len" && in.b == 0 {
+				if n, ok := lenShortcut(obj); ok {
+					s[top] = boxed(n)
+					pc = int(in.a) - 1
+					continue
+				}
+			}
+			if !ctx.methodAllowed(in.s) {
+				return nil, opErr(in.node, fmt.Errorf("%q: %w", in.s, ErrMethodDenied))
+			}
+
+		case opMethodCall:
+			base := len(s) - int(in.b)
+			obj := s[base-1].any()
+			args := popArgs(s, base)
+			v, err := callReflectMethod(obj, in.s, *args)
+			putArgs(args)
+			if err != nil {
+				return nil, opErr(in.node, methodCallErr(ctx, obj, in.s, err))
+			}
+			s = s[:base]
+			s[base-1] = boxed(v)
+
+		case opMacro:
+			v, err := bc.macros[in.a](ctx, in.node.(*CallExpr).Args)
+			if err != nil {
+				return nil, opErr(in.node, err)
+			}
+			s = append(s, boxed(v))
+
+		case opFunc:
+			base := len(s) - int(in.b)
+			args := make([]any, len(s)-base)
+			for i, v := range s[base:] {
+				args[i] = v.any()
+			}
+			v, err := bc.fns[in.a](args)
+			if err != nil {
+				return nil, opErr(in.node, err)
+			}
+			s = append(s[:base], boxed(v))
+
+		case opBuiltin:
+			base := len(s) - int(in.b)
+			args := popArgs(s, base)
+			v, err := bc.fns[in.a](*args)
+			putArgs(args)
+			if err != nil {
+				return nil, opErr(in.node, err)
+			}
+			s = append(s[:base], boxed(v))
+
+		case opDataPre:
+			if ctx.Data == nil || !hasMethod(ctx.Data, in.s) {
+				err := fmt.Errorf("%q: %w", in.s, ErrNotFound)
+				return nil, opErr(in.node, withSuggestions(err, in.s, callCandidates(ctx)))
+			}
+			if !ctx.methodAllowed(in.s) {
+				return nil, opErr(in.node, fmt.Errorf("%q: %w", in.s, ErrMethodDenied))
+			}
+
+		case opDataCall:
+			base := len(s) - int(in.b)
+			args := popArgs(s, base)
+			v, err := callReflectMethod(ctx.Data, in.s, *args)
+			putArgs(args)
+			if err != nil {
+				return nil, opErr(in.node, err)
+			}
+			s = append(s[:base], boxed(v))
+
+		case opUnary:
+			n := in.node.(*UnaryExpr)
+			if v, ok := fastUnary(n.Op, s[top]); ok {
+				s[top] = v
+				continue
+			}
+			v, err := n.apply(s[top].any())
+			if err != nil {
+				return nil, opErr(in.node, err)
+			}
+			s[top] = boxed(v)
+
+		case opAnd, opOr:
+			b, err := asBool(s[top].any())
+			if err != nil {
+				return nil, opErr(in.node, err)
+			}
+			if b == (in.op == opOr) {
+				s[top] = boxed(b)
+				pc = int(in.a) - 1
+				continue
+			}
+			s = s[:top]
+
+		case opBool:
+			b, err := asBool(s[top].any())
+			if err != nil {
+				// InfixExpr.Eval returns false alongside this error, and the value
+				// reaches the caller when nothing but ternary branches sit between.
+				var v any
+				if bc.tail(pc) {
+					v = b
+				}
+				return v, opErr(in.node, err)
+			}
+			s[top] = boxed(b)
+
+		case opBinary:
+			v, err := bc.binary(ctx, in, s[top-1], s[top])
+			if err != nil {
+				return nil, opErr(in.node, err)
+			}
+			s = s[:top]
+			s[top-1] = v
+
+		case opBinaryK:
+			v, err := bc.binary(ctx, in, s[top], boxed(bc.consts[in.a]))
+			if err != nil {
+				return nil, opErr(in.node, err)
+			}
+			s[top] = v
+
+		case opJumpFalse:
+			b, err := asBool(s[top].any())
+			if err != nil {
+				return nil, opErr(in.node, err)
+			}
+			s = s[:top]
+			if !b {
+				pc = int(in.a) - 1
+			}
+
+		case opJump:
+			pc = int(in.a) - 1
+
+		case opList:
+			// A list is a value of its own, so it gets a fresh slice.
+			base := len(s) - int(in.b)
+			list := make([]any, 0, len(s)-base)
+			for _, v := range s[base:] {
+				list = append(list, v.any())
+			}
+			s = append(s[:base], boxed(list))
+
+		case opMemo:
+			if ctx.memo != nil {
+				if m := &ctx.memo[in.b]; m.ok {
+					s = append(s, boxed(m.v))
+					pc = int(in.a) - 1
+				} else {
+					m.getters = *ctx.getters
+				}
+			}
+
+		case opMemoSet:
+			if ctx.memo != nil {
+				if m := &ctx.memo[in.b]; m.getters == *ctx.getters {
+					*m = memoSlot{v: s[top].any(), ok: true}
+				}
+			}
+
+		case opChain:
+			v, err := bc.chains[in.a].run(ctx, s[len(s):])
+			if err != nil {
+				// As for opBool: the value of a failed && / || reaches the
+				// caller only in tail position.
+				if !bc.tail(pc) {
+					v = nil
+				}
+				return v, err
+			}
+			s = append(s, boxed(v))
+
+		case opEval:
+			v, err := in.node.Eval(ctx)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, boxed(v))
+		}
+	}
+	return s[0].any(), nil
+}
+
+// binary applies the operator of the opBinary/opBinaryK in to l and r.
+func (bc *bytecode) binary(ctx Context, in *instr, l, r value) (value, error) {
+	if v, ok, err := fastBinary(in.bin, l, r); ok {
+		return v, err
+	}
+	v, err := in.node.(*InfixExpr).apply(ctx, l.any(), r.any())
+	return boxed(v), err
+}
+
+// run is chainExpr.Eval on the machine, with s the free stack above the
+// caller's operands.
+func (ch *chainCode) run(ctx Context, s []value) (any, error) {
+	e := ch.node
+	decisive := e.Op == "||"
+	order := *e.order.Load()
+	for k, i := range order {
+		v, err := ch.ops[i].exec(ctx, s)
+		b, ok := v.(bool)
+		if err != nil || !ok {
+			if ctx.cancelled() {
+				return nil, err
+			}
+			return ch.written.exec(ctx, s)
+		}
+		if !e.observe(i, b == decisive) {
+			continue
+		}
+		for j := range i {
+			if !e.unsettled(ctx, order[:k], j) {
+				continue
+			}
+			v, err := ch.ops[j].exec(ctx, s)
+			if c, ok := v.(bool); err != nil || !ok {
+				if ctx.cancelled() {
+					return nil, err
+				}
+				return ch.written.exec(ctx, s)
+			} else if c == decisive {
+				break
+			}
+		}
+		return b, nil
+	}
+	e.finish()
+	return !decisive, nil
+}
+
+// fieldCache is the inline cache of one member access site: the dynamic type
+// last seen there, if it is a struct (or pointer to one), and the field index
+// path the key resolves to in it. A hit reads the field directly, skipping the
+// metadata lookup of getMember; any other type, and any case the direct read
+// cannot complete (a nil pointer on the way), takes the generic path. The
+// cache is monomorphic — a site that sees a new struct type re-learns it — and
+// atomic, since a Program is evaluated concurrently.
+type fieldCache struct{ entry atomic.Pointer[fieldEntry] }
+
+type fieldEntry struct {
+	typ  reflect.Type
+	path []int
+}
+
+// member is getMember(ctx, obj, key) through the cache.
+func (c *fieldCache) member(ctx Context, obj any, key string) (any, error) {
+	if e := c.entry.Load(); e != nil && e.typ == reflect.TypeOf(obj) {
+		if v, ok := e.read(obj); ok {
+			return v, nil
+		}
+	}
+	v, err := getMember(ctx, obj, key)
+	if err == nil {
+		c.learn(obj, key)
+	}
+	return v, err
+}
+
+func (e *fieldEntry) read(obj any) (any, bool) {
+	rv := reflect.ValueOf(obj)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+	fv, err := rv.FieldByIndexErr(e.path)
+	if err != nil {
+		return nil, false
+	}
+	return fv.Interface(), true
+}
+
+// learn caches obj's type when key resolved to one of its struct fields.
+func (c *fieldCache) learn(obj any, key string) {
+	t := reflect.TypeOf(obj)
+	if e := c.entry.Load(); e != nil && e.typ == t {
+		return
+	}
+	st := t
+	for st != nil && st.Kind() == reflect.Pointer {
+		st = st.Elem()
+	}
+	if st == nil || st.Kind() != reflect.Struct {
+		return
+	}
+	if path, ok := getStructMeta(st).fields[key]; ok {
+		c.entry.Store(&fieldEntry{typ: t, path: path})
+	}
+}
+
+// tail reports whether the result of the instruction at pc is the result of
+// the whole program: only jumps (out of ternary branches) and memo stores
+// follow it.
+func (bc *bytecode) tail(pc int) bool {
+	for pc++; pc < len(bc.code); pc++ {
+		switch bc.code[pc].op {
+		case opMemoSet:
+		case opJump:
+			pc = int(bc.code[pc].a) - 1
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// popArgs copies s[base:] into a pooled argument buffer, to be returned with
+// putArgs once the call is over.
+func popArgs(s []value, base int) *[]any {
+	args := argPool.Get().(*[]any)
+	for _, v := range s[base:] {
+		*args = append(*args, v.any())
+	}
+	return args
+}
+
+// putArgs drops the buffer's references to data and pools it.
+func putArgs(args *[]any) {
+	clear(*args)
+	*args = (*args)[:0]
+	argPool.Put(args)
+}
+
+// fastBinary evaluates the common same-type operand pairs without reflection
+// or boxing. It reports false when the pair has no fast path, for
+// InfixExpr.apply to handle; when it reports true, the result is exactly what
+// apply returns.
+func fastBinary(op binop, l, r value) (value, bool, error) {
+	if op == binOther {
+		return value{}, false, nil
+	}
+	li, lok := l.int()
+	ri, rok := r.int()
+	if lok && rok {
+		lv, rv := li, ri
+		switch op {
+		case binAdd:
+			return intResult(intMath(lv, rv, '+'))
+		case binSub:
+			return intResult(intMath(lv, rv, '-'))
+		case binMul:
+			return intResult(intMath(lv, rv, '*'))
+		case binDiv:
+			return intResult(intMath(lv, rv, '/'))
+		case binMod:
+			return intResult(intMath(lv, rv, '%'))
+		case binEq:
+			return boxed(lv == rv), true, nil
+		case binNe:
+			return boxed(lv != rv), true, nil
+		}
+		// Ordering compares integers as float64, like compare.
+		return compareFloat(float64(lv), float64(rv), op)
+	}
+	// Any other int64/float64 mix computes in float64, like evalMath.
+	if lv, ok := l.number(); ok {
+		rv, ok := r.number()
+		if !ok {
+			return value{}, false, nil
+		}
+		switch op {
+		case binAdd:
+			return floatValue(lv + rv), true, nil
+		case binSub:
+			return floatValue(lv - rv), true, nil
+		case binMul:
+			return floatValue(lv * rv), true, nil
+		case binDiv:
+			if rv == 0 {
+				return value{}, true, ErrDivByZero
+			}
+			return floatValue(lv / rv), true, nil
+		case binMod:
+			return value{}, true, ErrFloatModulo
+		case binEq:
+			return boxed(lv == rv), true, nil
+		case binNe:
+			return boxed(lv != rv), true, nil
+		}
+		return compareFloat(lv, rv, op)
+	}
+	switch lv := l.x.(type) {
+	case string:
+		rv, ok := r.x.(string)
+		if !ok {
+			break
+		}
+		switch op {
+		case binAdd:
+			return boxed(lv + rv), true, nil
+		case binEq:
+			return boxed(lv == rv), true, nil
+		case binNe:
+			return boxed(lv != rv), true, nil
+		case binGt:
+			return boxed(lv > rv), true, nil
+		case binLt:
+			return boxed(lv < rv), true, nil
+		case binGe:
+			return boxed(lv >= rv), true, nil
+		case binLe:
+			return boxed(lv <= rv), true, nil
+		}
+	case bool:
+		rv, ok := r.x.(bool)
+		if !ok {
+			break
+		}
+		switch op {
+		case binEq:
+			return boxed(lv == rv), true, nil
+		case binNe:
+			return boxed(lv != rv), true, nil
+		}
+	}
+	return value{}, false, nil
+}
+
+func intResult(v int64, err error) (value, bool, error) {
+	if err != nil {
+		return value{}, true, err
+	}
+	return intValue(v), true, nil
+}
+
+func compareFloat(l, r float64, op binop) (value, bool, error) {
+	switch op {
+	case binGt:
+		return boxed(l > r), true, nil
+	case binLt:
+		return boxed(l < r), true, nil
+	case binGe:
+		return boxed(l >= r), true, nil
+	case binLe:
+		return boxed(l <= r), true, nil
+	}
+	return value{}, false, nil
+}
+
+// fastUnary is fastBinary for UnaryExpr.apply: it negates int64 and float64
+// operands, and complements int64 ones, without boxing the result.
+func fastUnary(op string, v value) (value, bool) {
+	if i, ok := v.int(); ok {
+		switch {
+		case op == "-" && i != math.MinInt64:
+			return intValue(-i), true
+		case op == "~":
+			return intValue(^i), true
+		}
+		return value{}, false
+	}
+	if f, ok := v.float(); ok && op == "-" {
+		return floatValue(-f), true
+	}
+	return value{}, false
+}
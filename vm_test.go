@@ -0,0 +1,375 @@
+package okra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type vmUser struct {
+	Name   string
+	Age    int
+	Tags   []string
+	Next   *vmUser
+	Scores map[string]int
+}
+
+func (u vmUser) Greet(s string) string { return s + ", " + u.Name }
+func (u vmUser) Fail() (int, error)    { return 0, errors.New("boom") }
+
+// vmRoot adds a data-method fallback target: a bare call like Double(2)
+// resolves against the root object.
+type vmRoot map[string]any
+
+func (vmRoot) Double(n int64) int64 { return 2 * n }
+
+// vmCheck evaluates prog both ways and returns a mismatch description, or "".
+func vmCheck(prog *Program, data any) string {
+	run := func(vm bool) (any, error, uint64) {
+		var steps, getters uint64
+		ctx := Context{
+			Data: data, Fns: prog.fns, Macros: prog.macros, Strict: prog.strict,
+			MethodFilter: prog.methodFilter, ctx: context.Background(), steps: &steps,
+			memo: make([]memoSlot, prog.slots), getters: &getters,
+		}
+		var v any
+		var err error
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic: %v", r)
+				}
+			}()
+			if vm {
+				v, err = prog.code.run(ctx)
+			} else {
+				v, err = prog.ast.Eval(ctx)
+			}
+		}()
+		return v, prog.locate(err), steps
+	}
+	tv, terr, tsteps := run(false)
+	vv, verr, vsteps := run(true)
+	if fmt.Sprint(terr) != fmt.Sprint(verr) {
+		return fmt.Sprintf("error: tree %v, vm %v", terr, verr)
+	}
+	var toe, voe *Error
+	if errors.As(terr, &toe) && errors.As(verr, &voe) && (toe.Start != voe.Start || toe.End != voe.End) {
+		return fmt.Sprintf("error span: tree [%d,%d), vm [%d,%d)", toe.Start, toe.End, voe.Start, voe.End)
+	}
+	if !reflect.DeepEqual(tv, vv) {
+		return fmt.Sprintf("value: tree %#v, vm %#v", tv, vv)
+	}
+	if tsteps != vsteps {
+		return fmt.Sprintf("steps: tree %d, vm %d", tsteps, vsteps)
+	}
+	return ""
+}
+
+func vmEngine(t testing.TB) *Engine {
+	e := NewEngine()
+	err := e.RegisterMacro("any", func(ctx Context, args []Expr) (any, error) {
+		coll, err := args[0].Eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		rv := reflect.ValueOf(coll)
+		for i := 0; i < rv.Len(); i++ {
+			child := ctx
+			child.Data = rv.Index(i).Interface()
+			v, err := args[1].Eval(child)
+			if err != nil {
+				return nil, err
+			}
+			if b, ok := v.(bool); ok && b {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func vmData() vmRoot {
+	return vmRoot{
+		"a": int64(7), "b": int64(-3), "f": 2.5, "g": 0.0, "s": "okra", "t": true, "n": nil,
+		"big":   int64(1) << 62,
+		"xs":    []int64{1, 2, 3},
+		"fs":    []float64{1.5, 2},
+		"names": []string{"x", "y"},
+		"m":     map[string]any{"k": int64(1), "inner": map[string]any{"z": "deep"}},
+		"im":    map[int]string{1: "one"},
+		"user": &vmUser{Name: "Alice", Age: 30, Tags: []string{"vip"},
+			Scores: map[string]int{"math": 90}},
+		"orders": []map[string]any{{"price": int64(10)}, {"price": int64(60)}},
+	}
+}
+
+var vmExprs = []string{
+	// literals, folding and arithmetic fast paths
+	"1 + 2", "a + b", "a - b * 2", "a / b", "a % b", "a / 0", "a % 0", "big * 4", "big + big",
+	"-9223372036854775807 - a", "f + f", "f - 1", "f * a", "f / g", "f % 2", "a + f", "s + s", "s + a",
+	"a > b", "a >= 7", "b < a", "b <= -3", "f > a", "s < 'p'", "s >= s", "s > a",
+	"a == 7", "a != 7.0", "f == 2.5", "s == 'okra'", "t == true", "t != false", "n == nil_", "a == s",
+	"big + 1 > big", "9007199254740993 > 9007199254740992 + a - a",
+	// logic and ternary
+	"t && a > 1", "!t || a > 1", "a && t", "t && a", "!t && a", "t || a", "a > 1 ? s : f",
+	"t && 0 && 0", "t ? t && 0 : 1",
+	"a ? 1 : 2", "t ? (f ? 1 : 2) : 3", "!t ? missing : 'ok'", "!(a > b) && !!t",
+	"-a", "-f", "~a", "-s", "~f", "!a", "-(-9223372036854775807 - 1)",
+	// bitwise, in
+	"a & 3", "a | 8", "a ^ a", "a << 2", "a >> b", "1 << 70", "a & f",
+	"a in xs", "2 in xs", "2.0 in xs", "'x' in names", "1 in im", "'z' in m.inner", "'kr' in s", "a in s", "1 in n",
+	"a not in xs", "s in ['okra', 'beet']", "[a, f, s] == [7, 2.5, 'okra']",
+	// data access
+	"user.Name", "user.Age + 1", "user.Nmae", "user.Tags[0]", "user.Tags[5]", "user.Tags[s]",
+	"user.Next.Name", "user.Next[0]", "user.Next.Greet('hi')", "m.inner.z", "m['inner']['z']",
+	"m.nope", "m['k'] + 1", "im[1]", "im['1']", "im[2]", "xs[1] * 2", "xs.1", "n.x", "n[0]", "n.Foo()",
+	"user.Greet('hello')", "user.Greet(1)", "user.Grete('x')", "user.Fail()", "user.Tags.len()",
+	"s.len()", "xs.len()", "a.len()", "user.Next.len()",
+	// calls
+	"len(xs) + len(s)", "len(a)", "lower(s) == 'okra'", "upper(trim(s))", "len(lower(s)) + len(xs)", "contains(s, 'kr') ? 1 : 0", "nope(1)",
+	"Double(a)", "Double(s)", "Double(nope)", "any(orders, price > 50)", "any(orders, price > x)",
+	"any(xs, t)", "date('2026-01-01') < date('2027-01-01')", "has(user, 'Age') && get(m, 'zz', 3) == 3",
+	// lists
+	"[]", "[a, [b, s]]", "[a, missing]", "[1, 2][a - 6]",
+	// shared sub-expressions
+	"user.Age + user.Age * user.Age", "t ? user.Name : user.Name + s", "!t && user.Age > 1 || user.Age > 2",
+	"t ? (t && a) : (t && a)", "user.Nmae + user.Nmae", "m.inner.z + m.inner.z",
+	// unboxed intermediates leaving the fast paths
+	"-(f * 2) < 0", "~(a + 1)", "-(b - 9223372036854775805)", "!(a + 1)", "(a + 1) ? 1 : 2",
+	"a * 2 + f", "f * 2 + a", "(a * 3) & 1", "(a * 1000) + ''", "xs[a - 6]", "user.Tags[a - 7]",
+	"(a * 1000).x", "(f * 2).len()", "Double(a * 100)", "len(f * 2)", "[a * 1000, f * 2]",
+	"(f * 2) in fs", "a * 1000 in xs", "f * f + f * f", "a * 1000 == 7000.0", "a * 2 > f", "a + f / 2",
+	"9007199254740993 == 9007199254740992.0 + g", "a * 0 == -g", "a / 0.0",
+}
+
+func TestVMMatchesTreeWalker(t *testing.T) {
+	for _, strict := range []bool{true, false} {
+		e := vmEngine(t)
+		e.SetStrict(strict)
+		for _, src := range vmExprs {
+			prog, err := e.Compile(src)
+			if err != nil {
+				t.Fatalf("%s: %v", src, err)
+			}
+			if msg := vmCheck(prog, vmData()); msg != "" {
+				t.Errorf("strict=%v %s: %s", strict, src, msg)
+			}
+		}
+	}
+}
+
+func TestVMMethodFilter(t *testing.T) {
+	e := NewEngine()
+	e.SetMethodFilter(func(name string) bool { return name != "Greet" && name != "Double" })
+	for _, src := range []string{"user.Greet('x')", "Double(a)", "user.Name", "xs.len()"} {
+		prog, err := e.Compile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg := vmCheck(prog, vmData()); msg != "" {
+			t.Errorf("%s: %s", src, msg)
+		}
+	}
+}
+
+func TestVMFallback(t *testing.T) {
+	// A BadExpr (or any Expr the compiler doesn't know) runs on the tree-walker
+	// inside the VM.
+	ast, diags := ParseAll("a + (b *)")
+	code := compileBytecode(ast, nil, nil)
+	if code.code[2].op != opEval {
+		t.Fatalf("expected an opEval instruction, got %+v", code.code)
+	}
+	_, err := code.run(Context{Data: vmData()})
+	if err != error(diags[0]) {
+		t.Fatalf("got %v, want %v", err, diags[0])
+	}
+}
+
+func TestVMCancellation(t *testing.T) {
+	prog, err := NewEngine().Compile("a > 0 && 5 in big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	data := map[string]any{"a": int64(1), "big": make([]int64, 5000)}
+	if _, err := prog.EvalContext(ctx, data); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v", err)
+	}
+	// Steps batched on one instruction still poll when they cross a multiple
+	// of 1024.
+	e := NewEngine()
+	e.SetMaxNestingDepth(2000)
+	prog, err = e.Compile(strings.Repeat("-", 1500) + "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var steps uint64 = 1000
+	_, err = prog.code.run(Context{Data: data, ctx: ctx, steps: &steps})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func FuzzVMMatchesTreeWalker(f *testing.F) {
+	for _, s := range vmExprs {
+		f.Add(s)
+	}
+	e := vmEngine(f)
+	lenient := vmEngine(f)
+	lenient.SetStrict(false)
+	f.Fuzz(func(t *testing.T, src string) {
+		for _, e := range []*Engine{e, lenient} {
+			prog, err := e.Compile(src)
+			if err != nil {
+				return
+			}
+			if msg := vmCheck(prog, vmData()); msg != "" {
+				t.Fatalf("%s: %s", src, msg)
+			}
+		}
+	})
+}
+
+type CacheBase struct{ ID int }
+
+type cacheA struct {
+	Pad  string
+	Name string
+	*CacheBase
+}
+
+type cacheB struct{ Name string }
+
+func (cacheB) Title() string { return "getter" }
+
+func TestVMFieldCache(t *testing.T) {
+	prog, err := NewEngine().Compile("x.Name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idProg, err := NewEngine().Compile("x.ID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nilA *cacheA
+	// One access site sees a sequence of dynamic types; every result must
+	// match the uncached tree-walker.
+	seq := []any{
+		cacheA{Name: "a"}, cacheA{Name: "a2"}, &cacheA{Name: "pa"}, cacheB{Name: "b"},
+		map[string]any{"Name": "m"}, nilA, cacheA{Name: "a3"}, &cacheB{Name: "pb"}, 42,
+	}
+	for _, x := range seq {
+		for _, p := range []*Program{prog, idProg} {
+			if msg := vmCheck(p, map[string]any{"x": x}); msg != "" {
+				t.Errorf("%s on %T: %s", p.src, x, msg)
+			}
+		}
+	}
+	// A cached path through a nil embedded pointer falls back to the miss.
+	if _, err := idProg.Eval(map[string]any{"x": cacheA{CacheBase: &CacheBase{ID: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idProg.Eval(map[string]any{"x": cacheA{}}); !errors.Is(err, ErrUnknownField) {
+		t.Fatalf("nil embedded pointer: got %v", err)
+	}
+	// Getters are never cached.
+	title, _ := NewEngine().Compile("x.Title")
+	for range 2 {
+		if v, err := title.Eval(map[string]any{"x": cacheB{}}); v != "getter" || err != nil {
+			t.Fatalf("getter: %v, %v", v, err)
+		}
+	}
+}
+
+func TestVMFieldCacheConcurrent(t *testing.T) {
+	prog, err := NewEngine().Compile("x.Name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	for g := range 8 {
+		go func() {
+			for i := range 500 {
+				var x any = cacheA{Name: "a"}
+				if (g+i)%2 == 0 {
+					x = &cacheB{Name: "a"}
+				}
+				if v, err := prog.Eval(map[string]any{"x": x}); v != "a" || err != nil {
+					done <- fmt.Errorf("%T: %v, %v", x, v, err)
+					return
+				}
+			}
+			done <- nil
+		}()
+	}
+	for range 8 {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVMZeroAllocs(t *testing.T) {
+	data := map[string]any{
+		"age": int64(30), "score": 2.5, "name": "bob", "vip": true, "n": 7,
+		"tags": []any{"a", "b"}, "user": map[string]any{"age": int64(40)},
+	}
+	for _, src := range []string{
+		"age > 18 && score < 3.0",
+		"name == 'bob' || vip",
+		"age * 1000 - 5 > 10 && !vip",
+		"score * 2.0 > 4.0 && -score < 0",
+		"name in ['a', 'bob'] && n > 3",
+		"user.age > 18 && tags[0] == 'a'",
+		"len(name) + age * 100 > 2",
+		"(age % 7 == 2 ? score * 3.5 : score / 2.0) > 1.0",
+	} {
+		prog, err := NewEngine().Compile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := prog.Eval(data); err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		if n := testing.AllocsPerRun(100, func() { _, _ = prog.Eval(data) }); n != 0 {
+			t.Errorf("%s: %v allocs/op", src, n)
+		}
+	}
+}
+
+func (vmRoot) Keep(xs ...any) []any { return xs }
+
+func TestVMFuncKeepsArgs(t *testing.T) {
+	e := NewEngine()
+	if err := e.RegisterFunc("list", func(args []any) (any, error) { return args, nil }); err != nil {
+		t.Fatal(err)
+	}
+	data := vmRoot{"a": int64(1), "b": "x"}
+	for src, want := range map[string]any{
+		"list(a, b)":                        []any{int64(1), "x"},
+		"1 in list(a, b)":                   true,
+		"list(list(a), upper(b), list(b))":  []any{[]any{int64(1)}, "X", []any{"x"}},
+		"Keep(a, b)":                        []any{int64(1), "x"},
+		"'x' in Keep(a, b) && 1 in Keep(a)": true,
+	} {
+		prog, err := e.Compile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []*Program{prog, treeWalk(prog)} {
+			if v, err := p.Eval(data); err != nil || !reflect.DeepEqual(v, want) {
+				t.Errorf("%s = %#v, %v; want %#v", src, v, err, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package okra
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reason is one leaf condition of a boolean rule, a comparison or any other
+// operand of its &&, || and ! operators, and the value it had.
+type Reason struct {
+	// Expr is the condition's source text.
+	Expr string
+	// Start and End are its byte span [Start, End) in the Program's source.
+	Start, End int
+	Value      bool
+	// Operands are the condition's operands other than literals, with their
+	// values: `user.Age` in `user.Age >= 18`. Empty for a bare field or a
+	// macro call.
+	Operands []Operand
+}
+
+// Operand is a value a Reason's condition was computed from.
+type Operand struct {
+	Expr  string
+	Value any
+}
+
+// String renders the reason for people: `user.Age >= 18 was false
+// (user.Age = 16)`.
+func (r Reason) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s was %t", r.Expr, r.Value)
+	for i, o := range r.Operands {
+		if i == 0 {
+			sb.WriteString(" (")
+		} else {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "%s = %s", o.Expr, renderLiteral(o.Value))
+	}
+	if len(r.Operands) > 0 {
+		sb.WriteByte(')')
+	}
+	return sb.String()
+}
+
+// Why evaluates a boolean Program against data and returns its result with
+// the leaf conditions that decided it: for false, the failing conditions
+// without which it would not have failed; for true, the satisfying ones. One
+// false operand of a && is enough (the first that was), and a false || needs
+// all its operands false; dually for true. A ternary contributes its
+// condition and the branch it took.
+//
+// Like Explain, Why evaluates the rule as written, and it is meant for
+// telling a person why, not for every request. It fails with the error of the
+// evaluation, or when the rule does not yield a bool.
+func (p *Program) Why(data any) (bool, []Reason, error) {
+	x := p.Explain(data)
+	if x.Err != nil {
+		return false, nil, x.Err
+	}
+	b, ok := x.Value.(bool)
+	if !ok {
+		return false, nil, fmt.Errorf("okra: rule yields %T, not bool", x.Value)
+	}
+	var reasons []Reason
+	why(x, b, &reasons)
+	return b, reasons, nil
+}
+
+// why appends the reasons x, evaluated to b, has that value.
+func why(x *Explanation, b bool, reasons *[]Reason) {
+	switch n := x.node.(type) {
+	case *InfixExpr:
+		if n.Op == "&&" || n.Op == "||" {
+			// The value of the operator's deciding operand (false for &&),
+			// which one operand suffices to give it, where the other value
+			// needs every operand.
+			if decisive := n.Op == "||"; b == decisive {
+				for _, c := range x.Children {
+					if c.Evaluated && c.Value == decisive {
+						why(c, b, reasons)
+						return
+					}
+				}
+			} else {
+				for _, c := range x.Children {
+					why(c, b, reasons)
+				}
+				return
+			}
+		}
+	case *UnaryExpr:
+		if n.Op == "!" {
+			why(x.Children[0], !b, reasons)
+			return
+		}
+	case *TernaryExpr:
+		cond, then, els := x.Children[0], x.Children[1], x.Children[2]
+		if c, ok := cond.Value.(bool); ok {
+			why(cond, c, reasons)
+			if c {
+				why(then, b, reasons)
+			} else {
+				why(els, b, reasons)
+			}
+			return
+		}
+	}
+	if x.literal {
+		return // a constant decides nothing about the data
+	}
+	r := Reason{Expr: x.Expr, Start: x.Start, End: x.End, Value: b}
+	switch x.node.(type) {
+	case *VariableExpr, *MemberAccessExpr, *IndexExpr:
+		// The field is the operand.
+	default:
+		for _, c := range x.Children {
+			if c.Evaluated && !c.literal {
+				r.Operands = append(r.Operands, Operand{Expr: c.Expr, Value: c.Value})
+			}
+		}
+	}
+	*reasons = append(*reasons, r)
+}
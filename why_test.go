@@ -0,0 +1,95 @@
+package okra
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWhy(t *testing.T) {
+	e := NewEngine()
+	registerAnyAll(t, e)
+	const rule = "user.Age >= 18 && (user.Country in ['NL', 'BE'] || user.VIP) && !user.Blocked"
+	p, err := e.Compile(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := func(age int64, country string, vip, blocked bool) map[string]any {
+		return map[string]any{"user": map[string]any{"Age": age, "Country": country, "VIP": vip, "Blocked": blocked}}
+	}
+	cases := []struct {
+		data any
+		want bool
+		why  []string
+	}{
+		{user(16, "NL", false, false), false, []string{"user.Age >= 18 was false (user.Age = 16)"}},
+		{user(30, "DE", false, false), false, []string{
+			"user.Country in ['NL', 'BE'] was false (user.Country = 'DE')",
+			"user.VIP was false",
+		}},
+		{user(30, "DE", true, true), false, []string{"user.Blocked was true"}},
+		{user(30, "BE", false, false), true, []string{
+			"user.Age >= 18 was true (user.Age = 30)",
+			"user.Country in ['NL', 'BE'] was true (user.Country = 'BE')",
+			"user.Blocked was false",
+		}},
+	}
+	for _, opt := range []Optimization{0, OptAll} {
+		e.SetOptimizations(opt)
+		p, _ := e.Compile(rule)
+		for _, c := range cases {
+			got, reasons, err := p.Why(c.data)
+			var why []string
+			for _, r := range reasons {
+				why = append(why, r.String())
+			}
+			if err != nil || got != c.want || strings.Join(why, "\n") != strings.Join(c.why, "\n") {
+				t.Errorf("optimizations %v: %v: %v, %q, %v; want %v, %q", opt, c.data, got, why, err, c.want, c.why)
+			}
+		}
+	}
+
+	_, reasons, _ := p.Why(user(16, "NL", false, false))
+	if r := reasons[0]; r.Start != 0 || r.End != 14 || r.Value || len(r.Operands) != 1 || r.Operands[0].Value != int64(16) {
+		t.Fatalf("reason %+v", r)
+	}
+}
+
+func TestWhyBranches(t *testing.T) {
+	e := NewEngine()
+	registerAnyAll(t, e)
+	for src, want := range map[string]string{
+		"vip ? amount < 1000 : amount < 100":                "vip was false\namount < 100 was false (amount = 500)",
+		"!(amount > 100 || vip)":                            "amount > 100 was true (amount = 500)",
+		"any(items, price > 10) || len(items) > 5 && false": "any(items, price > 10) was false\nlen(items) > 5 was false (len(items) = 1)",
+		"len(items) == 1":                                   "len(items) == 1 was true (len(items) = 1)",
+	} {
+		p, err := e.Compile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, reasons, err := p.Why(map[string]any{"vip": false, "amount": int64(500), "items": []any{map[string]any{"price": int64(5)}}})
+		var why []string
+		for _, r := range reasons {
+			why = append(why, r.String())
+		}
+		if err != nil || strings.Join(why, "\n") != want {
+			t.Errorf("%s: %q, %v; want %q", src, why, err, want)
+		}
+	}
+}
+
+func TestWhyErrors(t *testing.T) {
+	e := NewEngine()
+	for src, want := range map[string]string{
+		"1 + 1":     "okra: rule yields int64, not bool",
+		"a / 0 > 1": "division by zero",
+	} {
+		p, err := e.Compile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := p.Why(map[string]any{"a": int64(1)}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: %v, want %q", src, err, want)
+		}
+	}
+}